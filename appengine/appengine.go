@@ -21,17 +21,37 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"os"
 
 	"google.golang.org/appengine/v2"
 	"github.com/google/splice/appengine/endpoints"
+	"github.com/google/splice/shared/tracing"
 )
 
 func main() {
+	// Spans are exported as configured by the TRACE_EXPORTER and TRACE_FILE
+	// environment variables.
+	shutdown, err := tracing.Init(tracing.Config{
+		Service:  "splice-app",
+		Exporter: os.Getenv("TRACE_EXPORTER"),
+		Path:     os.Getenv("TRACE_FILE"),
+	})
+	if err != nil {
+		log.Fatalf("tracing.Init: %v", err)
+	}
+	defer shutdown(context.Background())
+
 	http.Handle("/request", &endpoints.AttendedRequestHandler{})
 	http.Handle("/result", endpoints.ResultHandler(endpoints.ProcessResult))
 	http.Handle("/request-unattended", &endpoints.UnattendedRequestHandler{})
 	http.Handle("/result-unattended", endpoints.ResultHandler(endpoints.ProcessResult))
+	http.Handle("/challenge", &endpoints.ChallengeHandler{})
+	http.Handle("/joiners", &endpoints.FleetHandler{})
+	http.Handle("/approvals", &endpoints.ApprovalsHandler{})
+	http.Handle("/approve", &endpoints.ApprovalHandler{})
 
 	appengine.Main()
 }
@@ -0,0 +1,383 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"golang.org/x/net/context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/user"
+	"cloud.google.com/go/datastore"
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+var (
+	// ApprovalTimeout sets how long a request may be held for approval
+	// before it fails.
+	ApprovalTimeout = 24 * time.Hour
+
+	// currentUser returns the email address of the administrator making
+	// an approval decision.
+	currentUser = func(ctx context.Context) string {
+		if u := user.Current(ctx); u != nil {
+			return u.Email
+		}
+		return ""
+	}
+)
+
+// mayApprove reports whether the signed-in user, whose email address is
+// email, may list and decide on requests held for approval. Administrators of
+// the App may, as may the users listed in the APPROVERS environment variable,
+// a semicolon separated list of email addresses.
+func mayApprove(ctx context.Context, email string) bool {
+	if isAdmin(ctx) {
+		return true
+	}
+	if email == "" {
+		return false
+	}
+	for _, approver := range strings.Split(os.Getenv("APPROVERS"), ";") {
+		if strings.EqualFold(strings.TrimSpace(approver), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalsHandler implements http.Handler and lists the requests held for
+// approval. Requests that have waited longer than ApprovalTimeout are failed
+// rather than listed. They are only listed for approvers.
+type ApprovalsHandler struct{}
+
+func (ah ApprovalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	var resp *models.ApprovalsResponse
+	if !mayApprove(ctx, currentUser(ctx)) {
+		resp = &models.ApprovalsResponse{ErrorCode: server.StatusNotAdministrator, Status: "requests pending approval are only listed for approvers"}
+	} else {
+		resp = listApprovals(ctx, time.Now())
+	}
+	if resp.ErrorCode != server.StatusSuccess {
+		log.Warningf(ctx, "%d %q while listing requests pending approval", resp.ErrorCode, resp.Status)
+	}
+
+	jsonResponse, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf(ctx, "json.Marshal(%v) failed: %v", resp, err)
+		http.Error(
+			w,
+			fmt.Sprintf("json.Marshal(%v) failed: %v", resp, err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// listApprovals expires stale requests and returns the ones still awaiting a
+// decision as of now, oldest first.
+func listApprovals(ctx context.Context, now time.Time) *models.ApprovalsResponse {
+	dc, status, err := NewClient(ctx, nil)
+	if err != nil {
+		return &models.ApprovalsResponse{ErrorCode: status, Status: err.Error()}
+	}
+	defer dc.Close()
+
+	if err := dc.StartTx(ctx); err != nil {
+		return &models.ApprovalsResponse{ErrorCode: server.StatusDatastoreTxCreateError, Status: err.Error()}
+	}
+	defer dc.RollbackTx()
+
+	requests, err := expireApprovals(ctx, dc, now)
+	if err != nil {
+		return &models.ApprovalsResponse{ErrorCode: server.StatusDatastoreLookupError, Status: err.Error()}
+	}
+	if err := dc.CommitTx(); err != nil {
+		return &models.ApprovalsResponse{ErrorCode: server.StatusDatastoreTxCommitError, Status: err.Error()}
+	}
+
+	resp := &models.ApprovalsResponse{
+		ErrorCode: server.StatusSuccess,
+		Status:    fmt.Sprintf("%d requests pending approval", len(requests)),
+		Pending:   []models.PendingRequest{},
+	}
+	for _, req := range requests {
+		resp.Pending = append(resp.Pending, models.PendingRequest{
+			RequestID:   req.RequestID,
+			Hostname:    req.Hostname,
+			GeneratorID: req.GeneratorID,
+			ClientID:    req.ClientID,
+			Requester:   req.Requester,
+			Domain:      req.Domain,
+			OU:          req.OU,
+			ProjectID:   string(req.GCEMetadata.ProjectID),
+			AcceptTime:  req.AcceptTime,
+			ExpireTime:  req.AcceptTime.Add(ApprovalTimeout),
+		})
+	}
+	sort.Slice(resp.Pending, func(i, k int) bool {
+		return resp.Pending[i].AcceptTime.Before(resp.Pending[k].AcceptTime)
+	})
+	return resp
+}
+
+// ApprovalHandler implements http.Handler and records an approver's decision
+// on a request held for approval. Approved requests are published to the
+// joiners, and denied requests fail with the reason given.
+type ApprovalHandler struct{}
+
+func (ah ApprovalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	resp := ProcessApproval(ctx, r)
+	if resp.ErrorCode != server.StatusSuccess {
+		log.Warningf(ctx, "%d %q while processing approval for %q", resp.ErrorCode, resp.Status, resp.RequestID)
+	}
+
+	jsonResponse, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf(ctx, "json.Marshal(%v) failed: %v", resp, err)
+		http.Error(
+			w,
+			fmt.Sprintf("json.Marshal(%v) failed: %v", resp, err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// ProcessApproval takes a models.ApprovalDecision from an approver and
+// applies it to the request it names, which must be pending approval. A
+// reason is required for every decision, and nobody may decide on their own
+// request.
+func ProcessApproval(ctx context.Context, r *http.Request) *models.Response {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return &models.Response{
+			ErrorCode: server.StatusRequestUnreadable,
+			Status:    "unable to read HTTP request body",
+		}
+	}
+
+	var decision models.ApprovalDecision
+	if err = json.Unmarshal(body, &decision); err != nil {
+		return &models.Response{
+			ErrorCode: server.StatusJSONUmarshalError,
+			Status:    "unable to unmarshal json approval",
+		}
+	}
+	if decision.RequestID == "" || decision.Reason == "" {
+		return &models.Response{
+			RequestID: decision.RequestID,
+			ErrorCode: server.StatusReqProcessingError,
+			Status:    "invalid approval: RequestID and Reason are required",
+		}
+	}
+
+	approver := currentUser(ctx)
+	if approver == "" {
+		return &models.Response{
+			RequestID: decision.RequestID,
+			ErrorCode: server.StatusReqProcessingError,
+			Status:    "the approver is not signed in",
+		}
+	}
+	if !mayApprove(ctx, approver) {
+		return &models.Response{
+			RequestID: decision.RequestID,
+			ErrorCode: server.StatusNotAdministrator,
+			Status:    fmt.Sprintf("%s is not an approver", approver),
+		}
+	}
+
+	dc, status, err := NewClient(ctx, nil)
+	if err != nil {
+		return &models.Response{ErrorCode: status, Status: err.Error()}
+	}
+	defer dc.Close()
+
+	if err := dc.StartTx(ctx); err != nil {
+		return &models.Response{
+			ErrorCode: server.StatusDatastoreTxCreateError,
+			Status:    err.Error(),
+		}
+	}
+	defer dc.RollbackTx()
+
+	status, err = dc.Find(ctx, decision.RequestID)
+	if err != nil {
+		return &models.Response{ErrorCode: status, Status: err.Error()}
+	}
+	if status == server.StatusDatastoreLookupNotFound {
+		return &models.Response{
+			RequestID: decision.RequestID,
+			ErrorCode: status,
+			Status:    fmt.Sprintf("request not found: %q", decision.RequestID),
+		}
+	}
+
+	now := time.Now()
+	req := dc.Req
+	if req.Status != models.RequestStatusPendingApproval {
+		return &models.Response{
+			RequestID: req.RequestID,
+			ErrorCode: server.StatusRequestNotPending,
+			Status:    fmt.Sprintf("request %q is %s, not pending approval", req.RequestID, req.Status),
+		}
+	}
+	if strings.EqualFold(req.Requester, approver) {
+		return &models.Response{
+			RequestID: req.RequestID,
+			ErrorCode: server.StatusSelfApproval,
+			Status:    fmt.Sprintf("request %q was made by %s, who may not decide on it", req.RequestID, approver),
+		}
+	}
+	if approvalExpired(req, now) {
+		if resp := expireRequest(ctx, dc, now); resp.ErrorCode != server.StatusSuccess {
+			return resp
+		}
+		return &models.Response{
+			RequestID: req.RequestID,
+			ErrorCode: server.StatusRequestNotPending,
+			Status:    fmt.Sprintf("request %q expired before a decision was made", req.RequestID),
+		}
+	}
+
+	req.Approver = approver
+	req.ApprovalReason = decision.Reason
+	req.ApprovalTime = now
+	if decision.Approve {
+		// The request is accepted for processing now, so that it is not
+		// mistaken for one that was never claimed.
+		req.Status = models.RequestStatusAccepted
+		req.AcceptTime = now
+		req.Attempts = 1
+	} else {
+		req.Status = models.RequestStatusFailed
+		req.CompletionTime = now
+		req.ResponseData = []byte(fmt.Sprintf("denied by %s: %s", approver, decision.Reason))
+	}
+
+	if status, err := dc.Save(ctx); err != nil {
+		return &models.Response{
+			ErrorCode: status,
+			Status:    err.Error(),
+		}
+	}
+	if err := dc.CommitTx(); err != nil {
+		return &models.Response{
+			ErrorCode: server.StatusDatastoreTxCommitError,
+			Status:    err.Error(),
+		}
+	}
+
+	if decision.Approve && usePubsub {
+		if err := publish(ctx, req); err != nil {
+			return &models.Response{
+				RequestID: req.RequestID,
+				ErrorCode: server.StatusPubsubFailure,
+				Status:    err.Error(),
+			}
+		}
+	}
+
+	log.Infof(ctx, "request %q for host %q is now %s by decision of %s: %q", req.RequestID, req.Hostname, req.Status, approver, decision.Reason)
+	return &models.Response{
+		ErrorCode: server.StatusSuccess,
+		Status:    req.Status,
+		RequestID: req.RequestID,
+		Hostname:  req.Hostname,
+	}
+}
+
+// approvalExpired reports whether req has been held for approval for longer
+// than ApprovalTimeout as of now.
+func approvalExpired(req *models.Request, now time.Time) bool {
+	return req.Status == models.RequestStatusPendingApproval && now.Sub(req.AcceptTime) > ApprovalTimeout
+}
+
+// expireApproval fails req, which nobody approved or denied in time.
+func expireApproval(req *models.Request, now time.Time) {
+	req.Status = models.RequestStatusFailed
+	req.CompletionTime = now
+	req.ResponseData = []byte(fmt.Sprintf("the request was not approved within %v", ApprovalTimeout))
+}
+
+// expireRequest fails the expired request held by dc and commits it. It must
+// be called with a transaction in progress.
+func expireRequest(ctx context.Context, dc *Client, now time.Time) *models.Response {
+	expireApproval(dc.Req, now)
+	if status, err := dc.Save(ctx); err != nil {
+		return &models.Response{
+			ErrorCode: status,
+			Status:    err.Error(),
+		}
+	}
+	if err := dc.CommitTx(); err != nil {
+		return &models.Response{
+			ErrorCode: server.StatusDatastoreTxCommitError,
+			Status:    err.Error(),
+		}
+	}
+
+	log.Infof(ctx, "request %q expired while pending approval", dc.Req.RequestID)
+	return &models.Response{
+		ErrorCode:    server.StatusSuccess,
+		Status:       dc.Req.Status,
+		Hostname:     dc.Req.Hostname,
+		RequestID:    dc.Req.RequestID,
+		ResponseData: dc.Req.ResponseData,
+	}
+}
+
+// expireApprovals fails the requests held for approval for longer than
+// ApprovalTimeout as of now, and returns the requests still awaiting a
+// decision. It must be called with a transaction in progress.
+func expireApprovals(ctx context.Context, dc *Client, now time.Time) ([]models.Request, error) {
+	keys, requests, err := dc.FindByStatus(ctx, models.RequestStatusPendingApproval)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []models.Request
+	for i, req := range requests {
+		if !approvalExpired(&req, now) {
+			pending = append(pending, req)
+			continue
+		}
+		expireApproval(&req, now)
+		dc.Req = &req
+		dc.Keys = []*datastore.Key{keys[i]}
+		if _, err := dc.Save(ctx); err != nil {
+			return nil, err
+		}
+		log.Infof(ctx, "request %q expired while pending approval", req.RequestID)
+	}
+	return pending, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"golang.org/x/net/context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"google.golang.org/appengine/v2"
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+const (
+	// nonceLen is the length in bytes of a challenge nonce.
+	nonceLen = 32
+)
+
+var (
+	// NonceLifetime sets how long a challenge nonce may be used after it
+	// is issued.
+	NonceLifetime = 5 * time.Minute
+)
+
+// ChallengeHandler implements http.Handler and issues the single-use nonces
+// that clients include in their requests and result queries, so that a
+// captured request cannot be replayed.
+type ChallengeHandler struct{}
+
+func (ch ChallengeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	resp := issueNonce(ctx, time.Now())
+	if resp.ErrorCode != server.StatusSuccess {
+		log.Warningf(ctx, "%d %q while issuing a challenge nonce", resp.ErrorCode, resp.Status)
+	}
+
+	jsonResponse, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf(ctx, "json.Marshal(%v) failed: %v", resp, err)
+		http.Error(
+			w,
+			fmt.Sprintf("json.Marshal(%v) failed: %v", resp, err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// issueNonce generates a nonce and stores it until NonceLifetime after now.
+func issueNonce(ctx context.Context, now time.Time) *models.NonceResponse {
+	b := make([]byte, nonceLen)
+	if _, err := rand.Read(b); err != nil {
+		return &models.NonceResponse{ErrorCode: server.StatusReqProcessingError, Status: fmt.Sprintf("rand.Read returned %v", err)}
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	dc, status, err := NewClient(ctx, nil)
+	if err != nil {
+		return &models.NonceResponse{ErrorCode: status, Status: err.Error()}
+	}
+	defer dc.Close()
+
+	expireAt := now.Add(NonceLifetime)
+	if err := dc.PutNonce(ctx, nonce, expireAt); err != nil {
+		return &models.NonceResponse{ErrorCode: server.StatusDatastoreWriteError, Status: err.Error()}
+	}
+	return &models.NonceResponse{
+		ErrorCode:  server.StatusSuccess,
+		Status:     "OK",
+		Nonce:      nonce,
+		ExpireTime: expireAt,
+	}
+}
+
+// consumeNonce uses up nonce, and returns an error if it was not issued by
+// issueNonce, has expired, or was already used. Nonces are not required if
+// the VERIFY_NONCE environment variable is set to false.
+func consumeNonce(ctx context.Context, dc *Client, nonce string) (server.StatusCode, error) {
+	if os.Getenv("VERIFY_NONCE") == "false" {
+		return server.StatusSuccess, nil
+	}
+	if nonce == "" {
+		return server.StatusInvalidNonce, errors.New("the request does not carry a challenge nonce")
+	}
+	valid, err := dc.ConsumeNonce(ctx, nonce, time.Now())
+	if err != nil {
+		return server.StatusDatastoreLookupError, err
+	}
+	if !valid {
+		return server.StatusInvalidNonce, errors.New("the challenge nonce is unknown, expired or already used")
+	}
+	return server.StatusSuccess, nil
+}
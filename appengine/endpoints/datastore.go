@@ -28,13 +28,161 @@ import (
 	"github.com/google/splice/models"
 )
 
+// backend provides the datastore operations used by Client.
+type backend interface {
+	NewTransaction(ctx context.Context) (transaction, error)
+	// RequestsByID returns the requests with the ancestor reqID. If tx is
+	// not nil, the query runs as part of tx.
+	RequestsByID(ctx context.Context, reqID string, tx transaction) ([]*datastore.Key, []models.Request, error)
+	RequestsByStatus(ctx context.Context, status string) ([]*datastore.Key, []models.Request, error)
+	Joiners(ctx context.Context) ([]models.Joiner, error)
+	// RecordSignature records that the request signature identified by
+	// digest was used, until expireAt. It reports whether the signature
+	// was not already recorded.
+	RecordSignature(ctx context.Context, digest string, expireAt time.Time) (bool, error)
+	// PutNonce stores a challenge nonce that may be used until expireAt.
+	PutNonce(ctx context.Context, nonce string, expireAt time.Time) error
+	// ConsumeNonce deletes nonce, and reports whether it was stored and
+	// had not expired as of now.
+	ConsumeNonce(ctx context.Context, nonce string, now time.Time) (bool, error)
+	Close() error
+}
+
+// transaction is an in-flight datastore transaction.
+type transaction interface {
+	Put(key *datastore.Key, src interface{}) (*datastore.PendingKey, error)
+	Commit() (*datastore.Commit, error)
+	Rollback() error
+}
+
+// cloudDatastore implements backend using the Cloud Datastore.
+type cloudDatastore struct {
+	*datastore.Client
+}
+
+func newCloudDatastore(ctx context.Context) (backend, error) {
+	client, err := datastore.NewClient(ctx, appengine.AppID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return cloudDatastore{client}, nil
+}
+
+func (c cloudDatastore) NewTransaction(ctx context.Context) (transaction, error) {
+	tx, err := c.Client.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (c cloudDatastore) RequestsByID(ctx context.Context, reqID string, tx transaction) ([]*datastore.Key, []models.Request, error) {
+	var requests []models.Request
+	ancestor := datastore.NameKey("RequestID", reqID, nil)
+	query := datastore.NewQuery("Request").Ancestor(ancestor)
+	if tx, ok := tx.(*datastore.Transaction); ok {
+		query = query.Transaction(tx)
+	}
+	keys, err := c.GetAll(ctx, query, &requests)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client.GetAll(%v, %v) returned %v", ctx, query, err)
+	}
+	return keys, requests, nil
+}
+
+func (c cloudDatastore) RequestsByStatus(ctx context.Context, status string) ([]*datastore.Key, []models.Request, error) {
+	var requests []models.Request
+	query := datastore.NewQuery("Request").Filter("Status =", status)
+	keys, err := c.GetAll(ctx, query, &requests)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client.GetAll(%v, %v) for returned %v", ctx, query, err)
+	}
+	return keys, requests, nil
+}
+
+func (c cloudDatastore) Joiners(ctx context.Context) ([]models.Joiner, error) {
+	var joiners []models.Joiner
+	query := datastore.NewQuery("Joiner")
+	if _, err := c.GetAll(ctx, query, &joiners); err != nil {
+		return nil, fmt.Errorf("client.GetAll(%v, %v) returned %v", ctx, query, err)
+	}
+	return joiners, nil
+}
+
+// usedSignature records a request signature that was already used, under
+// the Signature kind. ExpireAt allows the Datastore to apply a TTL once the
+// signature would be rejected as stale anyway.
+type usedSignature struct {
+	ExpireAt time.Time
+}
+
+func (c cloudDatastore) RecordSignature(ctx context.Context, digest string, expireAt time.Time) (bool, error) {
+	key := datastore.NameKey("Signature", digest, nil)
+	var fresh bool
+	_, err := c.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var used usedSignature
+		err := tx.Get(key, &used)
+		if err == nil {
+			fresh = false
+			return nil
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		fresh = true
+		_, err = tx.Put(key, &usedSignature{ExpireAt: expireAt})
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("recording signature %q returned %v", digest, err)
+	}
+	return fresh, nil
+}
+
+// challengeNonce records a challenge nonce that was issued and not yet used,
+// under the Nonce kind. ExpireAt allows the Datastore to apply a TTL to
+// nonces that were never used.
+type challengeNonce struct {
+	ExpireAt time.Time
+}
+
+func (c cloudDatastore) PutNonce(ctx context.Context, nonce string, expireAt time.Time) error {
+	key := datastore.NameKey("Nonce", nonce, nil)
+	if _, err := c.Put(ctx, key, &challengeNonce{ExpireAt: expireAt}); err != nil {
+		return fmt.Errorf("client.Put(%v) returned %v", key, err)
+	}
+	return nil
+}
+
+func (c cloudDatastore) ConsumeNonce(ctx context.Context, nonce string, now time.Time) (bool, error) {
+	key := datastore.NameKey("Nonce", nonce, nil)
+	var valid bool
+	_, err := c.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var issued challengeNonce
+		err := tx.Get(key, &issued)
+		if err == datastore.ErrNoSuchEntity {
+			valid = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		valid = now.Before(issued.ExpireAt)
+		return tx.Delete(key)
+	})
+	if err != nil {
+		return false, fmt.Errorf("consuming nonce returned %v", err)
+	}
+	return valid, nil
+}
+
 // Client is a datastore client that includes transaction
 // relevant metadata.
 type Client struct {
-	client *datastore.Client
+	client backend
 	Keys   []*datastore.Key
 	Req    *models.Request
-	tx     *datastore.Transaction
+	tx     transaction
 }
 
 // Close closes the datastore client.
@@ -130,21 +278,12 @@ func (c *Client) Find(ctx context.Context, reqID string) (server.StatusCode, err
 			fmt.Errorf("missing requestID(%q)", reqID)
 	}
 
-	var err error
-	var requests []models.Request
-	ancestor := datastore.NameKey("RequestID", reqID, nil)
-	query := datastore.NewQuery("Request").Ancestor(ancestor)
-
 	// Associate the current transaction if one is specified.
-	if c.tx != nil {
-		query.Transaction(c.tx)
-	}
-
-	c.Keys, err = c.client.GetAll(ctx, query, &requests)
+	keys, requests, err := c.client.RequestsByID(ctx, reqID, c.tx)
 	if err != nil {
-		return server.StatusDatastoreLookupError,
-			fmt.Errorf("client.GetAll(%v, %v) returned %v", ctx, query, err)
+		return server.StatusDatastoreLookupError, err
 	}
+	c.Keys = keys
 
 	if len(requests) < 1 {
 		return server.StatusDatastoreLookupNotFound, nil
@@ -167,11 +306,9 @@ func (c *Client) FindOrphans(ctx context.Context, olderThan time.Duration, kind
 		return nil, nil, errors.New("client does not have an active transaction")
 	}
 
-	var requestsRaw []models.Request
-	query := datastore.NewQuery("Request").Filter("Status =", kind)
-	keysRaw, err := c.client.GetAll(ctx, query, &requestsRaw)
+	keysRaw, requestsRaw, err := c.client.RequestsByStatus(ctx, kind)
 	if err != nil {
-		return nil, nil, fmt.Errorf("client.GetAll(%v, %v) for returned %v", ctx, query, err)
+		return nil, nil, err
 	}
 
 	// Filter out current requests here to workaround
@@ -189,9 +326,58 @@ func (c *Client) FindOrphans(ctx context.Context, olderThan time.Duration, kind
 	return keys, requests, nil
 }
 
+// FindByStatus returns the requests with the given status.
+func (c *Client) FindByStatus(ctx context.Context, status string) ([]*datastore.Key, []models.Request, error) {
+	if c.client == nil {
+		return nil, nil, errors.New("missing datastore client")
+	}
+
+	return c.client.RequestsByStatus(ctx, status)
+}
+
+// Joiners returns the most recent heartbeat of every joiner that has
+// registered with the datastore.
+func (c *Client) Joiners(ctx context.Context) ([]models.Joiner, error) {
+	if c.client == nil {
+		return nil, errors.New("missing datastore client")
+	}
+
+	return c.client.Joiners(ctx)
+}
+
+// RecordSignature records that the request signature identified by digest
+// was used, until expireAt. It reports whether the signature was not already
+// recorded.
+func (c *Client) RecordSignature(ctx context.Context, digest string, expireAt time.Time) (bool, error) {
+	if c.client == nil {
+		return false, errors.New("missing datastore client")
+	}
+
+	return c.client.RecordSignature(ctx, digest, expireAt)
+}
+
+// PutNonce stores a challenge nonce that may be used until expireAt.
+func (c *Client) PutNonce(ctx context.Context, nonce string, expireAt time.Time) error {
+	if c.client == nil {
+		return errors.New("missing datastore client")
+	}
+
+	return c.client.PutNonce(ctx, nonce, expireAt)
+}
+
+// ConsumeNonce deletes nonce, and reports whether it was stored and had not
+// expired as of now.
+func (c *Client) ConsumeNonce(ctx context.Context, nonce string, now time.Time) (bool, error) {
+	if c.client == nil {
+		return false, errors.New("missing datastore client")
+	}
+
+	return c.client.ConsumeNonce(ctx, nonce, now)
+}
+
 // NewClient returns a splice datastore client to the caller.
 func NewClient(ctx context.Context, req *models.Request) (*Client, server.StatusCode, error) {
-	client, err := datastore.NewClient(ctx, appengine.AppID(ctx))
+	client, err := newBackend(ctx)
 	if err != nil {
 		return nil,
 			server.StatusDatastoreClientCreateError,
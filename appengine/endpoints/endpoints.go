@@ -26,12 +26,15 @@ import (
 	"os"
 
 	"github.com/google/splice/appengine/validators"
-	"google.golang.org/appengine/v2/log"
 )
 
 // reqIDLength represents the length in bytes of a requestID
-// e.g. 128 bytes = 1024 bits.
-const reqIDLen = 128
+// e.g. 16 bytes = 128 bits. RequestIDs are handles that are safe to log;
+// results are retrieved with a separate token.
+const reqIDLen = 16
+
+// tokenLen represents the length in bytes of a retrieval token.
+const tokenLen = 32
 
 // For easier testing, use a vars for validators and
 // datastore usage
@@ -40,6 +43,8 @@ var (
 	validatorsNewUnattended = validators.NewUnattended
 	useDatastore            = true
 	usePubsub               = true
+	newBackend              = newCloudDatastore
+	publish                 = publishRequest
 )
 
 // verifyCert returns an error if there is a discrepancy between
@@ -266,3 +266,23 @@ func TestVerifyCert(t *testing.T) {
 		t.Errorf("Env variable is false: verifyCert = %v, want nil", err)
 	}
 }
+
+func TestTopicFor(t *testing.T) {
+	t.Setenv("PUBSUB_TOPIC", "requests")
+	t.Setenv("DOMAIN_TOPICS", "lab.example.com=requests-lab; other.example.com = requests-other")
+	for domain, want := range map[string]string{
+		"":                  "requests",
+		"corp.example.com":  "requests",
+		"LAB.example.com":   "requests-lab",
+		"other.example.com": "requests-other",
+	} {
+		if got, err := topicFor(domain); err != nil || got != want {
+			t.Errorf("topicFor(%q) = %q, %v, want %q", domain, got, err, want)
+		}
+	}
+
+	t.Setenv("PUBSUB_TOPIC", "")
+	if got, err := topicFor("corp.example.com"); err == nil {
+		t.Errorf("topicFor without PUBSUB_TOPIC = %q, want error", got)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/user"
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+var (
+	// JoinerStaleAfter sets how long a joiner may go without a heartbeat
+	// before it is reported as stale.
+	JoinerStaleAfter = 5 * models.JoinerHeartbeatInterval
+
+	// isAdmin reports whether the signed-in user is an administrator of
+	// the App.
+	isAdmin = user.IsAdmin
+)
+
+// FleetHandler implements http.Handler and reports the registered joiners
+// and their liveness. It exposes the configuration of the joiners, so it is
+// only served to administrators of the App.
+type FleetHandler struct{}
+
+func (fh FleetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	resp := &models.FleetResponse{ErrorCode: server.StatusSuccess}
+	if !isAdmin(ctx) {
+		resp = &models.FleetResponse{ErrorCode: server.StatusNotAdministrator, Status: "the joiner fleet is only listed for administrators"}
+	} else if useDatastore {
+		dc, status, err := NewClient(ctx, nil)
+		if err != nil {
+			resp = &models.FleetResponse{ErrorCode: status, Status: err.Error()}
+		} else {
+			defer dc.Close()
+			joiners, err := dc.Joiners(ctx)
+			if err != nil {
+				resp = &models.FleetResponse{ErrorCode: server.StatusDatastoreLookupError, Status: err.Error()}
+			} else {
+				resp = fleetStatus(joiners, time.Now())
+			}
+		}
+	}
+	if resp.ErrorCode != server.StatusSuccess {
+		log.Warningf(ctx, "%d %q while listing joiners", resp.ErrorCode, resp.Status)
+	} else if resp.Live == 0 {
+		log.Warningf(ctx, "no live joiners are registered; requests will not be processed")
+	}
+
+	jsonResponse, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf(ctx, "json.Marshal(%v) failed: %v", resp, err)
+		http.Error(
+			w,
+			fmt.Sprintf("json.Marshal(%v) failed: %v", resp, err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// fleetStatus flags the joiners that have not sent a heartbeat since
+// JoinerStaleAfter before now, and counts the ones that have.
+func fleetStatus(joiners []models.Joiner, now time.Time) *models.FleetResponse {
+	resp := &models.FleetResponse{
+		ErrorCode: server.StatusSuccess,
+		Status:    fmt.Sprintf("%d joiners registered", len(joiners)),
+		Joiners:   []models.JoinerStatus{},
+	}
+	for _, j := range joiners {
+		stale := now.Sub(j.LastSeen) > JoinerStaleAfter
+		if !stale {
+			resp.Live++
+		}
+		resp.Joiners = append(resp.Joiners, models.JoinerStatus{Joiner: j, Stale: stale})
+	}
+	sort.Slice(resp.Joiners, func(i, k int) bool {
+		return resp.Joiners[i].Instance < resp.Joiners[k].Instance
+	})
+	return resp
+}
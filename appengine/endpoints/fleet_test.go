@@ -0,0 +1,46 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/splice/models"
+)
+
+func TestFleetStatus(t *testing.T) {
+	now := time.Now()
+	joiners := []models.Joiner{
+		{Instance: "spliced2", LastSeen: now.Add(-JoinerStaleAfter - time.Second)},
+		{Instance: "spliced1", LastSeen: now.Add(-time.Minute)},
+	}
+	resp := fleetStatus(joiners, now)
+	if resp.Live != 1 {
+		t.Errorf("fleetStatus().Live = %d, want 1", resp.Live)
+	}
+	want := []models.JoinerStatus{
+		{Joiner: joiners[1], Stale: false},
+		{Joiner: joiners[0], Stale: true},
+	}
+	if diff := cmp.Diff(want, resp.Joiners); diff != "" {
+		t.Errorf("fleetStatus() produced unexpected diff: %v", diff)
+	}
+
+	if resp := fleetStatus(nil, now); resp.Live != 0 || len(resp.Joiners) != 0 {
+		t.Errorf("fleetStatus(nil) = %v, want no joiners", resp)
+	}
+}
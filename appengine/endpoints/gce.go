@@ -0,0 +1,79 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"golang.org/x/net/context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/splice/appengine/identity"
+	"github.com/google/splice/cli/gce"
+)
+
+// gceRequired reports whether the GCE instance described by md must prove
+// its identity. Any GCE metadata at all describes an instance, which must
+// prove its identity unless the VERIFY_GCE environment variable is set to
+// false.
+func gceRequired(md gce.Metadata) bool {
+	described := len(md.InstanceID) > 0 || len(md.ProjectID) > 0 || len(md.Zone) > 0 ||
+		md.Audience != "" || len(md.Identity) > 0
+	return described && os.Getenv("VERIFY_GCE") != "false"
+}
+
+// gceAudience returns the audience that GCE identity tokens sent with r must
+// be requested for: the URL of the endpoint r was sent to. The URL of the App
+// is taken from the APP_URL environment variable, which must be set. The
+// host r claims to be sent to is chosen by the client, so it cannot be
+// trusted to form the audience.
+func gceAudience(r *http.Request) (string, error) {
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		return "", errors.New("APP_URL must be set to verify GCE identity tokens")
+	}
+	return strings.TrimSuffix(appURL, "/") + r.URL.Path, nil
+}
+
+// verifyInstance returns an error unless token is a GCE identity token, signed
+// by Google for the endpoint r was sent to, of the instance described by want.
+func verifyInstance(ctx context.Context, r *http.Request, token []byte, want gce.Metadata) error {
+	if len(want.InstanceID) == 0 || len(want.ProjectID) == 0 || len(want.Zone) == 0 {
+		return fmt.Errorf("GCE metadata %s is incomplete", want.UniqueID())
+	}
+	if len(token) == 0 {
+		return errors.New("the request does not carry a GCE identity token")
+	}
+	audience, err := gceAudience(r)
+	if err != nil {
+		return err
+	}
+	v := &identity.Verifier{
+		Issuer:   identity.GoogleIssuer,
+		Audience: audience,
+		Keys:     identity.Keys(getenv("GCE_KEYS_URL", identity.GoogleKeysURL)),
+	}
+	claims, err := v.Verify(ctx, string(token))
+	if err != nil {
+		return fmt.Errorf("GCE identity token: %v", err)
+	}
+	got := claims.Google.ComputeEngine
+	if got.InstanceID != string(want.InstanceID) || got.ProjectID != string(want.ProjectID) || got.Zone != want.ShortZone() {
+		return fmt.Errorf("GCE identity token is for instance %s/%s/%s, want %s", got.Zone, got.ProjectID, got.InstanceID, want.UniqueID())
+	}
+	return nil
+}
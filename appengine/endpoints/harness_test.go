@@ -0,0 +1,980 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/appengine/validators"
+	"github.com/google/splice/cli/gce"
+	"github.com/google/splice/models"
+	"github.com/google/splice/shared/certs"
+	"github.com/google/splice/shared/tracing"
+	"github.com/google/splice/spliced/joiner"
+	spltesting "github.com/google/splice/spliced/testing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// memBackend implements backend using an in-memory store that is shared with
+// the joiner under test.
+type memBackend struct {
+	store *spltesting.Store
+	// signatures holds the recorded request signatures, and nonces the
+	// issued challenge nonces, shared by every backend of a harness.
+	signatures *sync.Map
+	nonces     *sync.Map
+}
+
+// memTx buffers the requests written during a transaction until it is committed.
+type memTx struct {
+	store *spltesting.Store
+	puts  []models.Request
+}
+
+func (tx *memTx) Put(key *datastore.Key, src interface{}) (*datastore.PendingKey, error) {
+	tx.puts = append(tx.puts, *src.(*models.Request))
+	return nil, nil
+}
+
+func (tx *memTx) Commit() (*datastore.Commit, error) {
+	for _, req := range tx.puts {
+		tx.store.Put(req)
+	}
+	tx.puts = nil
+	return nil, nil
+}
+
+func (tx *memTx) Rollback() error {
+	tx.puts = nil
+	return nil
+}
+
+func (b *memBackend) NewTransaction(ctx context.Context) (transaction, error) {
+	return &memTx{store: b.store}, nil
+}
+
+func requestKey(reqID string) *datastore.Key {
+	return datastore.IDKey("Request", 1, datastore.NameKey("RequestID", reqID, nil))
+}
+
+func (b *memBackend) RequestsByID(ctx context.Context, reqID string, tx transaction) ([]*datastore.Key, []models.Request, error) {
+	req, ok := b.store.Get(reqID)
+	if !ok {
+		return nil, nil, nil
+	}
+	return []*datastore.Key{requestKey(reqID)}, []models.Request{req}, nil
+}
+
+func (b *memBackend) RequestsByStatus(ctx context.Context, status string) ([]*datastore.Key, []models.Request, error) {
+	var keys []*datastore.Key
+	var requests []models.Request
+	for _, req := range b.store.Requests() {
+		if req.Status == status {
+			keys = append(keys, requestKey(req.RequestID))
+			requests = append(requests, req)
+		}
+	}
+	return keys, requests, nil
+}
+
+func (b *memBackend) Joiners(ctx context.Context) ([]models.Joiner, error) {
+	return b.store.Joiners(), nil
+}
+
+func (b *memBackend) RecordSignature(ctx context.Context, digest string, expireAt time.Time) (bool, error) {
+	_, used := b.signatures.LoadOrStore(digest, expireAt)
+	return !used, nil
+}
+
+func (b *memBackend) PutNonce(ctx context.Context, nonce string, expireAt time.Time) error {
+	b.nonces.Store(nonce, expireAt)
+	return nil
+}
+
+func (b *memBackend) ConsumeNonce(ctx context.Context, nonce string, now time.Time) (bool, error) {
+	expireAt, ok := b.nonces.LoadAndDelete(nonce)
+	return ok && now.Before(expireAt.(time.Time)), nil
+}
+
+func (b *memBackend) Close() error {
+	return nil
+}
+
+// harness runs the App handlers and a joiner against a shared in-memory
+// store and queue, with an InactiveDirectory standing in for the domain.
+type harness struct {
+	t      *testing.T
+	store  *spltesting.Store
+	queue  *spltesting.Queue
+	ad     *spltesting.InactiveDirectory
+	joiner *joiner.Joiner
+	// header is sent with every request to the App, as the CLI would.
+	header http.Header
+	// host, if set, is the host requests to the App claim to be sent to,
+	// rather than example.com.
+	host string
+	// keys holds the certificates that requests were signed with, by
+	// client ID, so that their result queries are signed too.
+	keys map[string]*certs.Certificate
+	// tokens holds the retrieval tokens returned for requests, by RequestID.
+	tokens map[string]string
+}
+
+// newHarness starts a joiner configured with conf and points the App
+// handlers at it. Everything is stopped when the test completes.
+func newHarness(t *testing.T, conf joiner.Config) *harness {
+	h := &harness{
+		t:      t,
+		store:  spltesting.NewStore(),
+		queue:  spltesting.NewQueue(),
+		ad:     spltesting.NewInactiveDirectory(),
+		keys:   make(map[string]*certs.Certificate),
+		tokens: make(map[string]string),
+	}
+
+	oldLog, oldBackend, oldPublish := log, newBackend, publish
+	oldDatastore, oldPubsub, oldValidators, oldAdmin := useDatastore, usePubsub, validatorsNewAttended, isAdmin
+	t.Cleanup(func() {
+		log, newBackend, publish = oldLog, oldBackend, oldPublish
+		useDatastore, usePubsub, validatorsNewAttended, isAdmin = oldDatastore, oldPubsub, oldValidators, oldAdmin
+	})
+	logf := func(ctx context.Context, format string, args ...interface{}) { t.Logf(format, args...) }
+	log = logger{Infof: logf, Warningf: logf, Errorf: logf}
+	signatures, nonces := &sync.Map{}, &sync.Map{}
+	newBackend = func(context.Context) (backend, error) {
+		return &memBackend{store: h.store, signatures: signatures, nonces: nonces}, nil
+	}
+	publish = func(ctx context.Context, req *models.Request) error {
+		msg, err := newMessage(ctx, req)
+		if err != nil {
+			return err
+		}
+		h.queue.PublishMessage(msg.Data, msg.Attributes)
+		return nil
+	}
+	useDatastore, usePubsub = true, true
+	validatorsNewAttended = validators.New
+	isAdmin = func(context.Context) bool { return true }
+	t.Setenv("VERIFY_CERT", "false")
+
+	h.joiner = joiner.New(conf, h.ad, h.queue, h.store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- h.joiner.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		h.joiner.Shutdown()
+	})
+	return h
+}
+
+// post sends body to handler and decodes the JSON response into out.
+func (h *harness) post(handler http.Handler, body, out interface{}) {
+	h.t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		h.t.Fatalf("json.Marshal(%v) returned %v", body, err)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(b))
+	for k, v := range h.header {
+		r.Header[k] = v
+	}
+	if h.host != "" {
+		r.Host = h.host
+	}
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		h.t.Fatalf("ServeHTTP returned %d: %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		h.t.Fatalf("json.Unmarshal(%s) returned %v", w.Body, err)
+	}
+}
+
+// nonce fetches a challenge nonce, as the CLI does before each request and
+// result query.
+func (h *harness) nonce() string {
+	h.t.Helper()
+	var resp models.NonceResponse
+	h.post(ChallengeHandler{}, struct{}{}, &resp)
+	if resp.ErrorCode != server.StatusSuccess || resp.Nonce == "" {
+		h.t.Fatalf("challenge = %d %q, want a nonce", resp.ErrorCode, resp.Status)
+	}
+	return resp.Nonce
+}
+
+// request submits an attended join request and returns its ID. Requests
+// that do not already carry a nonce are given one.
+func (h *harness) request(cr models.ClientRequest) string {
+	h.t.Helper()
+	if cr.Nonce == "" {
+		cr.Nonce = h.nonce()
+	}
+	var resp models.Response
+	h.post(AttendedRequestHandler{}, cr, &resp)
+	if resp.ErrorCode != server.StatusSuccess {
+		h.t.Fatalf("request(%s) = %d %q, want success", cr.Hostname, resp.ErrorCode, resp.Status)
+	}
+	h.tokens[resp.RequestID] = resp.Token
+	return resp.RequestID
+}
+
+// result queries the result of a request once with its retrieval token,
+// signing the query if the request was signed.
+func (h *harness) result(reqID, clientID string) models.Response {
+	h.t.Helper()
+	q := models.StatusQuery{RequestID: reqID, ClientID: clientID, Token: h.tokens[reqID], Nonce: h.nonce()}
+	if cert, ok := h.keys[clientID]; ok {
+		q.Timestamp = time.Now()
+		sig, err := cert.Sign(q.SigningInput())
+		if err != nil {
+			h.t.Fatalf("Sign returned %v", err)
+		}
+		q.Signature = sig
+	}
+	return h.query(q)
+}
+
+// query sends a result query as is.
+func (h *harness) query(q models.StatusQuery) models.Response {
+	h.t.Helper()
+	var resp models.Response
+	h.post(ResultHandler(ProcessResult), q, &resp)
+	return resp
+}
+
+// awaitTimeout bounds how long the harness waits on the joiner. It only
+// runs out when a test is about to fail, so it is generous enough for slow
+// or heavily loaded machines.
+const awaitTimeout = time.Minute
+
+// eventually polls cond until it holds, and reports whether it did so
+// within awaitTimeout.
+func eventually(cond func() bool) bool {
+	deadline := time.Now().Add(awaitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// await polls for the result of a request until the joiner has finished
+// with it.
+func (h *harness) await(reqID, clientID string) models.Response {
+	h.t.Helper()
+	var resp models.Response
+	done := eventually(func() bool {
+		resp = h.result(reqID, clientID)
+		if resp.ErrorCode != server.StatusSuccess {
+			h.t.Fatalf("result(%s) = %d %q, want success", reqID, resp.ErrorCode, resp.Status)
+		}
+		return resp.Status == models.RequestStatusCompleted || resp.Status == models.RequestStatusFailed
+	})
+	if !done {
+		h.t.Fatalf("request %s was not processed within %v", reqID, awaitTimeout)
+	}
+	return resp
+}
+
+// clientCert returns a self-signed certificate for the client joining as name.
+func clientCert(t *testing.T, name string) *certs.Certificate {
+	t.Helper()
+	c := &certs.Certificate{}
+	if err := c.Generate(name, time.Now().Add(-time.Hour), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Generate(%s) returned %v", name, err)
+	}
+	return c
+}
+
+// signed returns cr with a fresh nonce, signed with the key of cert, as the
+// CLI would sign it.
+func (h *harness) signed(cert *certs.Certificate, cr models.ClientRequest) models.ClientRequest {
+	h.t.Helper()
+	cr.Nonce = h.nonce()
+	cr.Timestamp = time.Now()
+	sig, err := cert.Sign(cr.SigningInput())
+	if err != nil {
+		h.t.Fatalf("Sign returned %v", err)
+	}
+	cr.Signature = sig
+	h.keys[cr.ClientID] = cert
+	return cr
+}
+
+// decrypt recovers the join metadata from an encrypted response, as the
+// client would.
+func decrypt(t *testing.T, key *rsa.PrivateKey, resp models.Response) []byte {
+	t.Helper()
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, resp.ResponseKey, nil)
+	if err != nil {
+		t.Fatalf("rsa.DecryptOAEP returned %v", err)
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		t.Fatalf("aes.NewCipher returned %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM returned %v", err)
+	}
+	data, err := gcm.Open(nil, resp.CipherNonce, resp.ResponseData, nil)
+	if err != nil {
+		t.Fatalf("gcm.Open returned %v", err)
+	}
+	return data
+}
+
+func TestHarnessJoin(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", EncryptBlob: true, Workers: 2})
+
+	cert := clientCert(t, "splice-e2e")
+	clientID := certs.ClientID(cert.Cert.Raw)
+	reqID := h.request(h.signed(cert, models.ClientRequest{Hostname: "splice-e2e", ClientID: clientID, ClientCert: cert.Cert.Raw}))
+
+	resp := h.await(reqID, clientID)
+	if resp.Status != models.RequestStatusCompleted {
+		t.Fatalf("result(%s) = %q %q, want %q", reqID, resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+	if got := decrypt(t, cert.Key.(*rsa.PrivateKey), resp); !bytes.Equal(got, spltesting.SuccessBlob) {
+		t.Errorf("decrypted metadata = %q, want %q", got, spltesting.SuccessBlob)
+	}
+	if !h.ad.Computers["splice-e2e"] {
+		t.Errorf("splice-e2e was not joined to the domain: %v", h.ad.Computers)
+	}
+
+	// The result may only be retrieved once, and is scrubbed from the store.
+	if replay := h.result(reqID, clientID); replay.ErrorCode != server.StatusRequestResultReplay {
+		t.Errorf("second result(%s) = %d, want %d", reqID, replay.ErrorCode, server.StatusRequestResultReplay)
+	}
+	stored, _ := h.store.Get(reqID)
+	if stored.Status != models.RequestStatusReturned || stored.ResponseData != nil || stored.ResponseKey != nil {
+		t.Errorf("stored request = %q with data %q and key %q, want %q and no data", stored.Status, stored.ResponseData, stored.ResponseKey, models.RequestStatusReturned)
+	}
+	if stored.ClaimBy != "joiner1" || !stored.LeaseExpiry.IsZero() {
+		t.Errorf("stored request claimed by %q with lease until %v, want joiner1 and no lease", stored.ClaimBy, stored.LeaseExpiry)
+	}
+	if acked := h.queue.Acked(); len(acked) != 1 || acked[0] != reqID {
+		t.Errorf("acknowledged messages = %v, want [%s]", acked, reqID)
+	}
+
+	var fleet models.FleetResponse
+	h.post(FleetHandler{}, nil, &fleet)
+	if fleet.Live != 1 || len(fleet.Joiners) != 1 || fleet.Joiners[0].Instance != "joiner1" {
+		t.Errorf("fleet = %+v, want joiner1 live", fleet)
+	}
+
+	// The fleet is only listed for administrators.
+	isAdmin = func(context.Context) bool { return false }
+	fleet = models.FleetResponse{}
+	h.post(FleetHandler{}, nil, &fleet)
+	if fleet.ErrorCode != server.StatusNotAdministrator || len(fleet.Joiners) != 0 {
+		t.Errorf("fleet for a non-administrator = %d %q with %d joiners, want %d and none", fleet.ErrorCode, fleet.Status, len(fleet.Joiners), server.StatusNotAdministrator)
+	}
+}
+
+func TestHarnessReuseDenied(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+
+	first := h.request(models.ClientRequest{Hostname: "splice-dup", ClientID: "client1"})
+	if resp := h.await(first, "client1"); resp.Status != models.RequestStatusCompleted {
+		t.Fatalf("first result = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	second := h.request(models.ClientRequest{Hostname: "splice-dup", ClientID: "client2"})
+	resp := h.await(second, "client2")
+	if resp.Status != models.RequestStatusFailed || string(resp.ResponseData) != spltesting.ErrReuse.Error() {
+		t.Errorf("second result = %q %q, want %q %q", resp.Status, resp.ResponseData, models.RequestStatusFailed, spltesting.ErrReuse)
+	}
+}
+
+func TestHarnessRedelivery(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 2})
+
+	reqID := h.request(models.ClientRequest{Hostname: "splice-redo", ClientID: "client1"})
+	// Deliver the request a second time, as Pub/Sub may.
+	h.queue.Publish(reqID)
+	if resp := h.await(reqID, "client1"); resp.Status != models.RequestStatusCompleted {
+		t.Fatalf("result = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	// Both deliveries are acknowledged, but the host is only joined once.
+	eventually(func() bool { return len(h.queue.Acked()) >= 2 })
+	if acked := h.queue.Acked(); len(acked) != 2 {
+		t.Errorf("acknowledged messages = %v, want 2 deliveries of %s", acked, reqID)
+	}
+	if n := len(h.ad.Computers); n != 1 {
+		t.Errorf("joined %d computers, want 1", n)
+	}
+}
+
+func TestHarnessTracing(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+	defer otel.SetTracerProvider(old)
+
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	// The CLI sends the trace context of its own span with the request.
+	client := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{7}, SpanID: trace.SpanID{8}, TraceFlags: trace.FlagsSampled})
+	h.header = http.Header{}
+	tracing.Inject(trace.ContextWithSpanContext(context.Background(), client), propagation.HeaderCarrier(h.header))
+
+	reqID := h.request(models.ClientRequest{Hostname: "splice-trace", ClientID: "client1"})
+	h.await(reqID, "client1")
+
+	// The joiner ends its outermost span once the result is written.
+	want := map[string]bool{"ProcessRequest": true, "handleMessage": true, "claimRequest": true, "processRequest": true, "returnRequest": true}
+	deadline := time.Now().Add(awaitTimeout)
+	for {
+		got := make(map[string]bool)
+		for _, s := range exp.GetSpans() {
+			if s.SpanContext.TraceID() == client.TraceID() {
+				got[s.Name] = true
+			}
+		}
+		if len(got) == len(want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("spans in the client's trace = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHarnessApproval(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	t.Setenv("APPROVAL_REQUIRED", "host:srv-*")
+	old := currentUser
+	defer func() { currentUser = old }()
+	currentUser = func(context.Context) string { return "approver@example.com" }
+
+	// Requests that do not need approval are published as before.
+	if resp := h.await(h.request(models.ClientRequest{Hostname: "ws-1", ClientID: "client0"}), "client0"); resp.Status != models.RequestStatusCompleted {
+		t.Fatalf("result(ws-1) = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	approved := h.request(models.ClientRequest{Hostname: "srv-1", ClientID: "client1"})
+	denied := h.request(models.ClientRequest{Hostname: "srv-2", ClientID: "client2"})
+	expired := h.request(models.ClientRequest{Hostname: "srv-3", ClientID: "client3"})
+	if resp := h.result(approved, "client1"); resp.Status != models.RequestStatusPendingApproval {
+		t.Errorf("result(srv-1) = %q, want %q", resp.Status, models.RequestStatusPendingApproval)
+	}
+	if n := len(h.queue.Acked()); n != 1 {
+		t.Errorf("%d messages were processed before approval, want 1", n)
+	}
+
+	// The third request has waited too long, so it is failed rather than listed.
+	stale, _ := h.store.Get(expired)
+	stale.AcceptTime = time.Now().Add(-ApprovalTimeout - time.Minute)
+	h.store.Put(stale)
+	var list models.ApprovalsResponse
+
+	// Only administrators and the users listed in APPROVERS are approvers.
+	isAdmin = func(context.Context) bool { return false }
+	h.post(ApprovalsHandler{}, nil, &list)
+	if list.ErrorCode != server.StatusNotAdministrator {
+		t.Errorf("pending approvals for a non-approver = %d %q, want %d", list.ErrorCode, list.Status, server.StatusNotAdministrator)
+	}
+	t.Setenv("APPROVERS", "lead@example.com; Approver@Example.com")
+	h.post(ApprovalsHandler{}, nil, &list)
+	if len(list.Pending) != 2 || list.Pending[0].RequestID != approved || list.Pending[1].RequestID != denied {
+		t.Errorf("pending approvals = %+v, want srv-1 and srv-2", list.Pending)
+	}
+	if resp := h.result(expired, "client3"); resp.Status != models.RequestStatusFailed {
+		t.Errorf("result(srv-3) = %q, want %q", resp.Status, models.RequestStatusFailed)
+	}
+
+	decide := func(reqID string, approve bool, reason string) models.Response {
+		var resp models.Response
+		h.post(ApprovalHandler{}, models.ApprovalDecision{RequestID: reqID, Approve: approve, Reason: reason}, &resp)
+		return resp
+	}
+	// Nobody may decide on their own request.
+	own := h.request(models.ClientRequest{Hostname: "srv-4", ClientID: "client4"})
+	mine, _ := h.store.Get(own)
+	mine.Requester = "approver@example.com"
+	h.store.Put(mine)
+	if resp := decide(own, true, "mine"); resp.ErrorCode != server.StatusSelfApproval {
+		t.Errorf("approval of the approver's own request = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusSelfApproval)
+	}
+	t.Setenv("APPROVERS", "lead@example.com")
+	if resp := decide(approved, true, "change 1234"); resp.ErrorCode != server.StatusNotAdministrator {
+		t.Errorf("approval by a non-approver = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusNotAdministrator)
+	}
+	isAdmin = func(context.Context) bool { return true }
+
+	if resp := decide(approved, true, ""); resp.ErrorCode != server.StatusReqProcessingError {
+		t.Errorf("approval without a reason = %d, want %d", resp.ErrorCode, server.StatusReqProcessingError)
+	}
+	if resp := decide(expired, true, "late"); resp.ErrorCode != server.StatusRequestNotPending {
+		t.Errorf("approval of an expired request = %d, want %d", resp.ErrorCode, server.StatusRequestNotPending)
+	}
+	if resp := decide(approved, true, "change 1234"); resp.ErrorCode != server.StatusSuccess || resp.Status != models.RequestStatusAccepted {
+		t.Fatalf("approve(srv-1) = %d %q, want %q", resp.ErrorCode, resp.Status, models.RequestStatusAccepted)
+	}
+	if resp := decide(denied, false, "not a server"); resp.ErrorCode != server.StatusSuccess || resp.Status != models.RequestStatusFailed {
+		t.Fatalf("deny(srv-2) = %d %q, want %q", resp.ErrorCode, resp.Status, models.RequestStatusFailed)
+	}
+
+	if resp := h.await(approved, "client1"); resp.Status != models.RequestStatusCompleted {
+		t.Errorf("result(srv-1) = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+	stored, _ := h.store.Get(approved)
+	if stored.Approver != "approver@example.com" || stored.ApprovalReason != "change 1234" {
+		t.Errorf("srv-1 was approved by %q for %q, want approver@example.com for %q", stored.Approver, stored.ApprovalReason, "change 1234")
+	}
+	resp := h.await(denied, "client2")
+	if want := "denied by approver@example.com: not a server"; resp.Status != models.RequestStatusFailed || string(resp.ResponseData) != want {
+		t.Errorf("result(srv-2) = %q %q, want %q %q", resp.Status, resp.ResponseData, models.RequestStatusFailed, want)
+	}
+	if h.ad.Computers["srv-2"] || h.ad.Computers["srv-3"] || h.ad.Computers["srv-4"] {
+		t.Errorf("requests that were not approved were joined: %v", h.ad.Computers)
+	}
+}
+
+// idToken returns an ID token for email, signed by key.
+func idToken(t *testing.T, key *rsa.PrivateKey, email string) string {
+	t.Helper()
+	return signJWT(t, key, map[string]interface{}{
+		"iss":   "https://issuer.example.com",
+		"aud":   "splice-cli",
+		"email": email,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+}
+
+// signJWT returns a token carrying claims, signed with key as key1.
+func signJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("json.Marshal(%v) returned %v", v, err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	input := enc(map[string]string{"alg": "RS256", "kid": "key1"}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("rsa.SignPKCS1v15 returned %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestHarnessIdentity(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned %v", err)
+	}
+	keys := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "key1", "n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes())},
+		}})
+	}))
+	defer keys.Close()
+
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	t.Setenv("OIDC_AUDIENCE", "splice-cli")
+	t.Setenv("OIDC_ISSUER", "https://issuer.example.com")
+	t.Setenv("OIDC_KEYS_URL", keys.URL)
+	t.Setenv("ALLOWED_USERS", "user:tech@example.com=ws-*")
+
+	var resp models.Response
+	h.post(AttendedRequestHandler{}, models.ClientRequest{Hostname: "ws-1", ClientID: "client1"}, &resp)
+	if resp.ErrorCode != server.StatusInvalidIdentity {
+		t.Errorf("request without a token = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusInvalidIdentity)
+	}
+
+	h.header = http.Header{"Authorization": {"Bearer " + idToken(t, key, "tech@example.com")}}
+	resp = models.Response{}
+	h.post(AttendedRequestHandler{}, models.ClientRequest{Hostname: "srv-1", ClientID: "client1"}, &resp)
+	if resp.ErrorCode != server.StatusRequestUserError {
+		t.Errorf("request for a host the user may not join = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusRequestUserError)
+	}
+
+	reqID := h.request(models.ClientRequest{Hostname: "ws-1", ClientID: "client1"})
+	if resp := h.await(reqID, "client1"); resp.Status != models.RequestStatusCompleted {
+		t.Errorf("result(ws-1) = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+	if stored, _ := h.store.Get(reqID); stored.Requester != "tech@example.com" {
+		t.Errorf("stored requester = %q, want tech@example.com", stored.Requester)
+	}
+}
+
+func TestHarnessSignature(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	cert, other := clientCert(t, "splice-sig"), clientCert(t, "splice-other")
+	cr := models.ClientRequest{Hostname: "splice-sig", ClientID: certs.ClientID(cert.Cert.Raw), ClientCert: cert.Cert.Raw}
+
+	stale := h.signed(cert, cr)
+	stale.Timestamp = time.Now().Add(-SignatureMaxAge - time.Minute)
+	stale.Signature, _ = cert.Sign(stale.SigningInput())
+	tampered := h.signed(cert, cr)
+	tampered.Hostname = "splice-evil"
+	tests := []struct {
+		desc string
+		in   models.ClientRequest
+	}{
+		{"unsigned", cr},
+		{"stale", stale},
+		{"tampered", tampered},
+		{"other key", h.signed(other, cr)},
+	}
+	for _, tt := range tests {
+		var resp models.Response
+		h.post(AttendedRequestHandler{}, tt.in, &resp)
+		if resp.ErrorCode != server.StatusInvalidSignature {
+			t.Errorf("%s request = %d %q, want %d", tt.desc, resp.ErrorCode, resp.Status, server.StatusInvalidSignature)
+		}
+	}
+
+	// A signed request is accepted once, and rejected if it is replayed,
+	// by its nonce or, without nonces, by its signature.
+	good := h.signed(cert, cr)
+	reqID := h.request(good)
+	var replay models.Response
+	h.post(AttendedRequestHandler{}, good, &replay)
+	if replay.ErrorCode != server.StatusInvalidNonce {
+		t.Errorf("replayed request = %d %q, want %d", replay.ErrorCode, replay.Status, server.StatusInvalidNonce)
+	}
+	t.Setenv("VERIFY_NONCE", "false")
+	h.post(AttendedRequestHandler{}, good, &replay)
+	if replay.ErrorCode != server.StatusInvalidSignature {
+		t.Errorf("replayed request without nonces = %d %q, want %d", replay.ErrorCode, replay.Status, server.StatusInvalidSignature)
+	}
+	t.Setenv("VERIFY_NONCE", "true")
+	if resp := h.await(reqID, cr.ClientID); resp.Status != models.RequestStatusCompleted {
+		t.Errorf("result = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	// Verification may be disabled for clients that do not sign requests.
+	t.Setenv("VERIFY_SIGNATURE", "false")
+	h.request(models.ClientRequest{Hostname: "splice-old", ClientID: "client2", ClientCert: other.Cert.Raw})
+}
+
+func TestHarnessNonce(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	cr := models.ClientRequest{Hostname: "splice-nonce", ClientID: "client1"}
+
+	oldLifetime := NonceLifetime
+	NonceLifetime = -time.Second
+	expired := h.nonce()
+	NonceLifetime = oldLifetime
+	used := h.nonce()
+	reqID := h.request(models.ClientRequest{Hostname: "splice-nonce", ClientID: "client1", Nonce: used})
+
+	tests := []struct {
+		desc  string
+		nonce string
+	}{
+		{"missing", ""},
+		{"unknown", "bogus"},
+		{"expired", expired},
+		{"reused", used},
+	}
+	for _, tt := range tests {
+		in := cr
+		in.Nonce = tt.nonce
+		var resp models.Response
+		h.post(AttendedRequestHandler{}, in, &resp)
+		if resp.ErrorCode != server.StatusInvalidNonce {
+			t.Errorf("%s nonce request = %d %q, want %d", tt.desc, resp.ErrorCode, resp.Status, server.StatusInvalidNonce)
+		}
+		q := models.StatusQuery{RequestID: reqID, ClientID: "client1", Nonce: tt.nonce}
+		if resp := h.query(q); resp.ErrorCode != server.StatusInvalidNonce {
+			t.Errorf("%s nonce result = %d %q, want %d", tt.desc, resp.ErrorCode, resp.Status, server.StatusInvalidNonce)
+		}
+	}
+	if resp := h.await(reqID, "client1"); resp.Status != models.RequestStatusCompleted {
+		t.Errorf("result = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	// Results of signed requests are only returned to queries signed with
+	// the same key.
+	cert, other := clientCert(t, "splice-signed"), clientCert(t, "splice-other")
+	signedID := h.request(h.signed(cert, models.ClientRequest{Hostname: "splice-signed", ClientID: "client2", ClientCert: cert.Cert.Raw}))
+	q := models.StatusQuery{RequestID: signedID, ClientID: "client2", Token: h.tokens[signedID], Nonce: h.nonce()}
+	if resp := h.query(q); resp.ErrorCode != server.StatusInvalidSignature {
+		t.Errorf("unsigned result = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusInvalidSignature)
+	}
+	q = models.StatusQuery{RequestID: signedID, ClientID: "client2", Token: h.tokens[signedID], Nonce: h.nonce(), Timestamp: time.Now()}
+	q.Signature, _ = other.Sign(q.SigningInput())
+	if resp := h.query(q); resp.ErrorCode != server.StatusInvalidSignature {
+		t.Errorf("result signed with another key = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusInvalidSignature)
+	}
+	if resp := h.await(signedID, "client2"); resp.Status != models.RequestStatusCompleted {
+		t.Errorf("signed result = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	// Nonces may be disabled for clients that do not fetch them.
+	t.Setenv("VERIFY_NONCE", "false")
+	h.request(models.ClientRequest{Hostname: "splice-old", ClientID: "client3", Nonce: "ignored"})
+}
+
+func TestHarnessToken(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	reqID := h.request(models.ClientRequest{Hostname: "splice-token", ClientID: "client1"})
+	token := h.tokens[reqID]
+	if token == "" || token == reqID {
+		t.Fatalf("request returned token %q for %q, want a separate token", token, reqID)
+	}
+	stored, _ := h.store.Get(reqID)
+	if !bytes.Equal(stored.TokenHash, hashToken(token)) {
+		t.Errorf("stored TokenHash = %x, want the hash of the token", stored.TokenHash)
+	}
+
+	for _, bad := range []string{"", "bogus", reqID} {
+		q := models.StatusQuery{RequestID: reqID, ClientID: "client1", Token: bad, Nonce: h.nonce()}
+		if resp := h.query(q); resp.ErrorCode != server.StatusInvalidToken {
+			t.Errorf("result with token %q = %d %q, want %d", bad, resp.ErrorCode, resp.Status, server.StatusInvalidToken)
+		}
+	}
+	if resp := h.await(reqID, "client1"); resp.Status != models.RequestStatusCompleted {
+		t.Errorf("result = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	// Requests stored before retrieval tokens are retrieved by RequestID.
+	h.store.Put(models.Request{RequestID: "legacy", ClientID: "client2", Hostname: "splice-legacy", Status: models.RequestStatusCompleted, ResponseData: []byte("metadata")})
+	if resp := h.result("legacy", "client2"); resp.ErrorCode != server.StatusSuccess || resp.Status != models.RequestStatusCompleted {
+		t.Errorf("legacy result = %d %q %q, want %q", resp.ErrorCode, resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+}
+
+func TestHarnessBinding(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned %v", err)
+	}
+	keys := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "key1", "n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes())},
+		}})
+	}))
+	defer keys.Close()
+	t.Setenv("GCE_KEYS_URL", keys.URL)
+	t.Setenv("APP_URL", "https://example.com")
+
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+
+	// Results are only returned to the client that made the request.
+	reqID := h.request(models.ClientRequest{Hostname: "splice-bind", ClientID: "client1"})
+	if resp := h.result(reqID, "client2"); resp.ErrorCode != server.StatusInvalidClientID {
+		t.Errorf("result for another client = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusInvalidClientID)
+	}
+	if resp := h.await(reqID, "client1"); resp.Status != models.RequestStatusCompleted {
+		t.Errorf("result = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	// GCE instances prove their identity with the request, and again with
+	// each result query, with tokens minted for the APP_URL of the App.
+	token := func(instanceID, audience string) gce.Metadata {
+		md := gce.Metadata{InstanceID: []byte(instanceID), ProjectID: []byte("lab-project"), Zone: []byte("projects/1234/zones/us-west1-a"), Audience: audience}
+		md.Identity = []byte(signJWT(t, key, map[string]interface{}{
+			"iss": "https://accounts.google.com",
+			"aud": md.Audience,
+			"sub": "service-account",
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"google": map[string]interface{}{"compute_engine": map[string]string{
+				"project_id":  "lab-project",
+				"instance_id": instanceID,
+				"zone":        "us-west1-a",
+			}},
+		}))
+		return md
+	}
+	identity := func(instanceID string) gce.Metadata { return token(instanceID, "https://example.com/") }
+	unproven := identity("5678")
+	unproven.Identity = nil
+	partial := identity("5678")
+	partial.InstanceID = nil
+	var resp models.Response
+	for desc, md := range map[string]gce.Metadata{
+		"without a GCE identity": unproven,
+		"naming only a project":  {ProjectID: []byte("lab-project")},
+		"with partial metadata":  partial,
+	} {
+		h.post(AttendedRequestHandler{}, models.ClientRequest{Hostname: "splice-gce", ClientID: "client3", GCEMetadata: md, Nonce: h.nonce()}, &resp)
+		if resp.ErrorCode != server.StatusInvalidGCEmeta {
+			t.Errorf("request %s = %d %q, want %d", desc, resp.ErrorCode, resp.Status, server.StatusInvalidGCEmeta)
+		}
+	}
+
+	// The host a request claims to be sent to does not decide the audience,
+	// so a token minted for another service is turned down.
+	h.host = "other.example.net"
+	h.post(AttendedRequestHandler{}, models.ClientRequest{Hostname: "splice-gce", ClientID: "client3", GCEMetadata: token("5678", "https://other.example.net/"), Nonce: h.nonce()}, &resp)
+	if resp.ErrorCode != server.StatusInvalidGCEmeta {
+		t.Errorf("request with a token for another host = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusInvalidGCEmeta)
+	}
+	h.host = ""
+	t.Setenv("APP_URL", "")
+	h.post(AttendedRequestHandler{}, models.ClientRequest{Hostname: "splice-gce", ClientID: "client3", GCEMetadata: identity("5678"), Nonce: h.nonce()}, &resp)
+	if resp.ErrorCode != server.StatusInvalidGCEmeta {
+		t.Errorf("request without APP_URL = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusInvalidGCEmeta)
+	}
+	t.Setenv("APP_URL", "https://example.com")
+	gceID := h.request(models.ClientRequest{Hostname: "splice-gce", ClientID: "client3", GCEMetadata: identity("5678")})
+	if stored, _ := h.store.Get(gceID); !stored.GCEVerified {
+		t.Errorf("stored GCEVerified = false, want true")
+	}
+
+	query := func(md gce.Metadata) models.Response {
+		return h.query(models.StatusQuery{RequestID: gceID, ClientID: "client3", Token: h.tokens[gceID], Nonce: h.nonce(), GCEMetadata: md})
+	}
+	tests := []struct {
+		desc string
+		md   gce.Metadata
+	}{
+		{"without an identity", gce.Metadata{}},
+		{"from another instance", identity("9999")},
+	}
+	for _, tt := range tests {
+		if resp := query(tt.md); resp.ErrorCode != server.StatusInvalidGCEmeta {
+			t.Errorf("result %s = %d %q, want %d", tt.desc, resp.ErrorCode, resp.Status, server.StatusInvalidGCEmeta)
+		}
+	}
+	completed := eventually(func() bool {
+		resp = query(identity("5678"))
+		if resp.ErrorCode != server.StatusSuccess {
+			t.Fatalf("result from the instance = %d %q, want success", resp.ErrorCode, resp.Status)
+		}
+		return resp.Status == models.RequestStatusCompleted
+	})
+	if !completed {
+		t.Fatalf("result from the instance = %q %q, want %q", resp.Status, resp.ResponseData, models.RequestStatusCompleted)
+	}
+
+	// The stored metadata decides whether a token is required, so that a
+	// request cannot be stored with metadata that escapes verification. The
+	// request is only altered once the joiner is done with it.
+	stored, _ := h.store.Get(gceID)
+	stored.GCEMetadata.InstanceID = nil
+	h.store.Put(stored)
+	if resp := query(identity("5678")); resp.ErrorCode != server.StatusInvalidGCEmeta {
+		t.Errorf("result of a request with partial metadata = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusInvalidGCEmeta)
+	}
+}
+
+func TestHarnessCertVerified(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	cert := clientCert(t, "splice-cert")
+	clientID := certs.ClientID(cert.Cert.Raw)
+
+	// A certificate is only trusted once the front end has presented its
+	// fingerprint, and never while verification is disabled.
+	t.Setenv("VERIFY_CERT", "true")
+	t.Setenv("VERIFY_CERT_HEADER", "X-Client-Cert-Hash")
+	h.header = http.Header{"X-Client-Cert-Hash": {clientID}}
+	verified := h.request(h.signed(cert, models.ClientRequest{Hostname: "splice-cert", ClientID: clientID, ClientCert: cert.Cert.Raw}))
+	t.Setenv("VERIFY_CERT", "false")
+	unverified := h.request(h.signed(cert, models.ClientRequest{Hostname: "splice-cert", ClientID: clientID, ClientCert: cert.Cert.Raw}))
+
+	for reqID, want := range map[string]bool{verified: true, unverified: false} {
+		if stored, _ := h.store.Get(reqID); stored.CertVerified != want {
+			t.Errorf("request %s: stored CertVerified = %t, want %t", reqID, stored.CertVerified, want)
+		}
+	}
+}
+
+func TestHarnessEncryptionPolicy(t *testing.T) {
+	// The joiner does not require encryption, but the App does.
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	t.Setenv("ENCRYPTION_REQUIRED", "request=rsa:2048")
+
+	var resp models.Response
+	h.post(AttendedRequestHandler{}, models.ClientRequest{Hostname: "splice-plain", ClientID: "client1", Nonce: h.nonce()}, &resp)
+	if resp.ErrorCode != server.StatusRequestEncryptionError {
+		t.Errorf("request without a certificate = %d %q, want %d", resp.ErrorCode, resp.Status, server.StatusRequestEncryptionError)
+	}
+
+	cert := clientCert(t, "splice-enc")
+	clientID := certs.ClientID(cert.Cert.Raw)
+	reqID := h.request(h.signed(cert, models.ClientRequest{Hostname: "splice-enc", ClientID: clientID, ClientCert: cert.Cert.Raw}))
+	if stored, _ := h.store.Get(reqID); stored.EncryptionPolicy != "rsa:2048" {
+		t.Errorf("stored EncryptionPolicy = %q, want rsa:2048", stored.EncryptionPolicy)
+	}
+	resp = h.await(reqID, clientID)
+	if resp.Status != models.RequestStatusCompleted || resp.ResponseKey == nil {
+		t.Fatalf("result(%s) = %q with key %q, want %q and an encrypted result", reqID, resp.Status, resp.ResponseKey, models.RequestStatusCompleted)
+	}
+	if got := decrypt(t, cert.Key.(*rsa.PrivateKey), resp); !bytes.Equal(got, spltesting.SuccessBlob) {
+		t.Errorf("decrypted metadata = %q, want %q", got, spltesting.SuccessBlob)
+	}
+}
+
+func TestHarnessReleaseRenewed(t *testing.T) {
+	h := newHarness(t, joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1})
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+
+	for _, renew := range []bool{true, false} {
+		reqID := fmt.Sprintf("orphan-%t", renew)
+		h.store.Put(models.Request{RequestID: reqID, ClientID: "client1", Hostname: "splice-orphan", Status: models.RequestStatusAccepted, AcceptTime: past, ClaimBy: "joiner9", ClaimTime: past, LeaseID: "lease1", LeaseExpiry: past})
+		dc, _, err := NewClient(ctx, nil)
+		if err != nil {
+			t.Fatalf("NewClient returned %v", err)
+		}
+		if _, err := dc.Find(ctx, reqID); err != nil {
+			t.Fatalf("Find(%s) returned %v", reqID, err)
+		}
+
+		// The joiner renews its lease after the App read the request.
+		if renew {
+			renewed, _ := h.store.Get(reqID)
+			renewed.LeaseExpiry = time.Now().Add(time.Hour)
+			h.store.Put(renewed)
+		}
+		resp := releaseRequest(ctx, dc, &models.Response{ErrorCode: server.StatusSuccess, RequestID: reqID})
+		if resp.ErrorCode != server.StatusSuccess {
+			t.Errorf("releaseRequest(%s) = %d %q, want success", reqID, resp.ErrorCode, resp.Status)
+		}
+		stored, _ := h.store.Get(reqID)
+		if released := stored.ClaimBy != "joiner9"; released == renew {
+			t.Errorf("request with renewed lease %t: released = %t, want %t", renew, released, !renew)
+		}
+	}
+}
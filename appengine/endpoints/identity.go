@@ -0,0 +1,93 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"golang.org/x/net/context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/splice/appengine/identity"
+)
+
+// requesterKey is the context key of the verified identity of the user
+// making a request.
+type requesterKey struct{}
+
+// withRequester returns ctx carrying claims.
+func withRequester(ctx context.Context, claims *identity.Claims) context.Context {
+	return context.WithValue(ctx, requesterKey{}, claims)
+}
+
+// requesterFrom returns the verified identity carried by ctx, or nil if
+// there is none.
+func requesterFrom(ctx context.Context) *identity.Claims {
+	claims, _ := ctx.Value(requesterKey{}).(*identity.Claims)
+	return claims
+}
+
+// getenv returns the value of the environment variable key, or def if it
+// is unset.
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// identify returns the verified identity of the user making r. Users are
+// identified by the assertion of Identity-Aware Proxy if IAP_AUDIENCE is set,
+// or by an OpenID Connect ID token sent as a bearer token if OIDC_AUDIENCE is
+// set. identify returns nil claims and no error if neither is set, as users
+// are not identified. Otherwise, requests that carry no valid identity are
+// refused.
+func identify(ctx context.Context, r *http.Request) (*identity.Claims, error) {
+	iapAudience, oidcAudience := os.Getenv("IAP_AUDIENCE"), os.Getenv("OIDC_AUDIENCE")
+	if iapAudience == "" && oidcAudience == "" {
+		return nil, nil
+	}
+
+	if assertion := r.Header.Get(identity.IAPHeader); iapAudience != "" && assertion != "" {
+		v := &identity.Verifier{
+			Issuer:   identity.IAPIssuer,
+			Audience: iapAudience,
+			Keys:     identity.Keys(getenv("IAP_KEYS_URL", identity.IAPKeysURL)),
+		}
+		claims, err := v.Verify(ctx, assertion)
+		if err != nil {
+			return nil, fmt.Errorf("IAP assertion: %v", err)
+		}
+		return claims, nil
+	}
+
+	auth := r.Header.Get("Authorization")
+	if token := strings.TrimPrefix(auth, "Bearer "); oidcAudience != "" && token != auth {
+		v := &identity.Verifier{
+			Issuer:   getenv("OIDC_ISSUER", identity.GoogleIssuer),
+			Audience: oidcAudience,
+			Keys:     identity.Keys(getenv("OIDC_KEYS_URL", identity.GoogleKeysURL)),
+		}
+		claims, err := v.Verify(ctx, token)
+		if err != nil {
+			return nil, fmt.Errorf("ID token: %v", err)
+		}
+		return claims, nil
+	}
+
+	return nil, errors.New("the request does not carry the identity of a user")
+}
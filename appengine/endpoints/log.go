@@ -0,0 +1,36 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"golang.org/x/net/context"
+
+	aelog "google.golang.org/appengine/v2/log"
+)
+
+// logger holds the logging funcs used by the handlers.
+type logger struct {
+	Infof    func(ctx context.Context, format string, args ...interface{})
+	Warningf func(ctx context.Context, format string, args ...interface{})
+	Errorf   func(ctx context.Context, format string, args ...interface{})
+}
+
+// For easier testing, logging goes through a var, as App Engine logging
+// requires an App Engine context.
+var log = logger{
+	Infof:    aelog.Infof,
+	Warningf: aelog.Warningf,
+	Errorf:   aelog.Errorf,
+}
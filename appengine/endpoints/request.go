@@ -18,23 +18,28 @@ package endpoints
 
 import (
 	"golang.org/x/net/context"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"google.golang.org/appengine/v2"
-	"google.golang.org/appengine/v2/log"
 	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/pubsub"
 	"github.com/google/splice/appengine/server"
 	basic "github.com/google/splice/appengine/validators"
 	"github.com/google/splice/models"
+	"github.com/google/splice/shared/certs"
+	"github.com/google/splice/shared/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -54,7 +59,17 @@ func (ah AttendedRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	requestResponse(ctx, w, r, checks)
+	// Attended requests are made by a user, who must be identified if the
+	// App is configured to verify users.
+	claims, err := identify(ctx, r)
+	if err != nil {
+		resp := models.Response{ErrorCode: server.StatusInvalidIdentity, Status: err.Error()}
+		log.Warningf(ctx, "could not process request %v", resp)
+		writeResponse(ctx, w, resp)
+		return
+	}
+
+	requestResponse(withRequester(ctx, claims), w, r, checks)
 }
 
 // UnattendedRequestHandler implements http.Handler for unattended joins.
@@ -78,7 +93,11 @@ func requestResponse(ctx context.Context, w http.ResponseWriter, r *http.Request
 	if resp.ErrorCode != server.StatusSuccess {
 		log.Warningf(ctx, "could not process request %v", resp)
 	}
+	writeResponse(ctx, w, resp)
+}
 
+// writeResponse sends resp to the client.
+func writeResponse(ctx context.Context, w http.ResponseWriter, resp models.Response) {
 	jsonResponse, err := json.Marshal(resp)
 	if err != nil {
 		log.Errorf(ctx, "json.Marshal(%v) failed: %v", resp, err)
@@ -100,14 +119,26 @@ func requestResponse(ctx context.Context, w http.ResponseWriter, r *http.Request
 
 // ProcessRequest takes a models.Request that is provided by the client,
 // and validates it. A response is provided using models.Response.
-func ProcessRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, checks []basic.Validator) models.Response {
-	request, code, err := unmarshalRequest(r)
+// Processing continues the trace started by the client, if any.
+func ProcessRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, checks []basic.Validator) (resp models.Response) {
+	ctx = tracing.Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx, span := tracing.Start(ctx, "ProcessRequest", "", trace.WithSpanKind(trace.SpanKindServer))
+	defer func() {
+		var err error
+		if resp.ErrorCode != server.StatusSuccess {
+			err = fmt.Errorf("%d: %s", resp.ErrorCode, resp.Status)
+		}
+		tracing.End(span, err)
+	}()
+
+	clientRequest, code, err := unmarshalRequest(r)
 	if err != nil {
 		return models.Response{
 			ErrorCode: code,
 			Status:    err.Error(),
 		}
 	}
+	request := fromClient(clientRequest)
 
 	if err := verifyCert(ctx, request.ClientID, r); err != nil {
 		return models.Response{
@@ -115,6 +146,39 @@ func ProcessRequest(ctx context.Context, w http.ResponseWriter, r *http.Request,
 			Status:    err.Error(),
 		}
 	}
+	// The front end only vouches for the certificate whose fingerprint it
+	// presented, and not at all if verification is disabled.
+	request.CertVerified = os.Getenv("VERIFY_CERT") != "false" &&
+		len(request.ClientCert) > 0 && certs.ClientID(request.ClientCert) == request.ClientID
+
+	// Signatures are checked here, and recorded against replays once the
+	// datastore is at hand.
+	signed := signatureRequired(clientRequest.ClientCert)
+	if signed {
+		if err := verifySignature(clientRequest.ClientCert, clientRequest.SigningInput(), clientRequest.Signature, clientRequest.Timestamp, time.Now()); err != nil {
+			return models.Response{
+				ErrorCode: server.StatusInvalidSignature,
+				Status:    err.Error(),
+			}
+		}
+	}
+
+	// Instances that describe themselves must prove it, as their result
+	// is only returned to the same instance.
+	if gceRequired(request.GCEMetadata) {
+		if err := verifyInstance(ctx, r, request.GCEMetadata.Identity, request.GCEMetadata); err != nil {
+			return models.Response{
+				ErrorCode: server.StatusInvalidGCEmeta,
+				Status:    err.Error(),
+			}
+		}
+		request.GCEVerified = true
+	}
+
+	if claims := requesterFrom(ctx); claims != nil {
+		request.Requester = claims.User()
+		request.RequesterGroups = claims.Groups
+	}
 
 	// Run this request through all validators
 	for _, c := range checks {
@@ -138,10 +202,26 @@ func ProcessRequest(ctx context.Context, w http.ResponseWriter, r *http.Request,
 			Status:    fmt.Sprintf("generateReqID(%d) returned %v", reqIDLen, err),
 		}
 	}
+	// The result is retrieved with a separate token, which is returned to
+	// the client and only stored as a hash.
+	token, err := generateReqID(tokenLen)
+	if err != nil {
+		return models.Response{
+			ErrorCode: server.StatusReqProcessingError,
+			Status:    fmt.Sprintf("generateReqID(%d) returned %v", tokenLen, err),
+		}
+	}
+	request.TokenHash = hashToken(token)
+	span.SetAttributes(tracing.RequestIDKey.String(request.RequestID))
 
 	request.AcceptTime = time.Now()
 	request.ExpireAt = time.Now().Add(RequestExpiration)
-	request.Status = models.RequestStatusAccepted
+	// Requests held for approval are published once they are approved.
+	pending := request.Status == models.RequestStatusPendingApproval
+	if !pending {
+		request.Status = models.RequestStatusAccepted
+		request.Attempts = 1
+	}
 
 	// Initialize an empty datastore client at the appropriate scope.
 	dc := &Client{Req: &models.Request{}}
@@ -157,6 +237,22 @@ func ProcessRequest(ctx context.Context, w http.ResponseWriter, r *http.Request,
 		}
 		defer dc.Close()
 
+		if status, err := consumeNonce(ctx, dc, clientRequest.Nonce); err != nil {
+			return models.Response{
+				ErrorCode: status,
+				Status:    err.Error(),
+			}
+		}
+
+		if signed {
+			if err := recordSignature(ctx, dc, &clientRequest); err != nil {
+				return models.Response{
+					ErrorCode: server.StatusInvalidSignature,
+					Status:    err.Error(),
+				}
+			}
+		}
+
 		if err = dc.StartTx(ctx); err != nil {
 			return models.Response{
 				ErrorCode: server.StatusDatastoreTxCreateError,
@@ -186,8 +282,10 @@ func ProcessRequest(ctx context.Context, w http.ResponseWriter, r *http.Request,
 		}
 	}
 
-	if usePubsub {
-		if err := publishRequest(ctx, request.RequestID); err != nil {
+	if pending {
+		log.Infof(ctx, "request %q for host %q is pending approval", request.RequestID, request.Hostname)
+	} else if usePubsub {
+		if err := publish(ctx, &request); err != nil {
 			return models.Response{
 				ErrorCode: server.StatusPubsubFailure,
 				Status:    err.Error(),
@@ -196,8 +294,9 @@ func ProcessRequest(ctx context.Context, w http.ResponseWriter, r *http.Request,
 	}
 
 	return models.Response{
-		Status:    models.RequestStatusAccepted,
+		Status:    request.Status,
 		RequestID: request.RequestID,
+		Token:     token,
 		ErrorCode: server.StatusSuccess,
 	}
 }
@@ -210,7 +309,6 @@ func generateReqID(n uint) (string, error) {
 	if n <= 0 {
 		return "", fmt.Errorf("invalid length %d requested", n)
 	}
-	rand.Seed(time.Now().UnixNano())
 	b := make([]byte, n)
 	_, err := rand.Read(b)
 	if err != nil {
@@ -219,40 +317,54 @@ func generateReqID(n uint) (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
+// hashToken returns the hash of a retrieval token, as stored with the request.
+func hashToken(token string) []byte {
+	h := sha256.Sum256([]byte(token))
+	return h[:]
+}
+
 // unmarshalRequest takes a raw inbound request and returns
-// a models.Request for processing
-func unmarshalRequest(r *http.Request) (models.Request, server.StatusCode, error) {
+// the models.ClientRequest it carries.
+func unmarshalRequest(r *http.Request) (models.ClientRequest, server.StatusCode, error) {
 	var clientRequest models.ClientRequest
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return models.Request{},
+		return models.ClientRequest{},
 			server.StatusRequestUnreadable,
 			errors.New("unable to read HTTP request body")
 	}
 
 	if len(body) == 0 {
-		return models.Request{},
+		return models.ClientRequest{},
 			server.StatusJSONEmpty,
 			errors.New("empty HTTP JSON request body")
 	}
 
 	if err = json.Unmarshal(body, &clientRequest); err != nil {
-		return models.Request{},
+		return models.ClientRequest{},
 			server.StatusJSONUmarshalError,
 			errors.New("unable to unmarshal JSON request")
 	}
 
+	return clientRequest, server.StatusSuccess, nil
+}
+
+// fromClient returns a models.Request for processing the request
+// made by the client.
+func fromClient(clientRequest models.ClientRequest) models.Request {
 	return models.Request{
-			Hostname:      clientRequest.Hostname,
-			ClientID:      clientRequest.ClientID,
-			ClientCert:    clientRequest.ClientCert,
-			GCEMetadata:   clientRequest.GCEMetadata,
-			GeneratorID:   clientRequest.GeneratorID,
-			GeneratorData: clientRequest.GeneratorData,
-		},
-		server.StatusSuccess,
-		nil
+		Hostname:      clientRequest.Hostname,
+		ClientID:      clientRequest.ClientID,
+		ClientCert:    clientRequest.ClientCert,
+		GCEMetadata:   clientRequest.GCEMetadata,
+		GeneratorID:   clientRequest.GeneratorID,
+		GeneratorData: clientRequest.GeneratorData,
+		Domain:        clientRequest.Domain,
+		OU:            clientRequest.OU,
+		CertTemplate:  clientRequest.CertTemplate,
+		Policies:      clientRequest.Policies,
+	}
 }
 
 // cleanupOrphans looks for requests that are too old or were
@@ -284,6 +396,11 @@ func cleanupOrphans(ctx context.Context, dc *Client) error {
 
 		if len(requests) > 0 {
 			for i, orphan := range requests {
+				// Requests whose joiner still holds an active lease are
+				// being worked on, however old they are.
+				if orphan.ClaimBy != "" && !orphan.LeaseExpired(time.Now()) {
+					continue
+				}
 				orphan.Status = models.RequestStatusFailed
 				dc.Req = nil
 				dc.Req = &orphan
@@ -296,6 +413,11 @@ func cleanupOrphans(ctx context.Context, dc *Client) error {
 		}
 	}
 
+	// Requests nobody approved or denied in time are failed as well.
+	if _, err := expireApprovals(ctx, dc, time.Now()); err != nil {
+		return fmt.Errorf("expireApprovals returned %v", err)
+	}
+
 	if err := dc.CommitTx(); err != nil {
 		return fmt.Errorf("dc.CommitTx returned %v", err)
 	}
@@ -303,12 +425,61 @@ func cleanupOrphans(ctx context.Context, dc *Client) error {
 	return nil
 }
 
+// newMessage returns the Pub/Sub message announcing req. The message carries
+// a models.Envelope, whose routing fields are repeated in the message
+// attributes alongside the trace context of ctx.
+func newMessage(ctx context.Context, req *models.Request) (*pubsub.Message, error) {
+	env := models.Envelope{
+		Version:      models.EnvelopeVersion,
+		RequestID:    req.RequestID,
+		Domain:       req.Domain,
+		Priority:     req.Priority,
+		EnqueueTime:  time.Now().UTC(),
+		Attempt:      req.Attempts,
+		TraceContext: tracing.Attributes(ctx),
+	}
+	data, attrs, err := env.Encode()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range env.TraceContext {
+		attrs[k] = v
+	}
+	return &pubsub.Message{Data: data, Attributes: attrs}, nil
+}
+
+// topicFor returns the Pub/Sub topic requests for domain are published to.
+// DOMAIN_TOPICS is a semicolon separated list of domain=topic rules, so that
+// each domain's requests only reach the joiners serving it. Domains without a
+// rule, including the default domain, use PUBSUB_TOPIC.
+func topicFor(domain string) (string, error) {
+	for _, rule := range strings.Split(os.Getenv("DOMAIN_TOPICS"), ";") {
+		d, topic, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if ok && domain != "" && strings.EqualFold(strings.TrimSpace(d), domain) {
+			return strings.TrimSpace(topic), nil
+		}
+	}
+	if topic := os.Getenv("PUBSUB_TOPIC"); topic != "" {
+		return topic, nil
+	}
+	return "", errors.New("PUBSUB_TOPIC environment variable not set")
+}
+
 // Publishes a request to the pubsub channel.
-func publishRequest(ctx context.Context, reqID string) error {
+func publishRequest(ctx context.Context, req *models.Request) (err error) {
+	reqID := req.RequestID
+	ctx, span := tracing.Start(ctx, "publishRequest", reqID, trace.WithSpanKind(trace.SpanKindProducer))
+	defer func() { tracing.End(span, err) }()
+
+	msg, err := newMessage(ctx, req)
+	if err != nil {
+		return fmt.Errorf("newMessage(%q) returned: %v", reqID, err)
+	}
+
 	envProject := appengine.AppID(ctx)
-	envTopic := os.Getenv("PUBSUB_TOPIC")
-	if envTopic == "" {
-		return errors.New("PUBSUB_TOPIC environment variable not set")
+	envTopic, err := topicFor(req.Domain)
+	if err != nil {
+		return err
 	}
 
 	ps, err := pubsub.NewClient(ctx, envProject)
@@ -319,7 +490,7 @@ func publishRequest(ctx context.Context, reqID string) error {
 
 	topic := ps.Topic(envTopic)
 	defer topic.Stop()
-	res := topic.Publish(ctx, &pubsub.Message{Data: []byte(reqID)})
+	res := topic.Publish(ctx, msg)
 
 	msgID, err := res.Get(ctx)
 	if err != nil {
@@ -18,14 +18,15 @@ package endpoints
 
 import (
 	"golang.org/x/net/context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"time"
 
 	"google.golang.org/appengine/v2"
-	"google.golang.org/appengine/v2/log"
 	"github.com/google/splice/appengine/server"
 	"github.com/google/splice/models"
 )
@@ -112,6 +113,13 @@ func ProcessResult(w http.ResponseWriter, r *http.Request) *models.Response {
 		}
 		defer dc.Close()
 
+		if status, err := consumeNonce(ctx, dc, reqStatus.Nonce); err != nil {
+			return &models.Response{
+				ErrorCode: status,
+				Status:    err.Error(),
+			}
+		}
+
 		status, err = dc.Find(ctx, reqStatus.RequestID)
 		if err != nil && status != server.StatusDatastoreLookupNotFound {
 			return &models.Response{
@@ -126,6 +134,20 @@ func ProcessResult(w http.ResponseWriter, r *http.Request) *models.Response {
 			}
 		}
 
+		if err := verifyToken(dc.Req, reqStatus.Token); err != nil {
+			return &models.Response{
+				ErrorCode: server.StatusInvalidToken,
+				Status:    err.Error(),
+			}
+		}
+
+		if reqStatus.ClientID != dc.Req.ClientID {
+			return &models.Response{
+				ErrorCode: server.StatusInvalidClientID,
+				Status:    fmt.Sprintf("request %q was not made by client %q", dc.Req.RequestID, reqStatus.ClientID),
+			}
+		}
+
 		if err := verifyCert(ctx, dc.Req.ClientID, r); err != nil {
 			return &models.Response{
 				ErrorCode: server.StatusInvalidCertError,
@@ -133,6 +155,28 @@ func ProcessResult(w http.ResponseWriter, r *http.Request) *models.Response {
 			}
 		}
 
+		// Results of requests made by a GCE instance are only returned to
+		// the same instance, as proven by a current identity token.
+		if gceRequired(dc.Req.GCEMetadata) {
+			if err := verifyInstance(ctx, r, reqStatus.GCEMetadata.Identity, dc.Req.GCEMetadata); err != nil {
+				return &models.Response{
+					ErrorCode: server.StatusInvalidGCEmeta,
+					Status:    err.Error(),
+				}
+			}
+		}
+
+		// Queries for requests made with a client certificate must be signed
+		// with the same key, so that only the requester can retrieve the result.
+		if signatureRequired(dc.Req.ClientCert) {
+			if err := verifySignature(dc.Req.ClientCert, reqStatus.SigningInput(), reqStatus.Signature, reqStatus.Timestamp, time.Now()); err != nil {
+				return &models.Response{
+					ErrorCode: server.StatusInvalidSignature,
+					Status:    err.Error(),
+				}
+			}
+		}
+
 		if dc.Req.Status == models.RequestStatusReturned {
 			return &models.Response{
 				ErrorCode: server.StatusRequestResultReplay,
@@ -152,18 +196,40 @@ func ProcessResult(w http.ResponseWriter, r *http.Request) *models.Response {
 			CipherNonce:  dc.Req.CipherNonce,
 		}
 
+		// Requests held for approval are not published, so they cannot be
+		// orphaned. They fail once nobody has acted on them in time.
+		if dc.Req.Status == models.RequestStatusPendingApproval {
+			if !approvalExpired(dc.Req, time.Now()) {
+				return response
+			}
+			if err := dc.StartTx(ctx); err != nil {
+				return &models.Response{
+					ErrorCode: server.StatusDatastoreTxCreateError,
+					Status:    err.Error(),
+				}
+			}
+			defer dc.RollbackTx()
+			return expireRequest(ctx, dc, time.Now())
+		}
+
+		// Failed requests, including denied ones, are never republished.
+		if dc.Req.Status == models.RequestStatusFailed {
+			return response
+		}
+
 		// If the request remains outstanding, check for orphans and return status info.
 		// We don't start a transaction unless the request looks orphaned.
 		if dc.Req.Status != models.RequestStatusCompleted {
-			// Republish requests that were claimed but never completed by the joiner.
-			if time.Now().Sub(dc.Req.ClaimTime) > 300*time.Second && !dc.Req.ClaimTime.IsZero() {
-				log.Infof(ctx, "requestID '%q' will be released because it was claimed at %v by %s but has not been completed.", response.RequestID, dc.Req.ClaimTime, dc.Req.ClaimBy)
-				return releaseRequest(ctx, dc)
+			// Republish requests whose joiner stopped renewing its lease. Joiners
+			// renew leases while they work, so slow joins are left alone.
+			if dc.Req.LeaseExpired(time.Now()) {
+				log.Infof(ctx, "requestID '%q' will be released because it was claimed at %v by %s, whose lease expired at %v.", response.RequestID, dc.Req.ClaimTime, dc.Req.ClaimBy, dc.Req.LeaseExpiry)
+				return releaseRequest(ctx, dc, response)
 			}
 			// Republish requests that were never claimed by a joiner.
-			if time.Now().Sub(dc.Req.AcceptTime) > 300*time.Second && dc.Req.ClaimBy == "" {
+			if unclaimed(dc.Req, time.Now()) {
 				log.Infof(ctx, "requestID '%q' will be republished because it was accepted at %v but was never claimed.", response.RequestID, dc.Req.AcceptTime)
-				return releaseRequest(ctx, dc)
+				return releaseRequest(ctx, dc, response)
 			}
 
 			return response
@@ -206,10 +272,30 @@ func ProcessResult(w http.ResponseWriter, r *http.Request) *models.Response {
 	return response
 }
 
+// unclaimed reports whether req was accepted long enough before now that a
+// joiner should have claimed it, but none has.
+func unclaimed(req *models.Request, now time.Time) bool {
+	return req.ClaimBy == "" && now.Sub(req.AcceptTime) > 300*time.Second
+}
+
+// verifyToken returns an error if token is not the retrieval token of req.
+// The hashes are compared in constant time. Requests stored before retrieval
+// tokens were introduced carry no hash, and are retrieved by RequestID alone.
+func verifyToken(req *models.Request, token string) error {
+	if len(req.TokenHash) == 0 {
+		return nil
+	}
+	if subtle.ConstantTimeCompare(hashToken(token), req.TokenHash) != 1 {
+		return errors.New("invalid retrieval token for the request")
+	}
+	return nil
+}
+
 // releaseRequest resets a request so that it may be claimed
 // for processing by another joiner server. Released requests
-// are re-published to pubsub.
-func releaseRequest(ctx context.Context, dc *Client) *models.Response {
+// are re-published to pubsub. If the request turns out not to be
+// orphaned when it is read again, response is returned unchanged.
+func releaseRequest(ctx context.Context, dc *Client, response *models.Response) *models.Response {
 	if err := dc.StartTx(ctx); err != nil {
 		return &models.Response{
 			ErrorCode: server.StatusDatastoreTxCreateError,
@@ -218,9 +304,26 @@ func releaseRequest(ctx context.Context, dc *Client) *models.Response {
 	}
 	defer dc.RollbackTx()
 
+	// A joiner may have claimed the request or renewed its lease since it
+	// was read, so it is read again within the transaction before it is
+	// released.
+	if status, err := dc.Find(ctx, dc.Req.RequestID); err != nil || status != server.StatusSuccess {
+		return &models.Response{
+			ErrorCode: status,
+			Status:    fmt.Sprintf("re-reading request %q: %v", dc.Req.RequestID, err),
+		}
+	}
+	now := time.Now()
+	if dc.Req.Status != models.RequestStatusAccepted || !(dc.Req.LeaseExpired(now) || unclaimed(dc.Req, now)) {
+		return response
+	}
+
 	dc.Req.Status = models.RequestStatusAccepted
 	dc.Req.ClaimBy = ""
 	dc.Req.ClaimTime = time.Time{}
+	dc.Req.LeaseID = ""
+	dc.Req.LeaseExpiry = time.Time{}
+	dc.Req.Attempts++
 
 	// We could probably save and commit above, but leaving this here
 	// to make it clearer that we're re-publishing on purpose and not just
@@ -239,7 +342,7 @@ func releaseRequest(ctx context.Context, dc *Client) *models.Response {
 		}
 	}
 
-	if err := publishRequest(ctx, dc.Req.RequestID); err != nil {
+	if err := publish(ctx, dc.Req); err != nil {
 		return &models.Response{
 			ErrorCode: server.StatusPubsubFailure,
 			Status:    err.Error(),
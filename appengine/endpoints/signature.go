@@ -0,0 +1,72 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoints
+
+import (
+	"golang.org/x/net/context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/splice/models"
+	"github.com/google/splice/shared/certs"
+)
+
+var (
+	// SignatureMaxAge sets how far the signing time of a request may be from
+	// the time it is received, in either direction.
+	SignatureMaxAge = 5 * time.Minute
+)
+
+// signatureRequired reports whether requests and queries made with the
+// client certificate cert must be signed, proving that the client holds its
+// key. They must, unless the VERIFY_SIGNATURE environment variable is set to
+// false.
+func signatureRequired(cert []byte) bool {
+	return len(cert) > 0 && os.Getenv("VERIFY_SIGNATURE") != "false"
+}
+
+// verifySignature returns an error if sig is not a signature of input by the
+// key of cert, or ts, the time it was made, is not within SignatureMaxAge of
+// now.
+func verifySignature(cert, input, sig []byte, ts, now time.Time) error {
+	if len(sig) == 0 {
+		return errors.New("a client certificate was presented, but the request is not signed")
+	}
+	if age := now.Sub(ts); age > SignatureMaxAge || age < -SignatureMaxAge {
+		return fmt.Errorf("the request was signed at %v, which is more than %v from now", ts, SignatureMaxAge)
+	}
+	if err := certs.VerifySignature(cert, input, sig); err != nil {
+		return fmt.Errorf("request signature: %v", err)
+	}
+	return nil
+}
+
+// recordSignature returns an error if the signature of cr has already been
+// used. Signatures are recorded until they would be rejected as stale.
+func recordSignature(ctx context.Context, dc *Client, cr *models.ClientRequest) error {
+	digest := sha256.Sum256(cr.Signature)
+	fresh, err := dc.RecordSignature(ctx, hex.EncodeToString(digest[:]), cr.Timestamp.Add(SignatureMaxAge))
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return errors.New("the request signature has already been used")
+	}
+	return nil
+}
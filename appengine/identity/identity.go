@@ -0,0 +1,232 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package identity verifies the signed JSON Web Tokens that identify the user
+// or machine making a request to Splice App, such as Identity-Aware Proxy
+// assertions, OpenID Connect ID tokens and GCE instance identity tokens.
+package identity
+
+import (
+	"golang.org/x/net/context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	// IAPHeader carries the assertion Identity-Aware Proxy signs for each
+	// request it lets through.
+	IAPHeader = "X-Goog-IAP-JWT-Assertion"
+	// IAPIssuer is the issuer of IAP assertions.
+	IAPIssuer = "https://cloud.google.com/iap"
+	// IAPKeysURL serves the keys IAP signs assertions with.
+	IAPKeysURL = "https://www.gstatic.com/iap/verify/public_key-jwk"
+	// GoogleIssuer is the issuer of Google ID tokens.
+	GoogleIssuer = "https://accounts.google.com"
+	// GoogleKeysURL serves the keys Google signs ID tokens with.
+	GoogleKeysURL = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+// clockSkew is how far the clocks of the issuer and the App may differ.
+const clockSkew = time.Minute
+
+// Claims holds the claims of a verified token that identify its subject.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Expiry    int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	NotBefore int64    `json:"nbf"`
+	Email     string   `json:"email"`
+	// EmailVerified is false only if the issuer says the email address was
+	// not verified. Some issuers encode it as a string.
+	EmailVerified interface{} `json:"email_verified"`
+	// Groups lists the groups of the subject, for issuers that include
+	// them.
+	Groups []string `json:"groups"`
+	// Google holds the claims Google adds to the identity tokens of GCE
+	// instances requested with format=full.
+	Google struct {
+		ComputeEngine ComputeEngine `json:"compute_engine"`
+	} `json:"google"`
+}
+
+// ComputeEngine describes the GCE instance that requested an identity token.
+type ComputeEngine struct {
+	ProjectID    string `json:"project_id"`
+	InstanceID   string `json:"instance_id"`
+	InstanceName string `json:"instance_name"`
+	// Zone is the short name of the zone of the instance, e.g. us-west1-a.
+	Zone string `json:"zone"`
+}
+
+// User returns the email address of the subject, or its subject identifier
+// if the token carries no email address.
+func (c *Claims) User() string {
+	if c.Email != "" {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// audience is the aud claim, which may be a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("aud is neither a string nor a list of strings: %v", err)
+	}
+	*a = many
+	return nil
+}
+
+// Verifier verifies tokens signed by an issuer for an audience.
+type Verifier struct {
+	// Issuer must match the iss claim of tokens. An https issuer also
+	// matches its host name alone, which Google uses in some ID tokens.
+	Issuer string
+	// Audience must be listed in the aud claim of tokens.
+	Audience string
+	// Keys holds the keys of the issuer.
+	Keys *KeySet
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// header is the JOSE header of a token.
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verify checks the signature and claims of token, and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a signed JWT")
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("token header: %v", err)
+	}
+	if h.Algorithm != "RS256" && h.Algorithm != "ES256" {
+		return nil, fmt.Errorf("token is signed with unsupported algorithm %q", h.Algorithm)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("token signature: %v", err)
+	}
+	key, err := v.Keys.Key(ctx, h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(h.Algorithm, key, digest[:], sig); err != nil {
+		return nil, err
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("token claims: %v", err)
+	}
+	if err := v.check(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// check returns an error if the claims c are not acceptable to v.
+func (v *Verifier) check(c *Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	switch {
+	case c.Issuer != v.Issuer && "https://"+c.Issuer != v.Issuer:
+		return fmt.Errorf("token was issued by %q, want %q", c.Issuer, v.Issuer)
+	case !c.Audience.contains(v.Audience):
+		return fmt.Errorf("token is for %q, want %q", c.Audience, v.Audience)
+	case c.Expiry == 0 || now.Add(-clockSkew).After(time.Unix(c.Expiry, 0)):
+		return errors.New("token has expired")
+	case c.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)):
+		return errors.New("token was issued in the future")
+	case c.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(c.NotBefore, 0)):
+		return errors.New("token is not valid yet")
+	case c.EmailVerified == false || c.EmailVerified == "false":
+		return fmt.Errorf("email address %q is not verified", c.Email)
+	case c.User() == "":
+		return errors.New("token does not identify a user")
+	}
+	return nil
+}
+
+func (a audience) contains(want string) bool {
+	for _, aud := range a {
+		if aud == want {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token into v.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifySignature checks the signature sig over digest using the algorithm
+// alg, which must be RS256 or ES256.
+func verifySignature(alg string, key crypto.PublicKey, digest, sig []byte) error {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 token signed with a key that is not an RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("token signature is invalid: %v", err)
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return errors.New("ES256 token signed with a key that is not a P-256 key")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("token signature is invalid")
+		}
+	default:
+		return fmt.Errorf("token is signed with unsupported algorithm %q", alg)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"golang.org/x/net/context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// issuer signs tokens and serves its public keys as a JSON Web Key Set.
+type issuer struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu      sync.Mutex
+	kids    []string
+	fetches int
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned %v", err)
+	}
+	iss := &issuer{rsaKey: rsaKey, ecKey: ecKey, kids: []string{"rsa1", "ec1"}}
+	iss.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.fetches++
+		enc := base64.RawURLEncoding.EncodeToString
+		var keys []map[string]string
+		for _, kid := range iss.kids {
+			if strings.HasPrefix(kid, "rsa") {
+				keys = append(keys, map[string]string{"kty": "RSA", "kid": kid, "n": enc(rsaKey.N.Bytes()), "e": enc(big.NewInt(int64(rsaKey.E)).Bytes())})
+			} else {
+				keys = append(keys, map[string]string{"kty": "EC", "crv": "P-256", "kid": kid, "x": enc(ecKey.X.FillBytes(make([]byte, 32))), "y": enc(ecKey.Y.FillBytes(make([]byte, 32)))})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// sign returns a token carrying claims, signed with alg by the key kid.
+func (iss *issuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("json.Marshal(%v) returned %v", v, err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	input := enc(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	}
+	if err != nil {
+		t.Fatalf("signing with %s returned %v", alg, err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	iss := newIssuer(t)
+	now := time.Now()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   "https://issuer.example.com",
+			"aud":   "splice-cli",
+			"sub":   "1234",
+			"email": "tech@example.com",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	tamper := func(token string) string {
+		return token[:len(token)-4] + "AAAA"
+	}
+
+	tests := []struct {
+		desc  string
+		token string
+		want  string
+	}{
+		{"RS256", iss.sign(t, "RS256", "rsa1", claims(nil)), ""},
+		{"ES256", iss.sign(t, "ES256", "ec1", claims(nil)), ""},
+		{"Audience List", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"aud": []string{"other", "splice-cli"}})), ""},
+		{"Issuer Without Scheme", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"iss": "issuer.example.com"})), ""},
+		{"Wrong Issuer", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"iss": "https://evil.example.com"})), "issued by"},
+		{"Wrong Audience", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"aud": "other"})), "is for"},
+		{"Expired", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})), "expired"},
+		{"Not Yet Valid", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})), "not valid yet"},
+		{"Unverified Email", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"email_verified": false})), "not verified"},
+		{"Unverified Email String", iss.sign(t, "RS256", "rsa1", claims(map[string]interface{}{"email_verified": "false"})), "not verified"},
+		{"Bad Signature", tamper(iss.sign(t, "RS256", "rsa1", claims(nil))), "signature"},
+		{"Bad EC Signature", tamper(iss.sign(t, "ES256", "ec1", claims(nil))), "signature"},
+		{"Key Mismatch", iss.sign(t, "RS256", "ec1", claims(nil)), "not an RSA key"},
+		{"Unknown Key", iss.sign(t, "RS256", "rsa9", claims(nil)), "not in"},
+		{"Unsigned", "e30.e30.", "unsupported"},
+		{"Not A JWT", "opaque-access-token", "not a signed JWT"},
+	}
+	v := &Verifier{Issuer: "https://issuer.example.com", Audience: "splice-cli", Keys: &KeySet{URL: iss.URL}}
+	for _, tt := range tests {
+		c, err := v.Verify(context.Background(), tt.token)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("Verify(%s) returned %v", tt.desc, err)
+		case tt.want == "" && c.User() != "tech@example.com":
+			t.Errorf("Verify(%s).User() = %q, want tech@example.com", tt.desc, c.User())
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("Verify(%s) returned %v, want an error containing %q", tt.desc, err, tt.want)
+		}
+	}
+}
+
+func TestComputeEngine(t *testing.T) {
+	iss := newIssuer(t)
+	token := iss.sign(t, "RS256", "rsa1", map[string]interface{}{
+		"iss": "https://accounts.google.com",
+		"aud": "https://splice.example.com/result-unattended",
+		"sub": "1234",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"google": map[string]interface{}{"compute_engine": map[string]string{
+			"project_id":  "lab-project",
+			"instance_id": "5678",
+			"zone":        "us-west1-a",
+		}},
+	})
+	v := &Verifier{Issuer: GoogleIssuer, Audience: "https://splice.example.com/result-unattended", Keys: &KeySet{URL: iss.URL}}
+	c, err := v.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Verify returned %v", err)
+	}
+	want := ComputeEngine{ProjectID: "lab-project", InstanceID: "5678", Zone: "us-west1-a"}
+	if c.Google.ComputeEngine != want {
+		t.Errorf("Verify().Google.ComputeEngine = %+v, want %+v", c.Google.ComputeEngine, want)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldLifetime, oldRefresh := KeysLifetime, KeysMinRefresh
+	defer func() { KeysLifetime, KeysMinRefresh = oldLifetime, oldRefresh }()
+	KeysLifetime, KeysMinRefresh = time.Hour, time.Hour
+
+	iss := newIssuer(t)
+	iss.kids = []string{"rsa1"}
+	ks := &KeySet{URL: iss.URL}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := ks.Key(ctx, "rsa1"); err != nil {
+			t.Fatalf("Key(rsa1) returned %v", err)
+		}
+	}
+	if iss.fetches != 1 {
+		t.Errorf("the key set was fetched %d times, want 1", iss.fetches)
+	}
+
+	// A new key is only looked for once KeysMinRefresh has passed.
+	iss.mu.Lock()
+	iss.kids = []string{"rsa2"}
+	iss.mu.Unlock()
+	if _, err := ks.Key(ctx, "rsa2"); err == nil {
+		t.Errorf("Key(rsa2) succeeded before the key set was refreshed")
+	}
+	KeysMinRefresh = 0
+	if _, err := ks.Key(ctx, "rsa2"); err != nil {
+		t.Errorf("Key(rsa2) returned %v after the key set was refreshed", err)
+	}
+	if iss.fetches != 2 {
+		t.Errorf("the key set was fetched %d times, want 2", iss.fetches)
+	}
+}
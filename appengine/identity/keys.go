@@ -0,0 +1,176 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"golang.org/x/net/context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// KeysLifetime sets how long fetched keys are used before they are
+	// fetched again, so that rotated keys are picked up.
+	KeysLifetime = time.Hour
+	// KeysMinRefresh sets how often keys may be fetched again to look for a
+	// key that was not found.
+	KeysMinRefresh = time.Minute
+)
+
+// KeySet holds the public keys of an issuer, published as a JSON Web Key Set.
+type KeySet struct {
+	// URL serves the key set.
+	URL string
+	// Client fetches the key set. It defaults to http.DefaultClient.
+	Client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+var (
+	keySetsMu sync.Mutex
+	keySets   = make(map[string]*KeySet)
+)
+
+// Keys returns the key set served at url, shared by every caller so that
+// keys are only fetched as they expire.
+func Keys(url string) *KeySet {
+	keySetsMu.Lock()
+	defer keySetsMu.Unlock()
+	ks, ok := keySets[url]
+	if !ok {
+		ks = &KeySet{URL: url}
+		keySets[url] = ks
+	}
+	return ks
+}
+
+// Key returns the key identified by kid. The key set is fetched if it has
+// expired, or if kid is unknown and the set was not fetched recently.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[kid]
+	age := time.Since(ks.fetched)
+	switch {
+	case ok && age < KeysLifetime:
+		return key, nil
+	case !ok && age < KeysMinRefresh:
+		return nil, fmt.Errorf("key %q is not in %s", kid, ks.URL)
+	}
+
+	keys, err := ks.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ks.keys, ks.fetched = keys, time.Now()
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("key %q is not in %s", kid, ks.URL)
+	}
+	return key, nil
+}
+
+// jwk is a JSON Web Key holding an RSA or P-256 public key.
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// fetch retrieves and parses the key set. Keys of unsupported types are
+// skipped.
+func (ks *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if ks.URL == "" {
+		return nil, fmt.Errorf("no key set is configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", ks.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error composing key set request: %v", err)
+	}
+	client := ks.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %v", ks.URL, err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", ks.URL, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", ks.URL, res.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %v", ks.URL, err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if key := k.publicKey(); key != nil {
+			keys[k.KeyID] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the public key held by k, or nil if k is malformed or
+// holds a key of an unsupported type.
+func (k jwk) publicKey() crypto.PublicKey {
+	switch {
+	case k.KeyType == "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case k.KeyType == "EC" && k.Curve == "P-256":
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil
+		}
+		// Reject points that are not on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	}
+	return nil
+}
@@ -35,6 +35,14 @@ const (
 	StatusReqProcessingError
 	StatusInvalidCertError
 	StatusInvalidGCEmeta
+	StatusRequestNotPending
+	StatusInvalidIdentity
+	StatusInvalidSignature
+	StatusInvalidNonce
+	StatusInvalidToken
+	StatusInvalidClientID
+	StatusNotAdministrator
+	StatusSelfApproval
 )
 
 // Default validator messages
@@ -44,6 +52,11 @@ const (
 	StatusRequestClientIDBlank
 	StatusRequestResultReplay
 	StatusRequestGeneratorError
+	StatusRequestDomainError
+	StatusRequestOUError
+	StatusRequestPackageError
+	StatusRequestUserError
+	StatusRequestEncryptionError
 )
 
 // Dependency validator messages
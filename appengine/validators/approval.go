@@ -0,0 +1,115 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/cli/gce"
+	"github.com/google/splice/models"
+)
+
+const (
+	// hostPrefix marks an approval subject matched against the hostname of
+	// a request.
+	hostPrefix = "host:"
+	// ouPrefix marks an approval subject matched against the OU a request
+	// names.
+	ouPrefix = "ou:"
+)
+
+// Approval implements Validator and holds requests for an administrator to
+// approve before they are published to the joiners. The requests needing
+// approval are listed in the APPROVAL_REQUIRED environment variable, a
+// semicolon separated list of subjects such as
+// "endpoint:request;host:srv-*;ou:OU=Servers,DC=example,DC=com":
+//
+//	endpoint:<name>    requests received on the endpoint, such as "request"
+//	host:<pattern>     requests for a hostname matching pattern
+//	ou:<dn>            requests naming the OU, or an OU beneath it
+//	gce:<pattern>      GCE instances in a project matching pattern
+//	issuer:<pattern>   requests whose client certificate was issued by a CA
+//	                   whose common name matches pattern
+//
+// Patterns use the syntax of path.Match and are compared without regard to
+// case. Requests matching any subject are given the status
+// RequestStatusPendingApproval. Subjects fail closed: hostnames chosen by a
+// generator are not known to the App, so host subjects match every generated
+// name, and gce and issuer subjects match every request carrying GCE metadata
+// or a client certificate the App could not verify.
+type Approval struct {
+	// Endpoint names the endpoint the request was received on.
+	Endpoint string
+}
+
+// Check marks req as pending approval if it matches a subject in
+// APPROVAL_REQUIRED.
+func (a Approval) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	raw := os.Getenv("APPROVAL_REQUIRED")
+	if raw == "" {
+		return server.StatusSuccess, nil
+	}
+	for _, subject := range strings.Split(raw, ";") {
+		subject = strings.TrimSpace(subject)
+		if subject == "" {
+			continue
+		}
+		match, err := a.matches(req, subject)
+		if err != nil {
+			return server.StatusReqProcessingError, fmt.Errorf("APPROVAL_REQUIRED: %v", err)
+		}
+		if match {
+			req.Status = models.RequestStatusPendingApproval
+			return server.StatusSuccess, nil
+		}
+	}
+	return server.StatusSuccess, nil
+}
+
+// matches reports whether the approval subject matches req.
+func (a Approval) matches(req *models.Request, subject string) (bool, error) {
+	lower := strings.ToLower(subject)
+	switch {
+	case strings.HasPrefix(lower, hostPrefix):
+		if req.Hostname == "" {
+			return req.GeneratorID != "", nil
+		}
+		pattern := strings.TrimPrefix(lower, hostPrefix)
+		match, err := path.Match(pattern, strings.ToLower(req.Hostname))
+		if err != nil {
+			return false, fmt.Errorf("pattern %q: %v", pattern, err)
+		}
+		return match, nil
+	case strings.HasPrefix(lower, ouPrefix):
+		return req.OU != "" && withinOU(req.OU, subject[len(ouPrefix):]), nil
+	case strings.HasPrefix(lower, gcePrefix) && !req.GCEVerified && hasGCEMetadata(req.GCEMetadata):
+		return true, nil
+	case strings.HasPrefix(lower, issuerPrefix) && !req.CertVerified && len(req.ClientCert) > 0:
+		return true, nil
+	case strings.HasPrefix(lower, endpointPrefix), strings.HasPrefix(lower, gcePrefix), strings.HasPrefix(lower, issuerPrefix):
+		return OU{Endpoint: a.Endpoint}.matches(req, subject)
+	}
+	return false, fmt.Errorf("subject %q is not an endpoint, host, ou, gce or issuer subject", subject)
+}
+
+// hasGCEMetadata reports whether md describes a GCE instance at all.
+func hasGCEMetadata(md gce.Metadata) bool {
+	return len(md.InstanceID) > 0 || len(md.ProjectID) > 0 || len(md.Zone) > 0 || len(md.Identity) > 0
+}
@@ -0,0 +1,62 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"testing"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/cli/gce"
+	"github.com/google/splice/models"
+)
+
+func TestApproval(t *testing.T) {
+	const subjects = "endpoint:request-unattended; host:SRV-*;ou:OU=Servers,DC=example,DC=com;gce:prod-*;"
+	tests := []struct {
+		name     string
+		subjects string
+		endpoint string
+		in       models.Request
+		want     server.StatusCode
+		pending  bool
+	}{
+		{"Not Configured", "", "request-unattended", models.Request{Hostname: "srv-1"}, server.StatusSuccess, false},
+		{"Endpoint", subjects, "request-unattended", models.Request{Hostname: "host1"}, server.StatusSuccess, true},
+		{"Other Endpoint", subjects, "request", models.Request{Hostname: "host1"}, server.StatusSuccess, false},
+		{"Host", subjects, "request", models.Request{Hostname: "srv-1"}, server.StatusSuccess, true},
+		{"Generated Name", subjects, "request", models.Request{GeneratorID: "prefix"}, server.StatusSuccess, true},
+		{"Generated Name Without Host Subjects", "endpoint:request-unattended", "request", models.Request{GeneratorID: "prefix"}, server.StatusSuccess, false},
+		{"OU", subjects, "request", models.Request{Hostname: "host1", OU: "OU=Web, OU=Servers, DC=example, DC=com"}, server.StatusSuccess, true},
+		{"Other OU", subjects, "request", models.Request{Hostname: "host1", OU: "OU=Lab,DC=example,DC=com"}, server.StatusSuccess, false},
+		{"Project", subjects, "request", models.Request{GeneratorID: "prefix", GCEMetadata: gce.Metadata{ProjectID: []byte("prod-web")}, GCEVerified: true}, server.StatusSuccess, true},
+		{"Unverified Project", "gce:prod-*", "request", models.Request{Hostname: "host1", GCEMetadata: gce.Metadata{ProjectID: []byte("lab-web")}}, server.StatusSuccess, true},
+		{"Other Project", "gce:prod-*", "request", models.Request{Hostname: "host1", GCEMetadata: gce.Metadata{ProjectID: []byte("lab-web")}, GCEVerified: true}, server.StatusSuccess, false},
+		{"Unverified Certificate", "issuer:corp-*", "request", models.Request{Hostname: "host1", ClientCert: []byte("cert")}, server.StatusSuccess, true},
+		{"No Certificate", "issuer:corp-*", "request", models.Request{Hostname: "host1"}, server.StatusSuccess, false},
+		{"Unknown Subject", "name:srv-*", "request", models.Request{Hostname: "srv-1"}, server.StatusReqProcessingError, false},
+		{"Bad Pattern", "host:[", "request", models.Request{Hostname: "srv-1"}, server.StatusReqProcessingError, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("APPROVAL_REQUIRED", tt.subjects)
+		status, err := Approval{Endpoint: tt.endpoint}.Check(context.Background(), &tt.in)
+		if status != tt.want {
+			t.Errorf("test %q: got status %d (%v), want %d", tt.name, status, err, tt.want)
+		}
+		if pending := tt.in.Status == models.RequestStatusPendingApproval; pending != tt.pending {
+			t.Errorf("test %q: got status %q, want pending %t", tt.name, tt.in.Status, tt.pending)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+// gcePrefix marks a requester pattern matched against the GCE project of an
+// unattended request, rather than its hostname.
+const gcePrefix = "gce:"
+
+// Domain implements Validator and checks that the requester may join the
+// domain it asked for. The domains offered by the deployment are listed in
+// the DOMAINS environment variable, a comma separated list such as
+// "corp.example.com,lab.example.com=lab-*|gce:lab-project". The first domain
+// is the default, used for requests that do not name one. A domain followed
+// by requester patterns may only be joined by hosts whose name matches one of
+// them, or, for patterns starting with "gce:", by GCE instances in a matching
+// project whose identity the App verified. Patterns use the syntax of
+// path.Match and are compared without regard to case. If DOMAINS is unset,
+// requests may not name a domain.
+type Domain struct{}
+
+// Check sets the domain of req to the canonical name of the domain it asked
+// for, or to the default domain.
+func (Domain) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	raw := os.Getenv("DOMAINS")
+	if raw == "" {
+		if req.Domain != "" {
+			return server.StatusRequestDomainError, fmt.Errorf("domain %s was requested, but this deployment serves a single domain", req.Domain)
+		}
+		return server.StatusSuccess, nil
+	}
+
+	for i, entry := range strings.Split(raw, ",") {
+		name, patterns, restricted := strings.Cut(strings.TrimSpace(entry), "=")
+		if name == "" {
+			return server.StatusReqProcessingError, fmt.Errorf("DOMAINS: entry %q does not name a domain", entry)
+		}
+		if !strings.EqualFold(name, req.Domain) && (req.Domain != "" || i > 0) {
+			continue
+		}
+		if restricted {
+			ok, err := allowed(req, strings.Split(patterns, "|"))
+			if err != nil {
+				return server.StatusReqProcessingError, fmt.Errorf("DOMAINS: %s: %v", name, err)
+			}
+			if !ok {
+				return server.StatusRequestDomainError, fmt.Errorf("host %q is not allowed to join domain %s", req.Hostname, name)
+			}
+		}
+		req.Domain = name
+		return server.StatusSuccess, nil
+	}
+	return server.StatusRequestDomainError, fmt.Errorf("domain %s is not served by this deployment", req.Domain)
+}
+
+// allowed reports whether the requester of req matches any of patterns.
+func allowed(req *models.Request, patterns []string) (bool, error) {
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		subject := strings.ToLower(req.Hostname)
+		if strings.HasPrefix(p, gcePrefix) {
+			// The project is only known if the App verified it.
+			if !req.GCEVerified {
+				continue
+			}
+			p = strings.TrimPrefix(p, gcePrefix)
+			subject = strings.ToLower(string(req.GCEMetadata.ProjectID))
+		}
+		if subject == "" {
+			continue
+		}
+		match, err := path.Match(p, subject)
+		if err != nil {
+			return false, fmt.Errorf("pattern %q: %v", p, err)
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"testing"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/cli/gce"
+	"github.com/google/splice/models"
+)
+
+func TestDomain(t *testing.T) {
+	const domains = "corp.example.com,lab.example.com=lab-*|gce:lab-project"
+	tests := []struct {
+		name    string
+		domains string
+		in      models.Request
+		want    string
+		status  server.StatusCode
+	}{
+		{"Single Domain", "", models.Request{Hostname: "host1"}, "", server.StatusSuccess},
+		{"Single Domain Named", "", models.Request{Hostname: "host1", Domain: "corp.example.com"}, "corp.example.com", server.StatusRequestDomainError},
+		{"Default Domain", domains, models.Request{Hostname: "host1"}, "corp.example.com", server.StatusSuccess},
+		{"Canonical Name", domains, models.Request{Hostname: "host1", Domain: "CORP.example.com"}, "corp.example.com", server.StatusSuccess},
+		{"Allowed Host", domains, models.Request{Hostname: "LAB-1", Domain: "lab.example.com"}, "lab.example.com", server.StatusSuccess},
+		{"Allowed Project", domains, models.Request{GeneratorID: "prefix", Domain: "lab.example.com", GCEMetadata: gce.Metadata{ProjectID: []byte("lab-project")}, GCEVerified: true}, "lab.example.com", server.StatusSuccess},
+		{"Unverified Project", domains, models.Request{GeneratorID: "prefix", Domain: "lab.example.com", GCEMetadata: gce.Metadata{ProjectID: []byte("lab-project")}}, "lab.example.com", server.StatusRequestDomainError},
+		{"Denied Host", domains, models.Request{Hostname: "host1", Domain: "lab.example.com"}, "lab.example.com", server.StatusRequestDomainError},
+		{"Unknown Domain", domains, models.Request{Hostname: "host1", Domain: "other.example.com"}, "other.example.com", server.StatusRequestDomainError},
+		{"Malformed Pattern", "corp.example.com=[", models.Request{Hostname: "host1"}, "", server.StatusReqProcessingError},
+	}
+	for _, tt := range tests {
+		t.Setenv("DOMAINS", tt.domains)
+		status, err := Domain{}.Check(context.Background(), &tt.in)
+		if status != tt.status {
+			t.Errorf("test %q: got status %d (%v), want %d", tt.name, status, err, tt.status)
+		}
+		if tt.in.Domain != tt.want {
+			t.Errorf("test %q: got domain %q, want %q", tt.name, tt.in.Domain, tt.want)
+		}
+	}
+}
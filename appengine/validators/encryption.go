@@ -0,0 +1,142 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+// Encryption implements Validator and requires the requests received on some
+// endpoints to carry a client certificate that the join metadata can be
+// encrypted to. The policy is set in the ENCRYPTION_REQUIRED environment
+// variable, a semicolon separated list of rules of the form endpoint=key|key,
+// such as "request-unattended=rsa:2048;request=rsa:3072|ec:256", where each
+// key names a key type and its minimum size in bits:
+//
+//	rsa:<bits>   an RSA key of at least bits
+//	ec:<bits>    an EC key on a NIST curve of at least bits other than P-224
+//
+// Requests received on an endpoint with a rule must carry a certificate with
+// one of the keys listed, and are given the rule as their EncryptionPolicy.
+// Requests received on other endpoints are not checked.
+type Encryption struct {
+	// Endpoint names the endpoint the request was received on.
+	Endpoint string
+}
+
+// Check returns StatusSuccess if req meets the encryption policy of the
+// endpoint, if any.
+func (e Encryption) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	raw := os.Getenv("ENCRYPTION_REQUIRED")
+	if raw == "" {
+		return server.StatusSuccess, nil
+	}
+	for _, rule := range strings.Split(raw, ";") {
+		endpoint, keys, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok {
+			if strings.TrimSpace(rule) == "" {
+				continue
+			}
+			return server.StatusReqProcessingError, fmt.Errorf("ENCRYPTION_REQUIRED: %q is not of the form endpoint=key|key", rule)
+		}
+		if !strings.EqualFold(strings.TrimSpace(endpoint), e.Endpoint) {
+			continue
+		}
+		policy, err := parsePolicy(keys)
+		if err != nil {
+			return server.StatusReqProcessingError, fmt.Errorf("ENCRYPTION_REQUIRED: %v", err)
+		}
+		if err := policy.check(req.ClientCert); err != nil {
+			return server.StatusRequestEncryptionError, err
+		}
+		req.EncryptionPolicy = policy.String()
+		return server.StatusSuccess, nil
+	}
+	return server.StatusSuccess, nil
+}
+
+// keyRequirement is a key type and its minimum size in bits.
+type keyRequirement struct {
+	kind string
+	bits int
+}
+
+// encryptionPolicy lists the keys a client certificate may carry.
+type encryptionPolicy []keyRequirement
+
+// parsePolicy parses a list of keys of the form kind:bits|kind:bits.
+func parsePolicy(keys string) (encryptionPolicy, error) {
+	var p encryptionPolicy
+	for _, key := range strings.Split(keys, "|") {
+		kind, size, _ := strings.Cut(strings.ToLower(strings.TrimSpace(key)), ":")
+		bits, err := strconv.Atoi(size)
+		if (kind != "rsa" && kind != "ec") || err != nil || bits <= 0 {
+			return nil, fmt.Errorf("key %q is not of the form rsa:<bits> or ec:<bits>", key)
+		}
+		p = append(p, keyRequirement{kind: kind, bits: bits})
+	}
+	return p, nil
+}
+
+// check returns an error unless der is a certificate with a key allowed by p.
+func (p encryptionPolicy) check(der []byte) error {
+	if len(der) == 0 {
+		return errors.New("a client certificate is required to encrypt the join metadata")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("the client certificate cannot be parsed: %v", err)
+	}
+	var kind string
+	var bits int
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		kind, bits = "rsa", pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		// SpliceD encrypts to EC keys using ECDH, which P-224 lacks.
+		if _, err := pub.ECDH(); err != nil {
+			return fmt.Errorf("the client certificate has a %s key, which the join metadata cannot be encrypted to", pub.Curve.Params().Name)
+		}
+		kind, bits = "ec", pub.Curve.Params().BitSize
+	default:
+		return fmt.Errorf("the client certificate has a %T key, want one of %s", cert.PublicKey, p)
+	}
+	for _, r := range p {
+		if r.kind == kind && bits >= r.bits {
+			return nil
+		}
+	}
+	return fmt.Errorf("the client certificate has a %d bit %s key, want one of %s", bits, kind, p)
+}
+
+// String returns p in the form it is configured in, e.g. rsa:2048|ec:256.
+func (p encryptionPolicy) String() string {
+	var keys []string
+	for _, r := range p {
+		keys = append(keys, fmt.Sprintf("%s:%d", r.kind, r.bits))
+	}
+	return strings.Join(keys, "|")
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+// certFor returns a self-signed certificate for the key priv.
+func certFor(t *testing.T, priv crypto.Signer) []byte {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "host1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, priv.Public(), priv)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate returned %v", err)
+	}
+	return der
+}
+
+func TestEncryption(t *testing.T) {
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned %v", err)
+	}
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned %v", err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned %v", err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned %v", err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned %v", err)
+	}
+
+	const policy = "request-unattended=rsa:2048|ec:256;request=RSA:3072"
+	tests := []struct {
+		name       string
+		policy     string
+		endpoint   string
+		cert       []byte
+		want       server.StatusCode
+		wantPolicy string
+	}{
+		{"No Policy", "", "request-unattended", nil, server.StatusSuccess, ""},
+		{"Endpoint Without Rule", "request-unattended=rsa:2048", "request", nil, server.StatusSuccess, ""},
+		{"RSA", policy, "request-unattended", certFor(t, rsa2048), server.StatusSuccess, "rsa:2048|ec:256"},
+		{"EC", policy, "request-unattended", certFor(t, p256), server.StatusSuccess, "rsa:2048|ec:256"},
+		{"Either RSA Size", "request-unattended=rsa:4096|rsa:2048", "request-unattended", certFor(t, rsa2048), server.StatusSuccess, "rsa:4096|rsa:2048"},
+		{"EC Curve At Minimum", "request-unattended=ec:384", "request-unattended", certFor(t, p384), server.StatusSuccess, "ec:384"},
+		{"EC Curve Too Small", "request-unattended=ec:384", "request-unattended", certFor(t, p256), server.StatusRequestEncryptionError, ""},
+		{"EC Curve Without ECDH", "request-unattended=ec:224", "request-unattended", certFor(t, p224), server.StatusRequestEncryptionError, ""},
+		{"No Certificate", policy, "request-unattended", nil, server.StatusRequestEncryptionError, ""},
+		{"Unparseable Certificate", policy, "request-unattended", []byte("not a certificate"), server.StatusRequestEncryptionError, ""},
+		{"RSA Too Small", policy, "request-unattended", certFor(t, rsa1024), server.StatusRequestEncryptionError, ""},
+		{"RSA Below Endpoint Minimum", policy, "request", certFor(t, rsa2048), server.StatusRequestEncryptionError, ""},
+		{"EC Not Allowed", policy, "request", certFor(t, p256), server.StatusRequestEncryptionError, ""},
+		{"Unsupported Key", policy, "request-unattended", certFor(t, ed), server.StatusRequestEncryptionError, ""},
+		{"Malformed Rule", "request-unattended", "request-unattended", certFor(t, rsa2048), server.StatusReqProcessingError, ""},
+		{"Malformed Key", "request-unattended=dsa:2048", "request-unattended", certFor(t, rsa2048), server.StatusReqProcessingError, ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("ENCRYPTION_REQUIRED", tt.policy)
+		req := models.Request{Hostname: "host1", ClientCert: tt.cert}
+		status, err := Encryption{Endpoint: tt.endpoint}.Check(context.Background(), &req)
+		if status != tt.want {
+			t.Errorf("test %q: got status %d (%v), want %d", tt.name, status, err, tt.want)
+		}
+		if req.EncryptionPolicy != tt.wantPolicy {
+			t.Errorf("test %q: got EncryptionPolicy %q, want %q", tt.name, req.EncryptionPolicy, tt.wantPolicy)
+		}
+	}
+}
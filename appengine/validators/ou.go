@@ -0,0 +1,145 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+const (
+	// endpointPrefix marks an OU rule applying to every request received on
+	// an endpoint.
+	endpointPrefix = "endpoint:"
+	// issuerPrefix marks an OU rule applying to requests whose client
+	// certificate was issued by a matching issuer.
+	issuerPrefix = "issuer:"
+)
+
+// OU implements Validator and checks that the requester may create its
+// machine account in the organizational unit it asked for. The OUs offered
+// by the deployment are listed in the ALLOWED_OUS environment variable, a
+// semicolon separated list of rules such as
+// "endpoint:request-unattended=OU=Servers,DC=example,DC=com|OU=Lab,DC=example,DC=com".
+// Each rule names a subject and the OUs, separated by "|", that it may use:
+//
+//	endpoint:<name>    requests received on the endpoint, such as "request"
+//	gce:<pattern>      GCE instances in a project matching pattern, as
+//	                   attested by a verified identity token
+//	issuer:<pattern>   requests whose client certificate, as vouched for by
+//	                   the front end, was issued by a CA whose common name
+//	                   matches pattern
+//
+// Patterns use the syntax of path.Match and are compared without regard to
+// case. A request may use an OU listed by any rule it matches, or an OU
+// beneath one. Requests that do not name an OU always pass, and are joined to
+// the default computers container. If ALLOWED_OUS is unset, requests may not
+// name an OU.
+type OU struct {
+	// Endpoint names the endpoint the request was received on.
+	Endpoint string
+}
+
+// Check returns StatusSuccess if req does not name an OU, or names one that
+// a rule matching req allows.
+func (o OU) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	if req.OU == "" {
+		return server.StatusSuccess, nil
+	}
+	raw := os.Getenv("ALLOWED_OUS")
+	if raw == "" {
+		return server.StatusRequestOUError, fmt.Errorf("OU %q was requested, but this deployment does not allow OUs to be selected", req.OU)
+	}
+
+	for _, rule := range strings.Split(raw, ";") {
+		subject, ous, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok {
+			return server.StatusReqProcessingError, fmt.Errorf("ALLOWED_OUS: %q is not of the form subject=ou|ou", rule)
+		}
+		match, err := o.matches(req, subject)
+		if err != nil {
+			return server.StatusReqProcessingError, fmt.Errorf("ALLOWED_OUS: %v", err)
+		}
+		if !match {
+			continue
+		}
+		for _, ou := range strings.Split(ous, "|") {
+			if withinOU(req.OU, ou) {
+				return server.StatusSuccess, nil
+			}
+		}
+	}
+	return server.StatusRequestOUError, fmt.Errorf("host %q is not allowed to use OU %q", req.Hostname, req.OU)
+}
+
+// matches reports whether the subject of an OU rule matches req.
+func (o OU) matches(req *models.Request, subject string) (bool, error) {
+	subject = strings.ToLower(strings.TrimSpace(subject))
+	var pattern, value string
+	switch {
+	case strings.HasPrefix(subject, endpointPrefix):
+		return strings.TrimPrefix(subject, endpointPrefix) == strings.ToLower(o.Endpoint), nil
+	case strings.HasPrefix(subject, gcePrefix):
+		pattern = strings.TrimPrefix(subject, gcePrefix)
+		if req.GCEVerified {
+			value = string(req.GCEMetadata.ProjectID)
+		}
+	case strings.HasPrefix(subject, issuerPrefix):
+		// Anyone can mint a certificate naming any issuer, so only one the
+		// front end has vouched for is considered.
+		pattern = strings.TrimPrefix(subject, issuerPrefix)
+		if !req.CertVerified {
+			break
+		}
+		if cert, err := x509.ParseCertificate(req.ClientCert); err == nil {
+			value = cert.Issuer.CommonName
+		}
+	default:
+		return false, fmt.Errorf("subject %q is not an endpoint, gce or issuer subject", subject)
+	}
+	if value == "" {
+		return false, nil
+	}
+	match, err := path.Match(pattern, strings.ToLower(value))
+	if err != nil {
+		return false, fmt.Errorf("pattern %q: %v", pattern, err)
+	}
+	return match, nil
+}
+
+// withinOU reports whether the distinguished name dn is the OU ou, or lies
+// beneath it.
+func withinOU(dn, ou string) bool {
+	dn, ou = canonicalDN(dn), canonicalDN(ou)
+	return dn == ou || strings.HasSuffix(dn, ","+ou)
+}
+
+// canonicalDN returns the distinguished name dn in lower case, with the
+// spaces around its components removed.
+func canonicalDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		k, v, _ := strings.Cut(p, "=")
+		parts[i] = strings.TrimSpace(k) + "=" + strings.TrimSpace(v)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
@@ -0,0 +1,66 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"testing"
+	"time"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/cli/gce"
+	"github.com/google/splice/models"
+	"github.com/google/splice/shared/certs"
+)
+
+func TestOU(t *testing.T) {
+	// The certificate is self-signed, so its issuer is its own subject.
+	var c certs.Certificate
+	if err := c.Generate("corp-ca", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Generate() returned %v", err)
+	}
+	const rules = "endpoint:request-unattended=OU=Servers,DC=example,DC=com;" +
+		"gce:lab-*=OU=Lab,DC=example,DC=com|OU=Kiosks,DC=example,DC=com;" +
+		"issuer:CORP-*=OU=Workstations,DC=example,DC=com"
+	tests := []struct {
+		name     string
+		rules    string
+		endpoint string
+		in       models.Request
+		want     server.StatusCode
+	}{
+		{"Default Container", "", "request", models.Request{Hostname: "host1"}, server.StatusSuccess},
+		{"Not Selectable", "", "request", models.Request{Hostname: "host1", OU: "OU=Servers,DC=example,DC=com"}, server.StatusRequestOUError},
+		{"Endpoint", rules, "request-unattended", models.Request{Hostname: "host1", OU: "ou=servers, dc=example, dc=com"}, server.StatusSuccess},
+		{"Other Endpoint", rules, "request", models.Request{Hostname: "host1", OU: "OU=Servers,DC=example,DC=com"}, server.StatusRequestOUError},
+		{"Project", rules, "request-unattended", models.Request{GeneratorID: "prefix", OU: "OU=Kiosks,DC=example,DC=com", GCEMetadata: gce.Metadata{ProjectID: []byte("lab-project")}, GCEVerified: true}, server.StatusSuccess},
+		{"Nested OU", rules, "request", models.Request{GeneratorID: "prefix", OU: "OU=Bench,OU=Lab,DC=example,DC=com", GCEMetadata: gce.Metadata{ProjectID: []byte("lab-project")}, GCEVerified: true}, server.StatusSuccess},
+		{"Other Project", rules, "request", models.Request{GeneratorID: "prefix", OU: "OU=Lab,DC=example,DC=com", GCEMetadata: gce.Metadata{ProjectID: []byte("prod")}, GCEVerified: true}, server.StatusRequestOUError},
+		{"Unverified Project", rules, "request", models.Request{GeneratorID: "prefix", OU: "OU=Lab,DC=example,DC=com", GCEMetadata: gce.Metadata{ProjectID: []byte("lab-project")}}, server.StatusRequestOUError},
+		{"Issuer", rules, "request", models.Request{Hostname: "host1", OU: "OU=Workstations,DC=example,DC=com", ClientCert: c.Cert.Raw, CertVerified: true}, server.StatusSuccess},
+		{"Unverified Issuer", rules, "request", models.Request{Hostname: "host1", OU: "OU=Workstations,DC=example,DC=com", ClientCert: c.Cert.Raw}, server.StatusRequestOUError},
+		{"No Certificate", rules, "request", models.Request{Hostname: "host1", OU: "OU=Workstations,DC=example,DC=com"}, server.StatusRequestOUError},
+		{"Similar OU", rules, "request-unattended", models.Request{Hostname: "host1", OU: "OU=OldServers,DC=example,DC=com"}, server.StatusRequestOUError},
+		{"Malformed Rule", "OU=Servers", "request", models.Request{Hostname: "host1", OU: "OU=Servers,DC=example,DC=com"}, server.StatusReqProcessingError},
+		{"Unknown Subject", "host:x=OU=Servers", "request", models.Request{Hostname: "host1", OU: "OU=Servers,DC=example,DC=com"}, server.StatusReqProcessingError},
+	}
+	for _, tt := range tests {
+		t.Setenv("ALLOWED_OUS", tt.rules)
+		status, err := OU{Endpoint: tt.endpoint}.Check(context.Background(), &tt.in)
+		if status != tt.want {
+			t.Errorf("test %q: got status %d (%v), want %d", tt.name, status, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+// Package implements Validator and checks the certificate template and group
+// policies a request selected for its provisioning package. The templates
+// and policies requests may select are listed in the CERT_TEMPLATES and
+// POLICIES environment variables, as semicolon separated lists of names
+// that are compared without regard to case. If a variable is unset, requests
+// may not select a template or policy respectively.
+type Package struct{}
+
+// Check returns StatusSuccess if every template and policy requested by req
+// is allowed.
+func (Package) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	if req.CertTemplate != "" && !listed(os.Getenv("CERT_TEMPLATES"), req.CertTemplate) {
+		return server.StatusRequestPackageError, fmt.Errorf("certificate template %q is not allowed", req.CertTemplate)
+	}
+	for _, p := range req.Policies {
+		if !listed(os.Getenv("POLICIES"), p) {
+			return server.StatusRequestPackageError, fmt.Errorf("group policy %q is not allowed", p)
+		}
+	}
+	return server.StatusSuccess, nil
+}
+
+// listed reports whether the semicolon separated list contains name, without
+// regard to case.
+func listed(list, name string) bool {
+	for _, l := range strings.Split(list, ";") {
+		if l = strings.TrimSpace(l); l != "" && strings.EqualFold(l, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"testing"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+func TestPackage(t *testing.T) {
+	const templates, policies = "Workstation; LabMachine", "Lab Policy;Kiosk Lockdown"
+	tests := []struct {
+		name      string
+		templates string
+		policies  string
+		in        models.Request
+		want      server.StatusCode
+	}{
+		{"Nothing Selected", "", "", models.Request{Hostname: "host1"}, server.StatusSuccess},
+		{"Template Not Selectable", "", policies, models.Request{Hostname: "host1", CertTemplate: "Workstation"}, server.StatusRequestPackageError},
+		{"Policy Not Selectable", templates, "", models.Request{Hostname: "host1", Policies: []string{"Lab Policy"}}, server.StatusRequestPackageError},
+		{"Allowed", templates, policies, models.Request{Hostname: "host1", CertTemplate: "labmachine", Policies: []string{"Lab Policy", "KIOSK LOCKDOWN"}}, server.StatusSuccess},
+		{"Template Not Allowed", templates, policies, models.Request{Hostname: "host1", CertTemplate: "DomainController"}, server.StatusRequestPackageError},
+		{"Policy Not Allowed", templates, policies, models.Request{Hostname: "host1", Policies: []string{"Lab Policy", "Server Baseline"}}, server.StatusRequestPackageError},
+	}
+	for _, tt := range tests {
+		t.Setenv("CERT_TEMPLATES", tt.templates)
+		t.Setenv("POLICIES", tt.policies)
+		status, err := Package{}.Check(context.Background(), &tt.in)
+		if status != tt.want {
+			t.Errorf("test %q: got status %d (%v), want %d", tt.name, status, err, tt.want)
+		}
+	}
+}
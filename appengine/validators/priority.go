@@ -0,0 +1,77 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+// Priority implements Validator and places requests in the priority lane of
+// the endpoint they were received on. Validators that run after it may move
+// a request to another lane by setting its Priority.
+type Priority struct {
+	// Lane is the priority of requests received on the endpoint.
+	Lane int
+}
+
+// Check sets the priority of req to the lane of the endpoint.
+func (p Priority) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	req.Priority = p.Lane
+	return server.StatusSuccess, nil
+}
+
+// PriorityOverride implements Validator and applies the priorities assigned
+// by administrators in the PRIORITY_OVERRIDES environment variable, a comma
+// separated list of hostname patterns and priorities such as
+// "lab-*=10,kiosk-*=0". Patterns use the syntax of path.Match and are
+// compared without regard to case. The first matching pattern wins. It must
+// run after every other validator that assigns a priority.
+type PriorityOverride struct{}
+
+// Check sets the priority of req if its hostname matches an override.
+func (PriorityOverride) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	raw := os.Getenv("PRIORITY_OVERRIDES")
+	if raw == "" || req.Hostname == "" {
+		return server.StatusSuccess, nil
+	}
+	host := strings.ToLower(req.Hostname)
+	for _, o := range strings.Split(raw, ",") {
+		pattern, value, ok := strings.Cut(strings.TrimSpace(o), "=")
+		if !ok {
+			return server.StatusReqProcessingError, fmt.Errorf("PRIORITY_OVERRIDES: %q is not of the form pattern=priority", o)
+		}
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return server.StatusReqProcessingError, fmt.Errorf("PRIORITY_OVERRIDES: %q is not an integer priority", value)
+		}
+		match, err := path.Match(strings.ToLower(pattern), host)
+		if err != nil {
+			return server.StatusReqProcessingError, fmt.Errorf("PRIORITY_OVERRIDES: pattern %q: %v", pattern, err)
+		}
+		if match {
+			req.Priority = priority
+			return server.StatusSuccess, nil
+		}
+	}
+	return server.StatusSuccess, nil
+}
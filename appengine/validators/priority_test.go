@@ -0,0 +1,60 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"testing"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+func TestPriority(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides string
+		host      string
+		lane      int
+		want      int
+		status    server.StatusCode
+	}{
+		{"Attended", "", "host1", models.PriorityAttended, models.PriorityAttended, server.StatusSuccess},
+		{"Unattended", "", "host1", models.PriorityNormal, models.PriorityNormal, server.StatusSuccess},
+		{"Override", "lab-*=20", "LAB-1", models.PriorityNormal, 20, server.StatusSuccess},
+		{"First Override Wins", "lab-1=5, lab-*=20", "lab-1", models.PriorityNormal, 5, server.StatusSuccess},
+		{"No Matching Override", "lab-*=20", "host1", models.PriorityAttended, models.PriorityAttended, server.StatusSuccess},
+		{"Demoted", "kiosk-*=-1", "kiosk-2", models.PriorityAttended, -1, server.StatusSuccess},
+		{"Malformed Override", "lab-*", "host1", models.PriorityNormal, models.PriorityNormal, server.StatusReqProcessingError},
+		{"Invalid Priority", "lab-*=high", "lab-1", models.PriorityNormal, models.PriorityNormal, server.StatusReqProcessingError},
+	}
+	for _, tt := range tests {
+		t.Setenv("PRIORITY_OVERRIDES", tt.overrides)
+		req := models.Request{Hostname: tt.host}
+		var status server.StatusCode
+		var err error
+		for _, v := range []Validator{Priority{Lane: tt.lane}, PriorityOverride{}} {
+			if status, err = v.Check(context.Background(), &req); status != server.StatusSuccess {
+				break
+			}
+		}
+		if status != tt.status {
+			t.Errorf("test %q: got status %d (%v), want %d", tt.name, status, err, tt.status)
+		}
+		if req.Priority != tt.want {
+			t.Errorf("test %q: got priority %d, want %d", tt.name, req.Priority, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+const (
+	// userPrefix marks a user rule applying to requesters whose identity
+	// matches a pattern.
+	userPrefix = "user:"
+	// groupPrefix marks a user rule applying to requesters in a group
+	// matching a pattern.
+	groupPrefix = "group:"
+)
+
+// User implements Validator and checks that the user making an attended
+// request may join the host it asked for. The hosts users may join are listed
+// in the ALLOWED_USERS environment variable, a semicolon separated list of
+// rules such as "group:lab-techs@example.com=lab-*|kiosk-*;user:*@example.com=ws-*".
+// Each rule names a subject and the hostname patterns, separated by "|", that
+// it may join:
+//
+//	user:<pattern>    requesters whose verified identity matches pattern
+//	group:<pattern>   requesters in a group matching pattern
+//
+// Patterns use the syntax of path.Match and are compared without regard to
+// case. Names chosen by a generator are not known to the App, so only the
+// pattern "*" matches them. If ALLOWED_USERS is unset, any user may join any
+// host. Otherwise, requests from unidentified users are refused.
+type User struct{}
+
+// Check returns StatusSuccess if ALLOWED_USERS is unset, or if a rule
+// matching the requester allows its hostname.
+func (User) Check(ctx context.Context, req *models.Request) (server.StatusCode, error) {
+	raw := os.Getenv("ALLOWED_USERS")
+	if raw == "" {
+		return server.StatusSuccess, nil
+	}
+	if req.Requester == "" {
+		return server.StatusRequestUserError, errors.New("ALLOWED_USERS is set, but the requester was not identified")
+	}
+
+	host := strings.ToLower(req.Hostname)
+	for _, rule := range strings.Split(raw, ";") {
+		subject, hosts, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok {
+			return server.StatusReqProcessingError, fmt.Errorf("ALLOWED_USERS: %q is not of the form subject=pattern|pattern", rule)
+		}
+		match, err := requesterMatches(req, subject)
+		if err != nil {
+			return server.StatusReqProcessingError, fmt.Errorf("ALLOWED_USERS: %v", err)
+		}
+		if !match {
+			continue
+		}
+		for _, pattern := range strings.Split(hosts, "|") {
+			ok, err := path.Match(strings.ToLower(strings.TrimSpace(pattern)), host)
+			if err != nil {
+				return server.StatusReqProcessingError, fmt.Errorf("ALLOWED_USERS: pattern %q: %v", pattern, err)
+			}
+			if ok {
+				return server.StatusSuccess, nil
+			}
+		}
+	}
+	return server.StatusRequestUserError, fmt.Errorf("user %q may not join host %q", req.Requester, req.Hostname)
+}
+
+// requesterMatches reports whether the subject of a user rule matches the
+// requester of req.
+func requesterMatches(req *models.Request, subject string) (bool, error) {
+	subject = strings.ToLower(strings.TrimSpace(subject))
+	var pattern string
+	var values []string
+	switch {
+	case strings.HasPrefix(subject, userPrefix):
+		pattern = strings.TrimPrefix(subject, userPrefix)
+		values = []string{req.Requester}
+	case strings.HasPrefix(subject, groupPrefix):
+		pattern = strings.TrimPrefix(subject, groupPrefix)
+		values = req.RequesterGroups
+	default:
+		return false, fmt.Errorf("subject %q is not a user or group subject", subject)
+	}
+	for _, v := range values {
+		match, err := path.Match(pattern, strings.ToLower(v))
+		if err != nil {
+			return false, fmt.Errorf("pattern %q: %v", pattern, err)
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"golang.org/x/net/context"
+	"testing"
+
+	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/models"
+)
+
+func TestUser(t *testing.T) {
+	const rules = "group:Lab-Techs@example.com=lab-*|kiosk-*;user:*@example.com=ws-*;user:admin@example.com=*"
+	tests := []struct {
+		name  string
+		rules string
+		in    models.Request
+		want  server.StatusCode
+	}{
+		{"Not Configured", "", models.Request{Hostname: "srv-1"}, server.StatusSuccess},
+		{"Unidentified", rules, models.Request{Hostname: "ws-1"}, server.StatusRequestUserError},
+		{"User", rules, models.Request{Hostname: "WS-1", Requester: "tech@example.com"}, server.StatusSuccess},
+		{"Other Domain", rules, models.Request{Hostname: "ws-1", Requester: "tech@example.org"}, server.StatusRequestUserError},
+		{"Group", rules, models.Request{Hostname: "kiosk-1", Requester: "tech@example.org", RequesterGroups: []string{"staff@example.com", "lab-techs@example.com"}}, server.StatusSuccess},
+		{"Group Other Host", rules, models.Request{Hostname: "srv-1", Requester: "tech@example.org", RequesterGroups: []string{"lab-techs@example.com"}}, server.StatusRequestUserError},
+		{"Generated Name", rules, models.Request{GeneratorID: "prefix", Requester: "tech@example.com"}, server.StatusRequestUserError},
+		{"Any Host", rules, models.Request{GeneratorID: "prefix", Requester: "admin@example.com"}, server.StatusSuccess},
+		{"Malformed Rule", "user:tech@example.com", models.Request{Hostname: "ws-1", Requester: "tech@example.com"}, server.StatusReqProcessingError},
+		{"Unknown Subject", "role:admin=*", models.Request{Hostname: "ws-1", Requester: "tech@example.com"}, server.StatusReqProcessingError},
+	}
+	for _, tt := range tests {
+		t.Setenv("ALLOWED_USERS", tt.rules)
+		status, err := User{}.Check(context.Background(), &tt.in)
+		if status != tt.want {
+			t.Errorf("test %q: got status %d (%v), want %d", tt.name, status, err, tt.want)
+		}
+	}
+}
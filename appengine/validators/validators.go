@@ -55,22 +55,29 @@ func (d Basic) Check(ctx context.Context, req *models.Request) (server.StatusCod
 }
 
 // New returns a slice containing all basic validators for
-// interactive requests.
+// interactive requests, which are placed in the attended lane.
 func New() ([]Validator, error) {
-	return []Validator{
-		Basic{},
-		GenericGeneratorChecks{},
-		PrefixGeneratorCheck{},
-	}, nil
+	return append(newLane("request", models.PriorityAttended), User{}, PriorityOverride{}), nil
 }
 
 // NewUnattended returns a slice containing all validators required
-// for unattended requests.
+// for unattended requests, which are placed in the bulk lane.
 func NewUnattended() ([]Validator, error) {
-	v, err := New()
-	if err != nil {
-		return nil, fmt.Errorf("New() returned: %v", err)
-	}
+	return append(newLane("request-unattended", models.PriorityNormal), NewReuse(), PriorityOverride{}), nil
+}
 
-	return append(v, NewReuse()), nil
+// newLane returns the basic validators for requests received on endpoint,
+// which are placed in the lane of the given priority.
+func newLane(endpoint string, priority int) []Validator {
+	return []Validator{
+		Priority{Lane: priority},
+		Basic{},
+		Encryption{Endpoint: endpoint},
+		Domain{},
+		OU{Endpoint: endpoint},
+		Package{},
+		Approval{Endpoint: endpoint},
+		GenericGeneratorChecks{},
+		PrefixGeneratorCheck{},
+	}
 }
@@ -19,17 +19,167 @@ limitations under the License.
 package appclient
 
 import (
+	"context"
 	"crypto"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
 )
 
-// Connect performs an OAuth 2.0 authorization for the user, and returns
-// an OAuth enabled http.Client for use in subsequent API calls.
-func Connect(server string, username string) (*http.Client, error) {
-	// Connect is not yet implemented.
-	return nil, errors.New("user-based authorization is not implemented")
+// discoveryPath is appended to an issuer to locate its OpenID Connect
+// discovery document, which lists the endpoints of the issuer.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// DefaultScopes are requested when Config does not list any.
+var DefaultScopes = []string{"openid", "email"}
+
+// Config configures the OAuth 2.0 device authorization grant performed by
+// Connect.
+type Config struct {
+	// Issuer is the URL of the authorization server, such as
+	// https://accounts.google.com. Its device authorization and token
+	// endpoints are read from its discovery document.
+	Issuer string
+	// ClientID identifies Splice CLI to the authorization server.
+	ClientID string
+	// (Optional) ClientSecret is sent by issuers that require one even for
+	// clients that cannot keep it secret, such as Google.
+	ClientSecret string
+	// (Optional) Scopes lists the scopes requested. DefaultScopes are
+	// requested if it is empty.
+	Scopes []string
+	// (Optional) Username is sent to the authorization server as a login
+	// hint.
+	Username string
+	// (Optional) Prompt shows the user where to go and the code to enter to
+	// authorize the CLI. By default they are printed to standard output.
+	Prompt func(*oauth2.DeviceAuthResponse)
+}
+
+// prompt prints the verification URI and user code of da.
+func prompt(da *oauth2.DeviceAuthResponse) {
+	if da.VerificationURIComplete != "" {
+		fmt.Printf("To authorize this machine, visit %s\n", da.VerificationURIComplete)
+		return
+	}
+	fmt.Printf("To authorize this machine, visit %s and enter the code %s\n", da.VerificationURI, da.UserCode)
+}
+
+// discover returns the device authorization and token endpoints of issuer.
+func discover(ctx context.Context, issuer string) (oauth2.Endpoint, error) {
+	addr := strings.TrimSuffix(issuer, "/") + discoveryPath
+	req, err := http.NewRequestWithContext(ctx, "GET", addr, nil)
+	if err != nil {
+		return oauth2.Endpoint{}, fmt.Errorf("error composing discovery request: %v", err)
+	}
+	client := http.DefaultClient
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		client = c
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return oauth2.Endpoint{}, fmt.Errorf("error fetching %s: %v", addr, err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return oauth2.Endpoint{}, fmt.Errorf("error reading %s: %v", addr, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return oauth2.Endpoint{}, fmt.Errorf("%s returned %s: %s", addr, res.Status, body)
+	}
+
+	var doc struct {
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+		TokenEndpoint               string `json:"token_endpoint"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return oauth2.Endpoint{}, fmt.Errorf("error unmarshalling %s: %v", addr, err)
+	}
+	if doc.DeviceAuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return oauth2.Endpoint{}, fmt.Errorf("issuer %s does not support the device authorization grant", issuer)
+	}
+	return oauth2.Endpoint{
+		DeviceAuthURL: doc.DeviceAuthorizationEndpoint,
+		TokenURL:      doc.TokenEndpoint,
+	}, nil
+}
+
+// Connect performs an OAuth 2.0 device authorization grant for the user,
+// who completes it on another device, and returns an OAuth enabled
+// http.Client for use in subsequent API calls. The client attaches the
+// user's ID token, or access token if the issuer returns no ID token, to every
+// request, and refreshes it as it expires.
+// Connect blocks until the user has authorized the CLI, the grant expires, or
+// ctx is done.
+func Connect(ctx context.Context, conf Config) (*http.Client, error) {
+	if conf.Issuer == "" || conf.ClientID == "" {
+		return nil, errors.New("an issuer and client ID are required for user-based authorization")
+	}
+	endpoint, err := discover(ctx, conf.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := conf.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	oc := &oauth2.Config{
+		ClientID:     conf.ClientID,
+		ClientSecret: conf.ClientSecret,
+		Endpoint:     endpoint,
+		Scopes:       scopes,
+	}
+
+	var opts []oauth2.AuthCodeOption
+	if conf.Username != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("login_hint", conf.Username))
+	}
+	da, err := oc.DeviceAuth(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization request returned %v", err)
+	}
+	show := conf.Prompt
+	if show == nil {
+		show = prompt
+	}
+	show(da)
+
+	tok, err := oc.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return nil, fmt.Errorf("device access token request returned %v", err)
+	}
+	// The client refreshes tokens beyond the lifetime of ctx, which only
+	// bounds the authorization itself.
+	ctx = context.WithoutCancel(ctx)
+	return oauth2.NewClient(ctx, idTokenSource{oc.TokenSource(ctx, tok)}), nil
+}
+
+// idTokenSource presents the ID token issued along with each access token as
+// the bearer token, so that Splice App can verify the identity of the user.
+// Access tokens are presented if the issuer does not return ID tokens.
+type idTokenSource struct {
+	src oauth2.TokenSource
+}
+
+func (s idTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	id, ok := tok.Extra("id_token").(string)
+	if !ok || id == "" {
+		return tok, nil
+	}
+	return &oauth2.Token{AccessToken: id, TokenType: "Bearer", Expiry: tok.Expiry}, nil
 }
 
 // TLSClient returns a TLS enabled http client without SSO credentials for use
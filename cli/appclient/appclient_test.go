@@ -0,0 +1,174 @@
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeIssuer is a local authorization server supporting the device
+// authorization grant. The user approves the device once it has been polled
+// pending times.
+type fakeIssuer struct {
+	*httptest.Server
+	pending int
+	deny    bool
+
+	mu        sync.Mutex
+	polls     int
+	hint      string
+	refreshes int
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	f := &fakeIssuer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                        f.URL,
+			"device_authorization_endpoint": f.URL + "/device",
+			"token_endpoint":                f.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.hint = r.FormValue("login_hint")
+		f.mu.Unlock()
+		if r.FormValue("client_id") != "splice-cli" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "device1",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": f.URL + "/activate",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.FormValue("grant_type") {
+		case "refresh_token":
+			f.refreshes++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "refreshed",
+				"id_token":     "refreshed-id",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+			return
+		case "urn:ietf:params:oauth:grant-type:device_code":
+		default:
+			t.Errorf("unexpected grant type %q", r.FormValue("grant_type"))
+		}
+		f.polls++
+		switch {
+		case f.deny:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"access_denied"}`))
+		case f.polls <= f.pending:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"authorization_pending"}`))
+		default:
+			// The token expires at once, so the client must refresh it.
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "initial",
+				"refresh_token": "refresh1",
+				"token_type":    "Bearer",
+				"expires_in":    1,
+			})
+		}
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestConnect(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.pending = 1
+	var shown *oauth2.DeviceAuthResponse
+	c, err := Connect(context.Background(), Config{
+		Issuer:   f.URL + "/",
+		ClientID: "splice-cli",
+		Username: "tech@example.com",
+		Prompt:   func(da *oauth2.DeviceAuthResponse) { shown = da },
+	})
+	if err != nil {
+		t.Fatalf("Connect() returned %v", err)
+	}
+	if shown == nil || shown.UserCode != "ABCD-EFGH" {
+		t.Errorf("Connect() prompted with %+v, want user code ABCD-EFGH", shown)
+	}
+	if f.polls != 2 || f.hint != "tech@example.com" {
+		t.Errorf("Connect() polled %d times with hint %q, want 2 polls and tech@example.com", f.polls, f.hint)
+	}
+
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The ID token identifies the user to the App.
+		if got := r.Header.Get("Authorization"); got != "Bearer refreshed-id" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer refreshed-id")
+		}
+	}))
+	defer app.Close()
+	res, err := c.Post(app.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("Post() returned %v", err)
+	}
+	res.Body.Close()
+	if f.refreshes != 1 {
+		t.Errorf("the token was refreshed %d times, want 1", f.refreshes)
+	}
+}
+
+func TestConnectErrors(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.deny = true
+	noDevice := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"token_endpoint": "https://example.com/token"})
+	}))
+	defer noDevice.Close()
+
+	tests := []struct {
+		desc string
+		conf Config
+		want string
+	}{
+		{"no client ID", Config{Issuer: f.URL}, "client ID"},
+		{"no device grant", Config{Issuer: noDevice.URL, ClientID: "splice-cli"}, "does not support"},
+		{"unknown client", Config{Issuer: f.URL, ClientID: "other"}, "device authorization request"},
+		{"denied", Config{Issuer: f.URL, ClientID: "splice-cli"}, "access_denied"},
+	}
+	for _, tt := range tests {
+		tt.conf.Prompt = func(*oauth2.DeviceAuthResponse) {}
+		_, err := Connect(context.Background(), tt.conf)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Connect(%s) returned %v, want an error containing %q", tt.desc, err, tt.want)
+		}
+	}
+}
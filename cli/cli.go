@@ -22,6 +22,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -38,10 +39,14 @@ import (
 	"github.com/google/deck"
 	"github.com/google/certtostore"
 	"github.com/google/splice/appengine/server"
+	"github.com/google/splice/cli/gce"
 	"github.com/google/splice/models"
 	"github.com/google/splice/shared/certs"
 	metadata "github.com/google/splice/shared/crypto"
 	"github.com/google/splice/shared/provisioning"
+	"github.com/google/splice/shared/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -51,6 +56,10 @@ const (
 
 var (
 	myName       = flag.String("name", "", "The requested hostname.")
+	domain       = flag.String("domain", "", "The domain to join, from those served by the Splice deployment. Defaults to its default domain.")
+	ou           = flag.String("ou", "", "The distinguished name of the OU to create the computer account in, from those allowed by the Splice deployment. Defaults to the default computers container.")
+	certTemplate = flag.String("cert_template", "", "The certificate template to enroll with once joined, from those allowed by the Splice deployment. Defaults to the template of the domain, if any.")
+	policies     = flag.String("policies", "", "A semicolon separated list of group policies to apply when joined, from those allowed by the Splice deployment. Optional.")
 	pollInterval = flag.Int("poll_interval", 30, "Time in seconds between server polling attempts.")
 	serverAddr   = flag.String("server", "", "The address of the Splice app server.")
 	reallyJoin   = flag.Bool("really_join", false, "Really join the local machine if the request succeeds.")
@@ -61,7 +70,10 @@ var (
 	isGCE = flag.Bool("gce", false, "Include GCE Metadata.")
 
 	// Auth flags
-	username = flag.String("user_name", "", "User name for login.")
+	username          = flag.String("user_name", "", "User name for login.")
+	oauthIssuer       = flag.String("oauth_issuer", "https://accounts.google.com", "The OAuth 2.0 issuer that attended users authorize the CLI with.")
+	oauthClientID     = flag.String("oauth_client_id", "", "The OAuth 2.0 client ID of the CLI. Required for attended joins.")
+	oauthClientSecret = flag.String("oauth_client_secret", "", "The OAuth 2.0 client secret of the CLI, for issuers that require one.")
 
 	// Encryption flags
 	certIssuers       = flag.String("cert_issuer", "", "Comma delimited list of client certificate issuers to be looked up for metadata encryption.")
@@ -73,58 +85,111 @@ var (
 	// Generator Support
 	generatorID = flag.String("generator_id", "", "The identity of a Splice name generator to be associated with the request.")
 
+	// Tracing
+	traceExporter = flag.String("trace_exporter", tracing.ExporterNone, "Where to export trace spans: none, stdout or file.")
+	traceFile     = flag.String("trace_file", "", "The file trace spans are appended to when -trace_exporter=file.")
+
 	issuers, intermediates []string
+
+	// flushTraces exports any pending trace spans before the CLI exits.
+	flushTraces = func(context.Context) error { return nil }
 )
 
 type client interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
-// post posts JSON data to the splice application server
-func post(c client, msg interface{}, addr string) (*models.Response, error) {
+// post posts JSON data to the splice application server. The trace context
+// of ctx is sent along, so that the server can continue the trace.
+func post(ctx context.Context, c client, msg interface{}, addr string) (*models.Response, error) {
+	resp := &models.Response{}
+	if err := postJSON(ctx, c, msg, addr, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// postJSON posts msg to addr and unmarshals the JSON response into out.
+func postJSON(ctx context.Context, c client, msg interface{}, addr string, out interface{}) error {
 	body, err := json.Marshal(msg)
 	if err != nil {
-		return nil, fmt.Errorf("error marshalling message(%v): %v", msg, err)
+		return fmt.Errorf("error marshalling message(%v): %v", msg, err)
 	}
 
-	req, err := http.NewRequest("POST", addr, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", addr, bytes.NewBuffer(body))
 	if err != nil {
-		return nil, fmt.Errorf("error composing post request: %v", err)
+		return fmt.Errorf("error composing post request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	res, err := c.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error executing post request: %v", err)
+		return fmt.Errorf("error executing post request: %v", err)
 	}
 	defer res.Body.Close()
 
 	respBody, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %v", err)
+		return fmt.Errorf("error reading response body: %v", err)
 	}
 
 	if res.StatusCode < http.StatusOK || res.StatusCode > http.StatusIMUsed {
-		return nil, fmt.Errorf("invalid response code received for request: %d with body: %s", res.StatusCode, respBody)
+		return fmt.Errorf("invalid response code received for request: %d with body: %s", res.StatusCode, respBody)
 	}
 
-	resp := &models.Response{}
-	if err := json.Unmarshal(respBody, resp); err != nil {
+	if err := json.Unmarshal(respBody, out); err != nil {
 		msg := fmt.Sprintf("json.Unmarshal returned: %v\n\nResponse Body: %s", err, respBody)
 		if *verbose {
 			msg = fmt.Sprintf("%s (body: %s)", msg, respBody)
 		}
-		return nil, errors.New(msg)
+		return errors.New(msg)
 	}
-	return resp, nil
+	return nil
+}
+
+// challenge fetches a single-use nonce from the splice application server,
+// to be included in the next request or result query.
+func challenge(ctx context.Context, c client) (string, error) {
+	resp := &models.NonceResponse{}
+	endpoint := *serverAddr + "/challenge"
+	if err := postJSON(ctx, c, struct{}{}, endpoint, resp); err != nil {
+		return "", err
+	}
+	if resp.ErrorCode != server.StatusSuccess {
+		return "", fmt.Errorf("post to %s returned: %v %d", endpoint, resp.Status, resp.ErrorCode)
+	}
+	return resp.Nonce, nil
+}
+
+// splitList splits a semicolon separated list, dropping empty entries.
+func splitList(list string) []string {
+	var out []string
+	for _, s := range strings.Split(list, ";") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
 }
 
 // request posts to the splice request endpoint and returns the
-// requestID if successful or an error.
-func request(c client, clientID string, cert certs.Certificate) (string, error) {
+// requestID and the token that retrieves its result if successful
+// or an error.
+func request(ctx context.Context, c client, clientID string, cert certs.Certificate) (reqID, token string, err error) {
+	ctx, span := tracing.Start(ctx, "request", "", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		span.SetAttributes(tracing.RequestIDKey.String(reqID))
+		tracing.End(span, err)
+	}()
+
 	model := &models.ClientRequest{
-		Hostname: *myName,
-		ClientID: clientID,
+		Hostname:     *myName,
+		ClientID:     clientID,
+		Domain:       *domain,
+		OU:           *ou,
+		CertTemplate: *certTemplate,
+		Policies:     splitList(*policies),
 	}
 	endpoint := *serverAddr + "/request"
 	if *unattended {
@@ -134,7 +199,7 @@ func request(c client, clientID string, cert certs.Certificate) (string, error)
 	if *isGCE {
 		model.GCEMetadata.Audience = endpoint
 		if err := model.GCEMetadata.Read(); err != nil {
-			return "", fmt.Errorf("error reading GCE metadata: %v", err)
+			return "", "", fmt.Errorf("error reading GCE metadata: %v", err)
 		}
 	}
 
@@ -146,24 +211,44 @@ func request(c client, clientID string, cert certs.Certificate) (string, error)
 		model.GeneratorID = *generatorID
 	}
 
-	resp, err := post(c, model, endpoint)
+	if model.Nonce, err = challenge(ctx, c); err != nil {
+		return "", "", fmt.Errorf("challenge: %v", err)
+	}
+
+	// Requests carrying a certificate prove that we hold its key.
+	if model.ClientCert != nil {
+		model.Timestamp = time.Now().UTC()
+		if model.Signature, err = cert.Sign(model.SigningInput()); err != nil {
+			return "", "", fmt.Errorf("error signing request: %v", err)
+		}
+	}
+
+	resp, err := post(ctx, c, model, endpoint)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	if resp.ErrorCode != server.StatusSuccess {
-		return "", fmt.Errorf("post to %s returned: %v %d %s", endpoint, resp.Status, resp.ErrorCode, resp.ResponseData)
+		return "", "", fmt.Errorf("post to %s returned: %v %d %s", endpoint, resp.Status, resp.ErrorCode, resp.ResponseData)
 	}
 
 	if *verbose {
 		fmt.Printf("Request ID: %s\n", resp.RequestID)
 	}
-	return resp.RequestID, nil
+	return resp.RequestID, resp.Token, nil
 }
 
-func resultPoll(c client, reqID string, clientID string) (*models.Response, error) {
+// resultPoll queries the splice result endpoint until the request is
+// completed or failed. Each query carries a fresh nonce and, when the request
+// was made with a certificate, is signed with its key. On GCE, each query
+// also carries a new identity token of the instance.
+func resultPoll(ctx context.Context, c client, reqID, token string, clientID string, cert certs.Certificate) (resp *models.Response, err error) {
+	ctx, span := tracing.Start(ctx, "resultPoll", reqID, trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+
 	status := &models.StatusQuery{
 		RequestID: reqID,
 		ClientID:  clientID,
+		Token:     token,
 	}
 
 	endpoint := *serverAddr + "/result"
@@ -173,7 +258,24 @@ func resultPoll(c client, reqID string, clientID string) (*models.Response, erro
 
 	for i := 0; i < pollMaxRetries; i++ {
 		time.Sleep(time.Duration(*pollInterval) * time.Second)
-		resp, err := post(c, status, endpoint)
+		if status.Nonce, err = challenge(ctx, c); err != nil {
+			return nil, fmt.Errorf("challenge: %v", err)
+		}
+		// GCE instances prove that they made the request with a new
+		// identity token for each query.
+		if *isGCE {
+			status.GCEMetadata = gce.Metadata{Audience: endpoint}
+			if err := status.GCEMetadata.Read(); err != nil {
+				return nil, fmt.Errorf("error reading GCE metadata: %v", err)
+			}
+		}
+		if *encrypt {
+			status.Timestamp = time.Now().UTC()
+			if status.Signature, err = cert.Sign(status.SigningInput()); err != nil {
+				return nil, fmt.Errorf("error signing result query: %v", err)
+			}
+		}
+		resp, err := post(ctx, c, status, endpoint)
 		if err != nil {
 			return nil, fmt.Errorf("post: %v", err)
 		}
@@ -189,6 +291,13 @@ func resultPoll(c client, reqID string, clientID string) (*models.Response, erro
 		if resp.ErrorCode != server.StatusSuccess {
 			return resp, fmt.Errorf("server processing failed, request:%s, id:%s, status:%d %v, data: %s", reqID, clientID, resp.ErrorCode, resp.Status, resp.ResponseData)
 		}
+		if resp.Status == models.RequestStatusPendingApproval {
+			// The App fails requests nobody acts on in time, so waiting
+			// for approval does not count against the retry limit.
+			fmt.Println("The request is awaiting approval...")
+			i--
+			continue
+		}
 		if resp.Status == models.RequestStatusFailed {
 			return resp, fmt.Errorf("domain join failed, request:%s, id:%s, status:%d %v, data: %s", reqID, clientID, resp.ErrorCode, resp.Status, resp.ResponseData)
 		}
@@ -219,6 +328,8 @@ func checkFlags() error {
 		return errors.New("-encrypt is not supported with both -generate_cert and -cert_issuer")
 	case *generateCert && *myName == "":
 		return errors.New("-generate_cert requires -name")
+	case !*unattended && *oauthClientID == "":
+		return errors.New("attended joins require -oauth_client_id")
 	}
 
 	if !strings.HasPrefix(*serverAddr, "http") {
@@ -238,6 +349,7 @@ func checkFlags() error {
 
 func logAndExit(eid uint32, msg string) {
 	deck.ErrorA(msg).With(eventlog.EventID(eid)).Go()
+	flushTraces(context.Background())
 	log.Fatal(msg)
 }
 
@@ -254,6 +366,14 @@ func main() {
 		logAndExit(EvtErrStartup, err.Error())
 	}
 
+	flushTraces, err = tracing.Init(tracing.Config{Service: "splice-cli", Exporter: *traceExporter, Path: *traceFile})
+	if err != nil {
+		logAndExit(EvtErrStartup, err.Error())
+	}
+	defer flushTraces(context.Background())
+	ctx, span := tracing.Start(context.Background(), "join", "")
+	defer span.End()
+
 	var cert certs.Certificate
 	if len(issuers) >= 1 {
 		store, err := certs.NewStore(*certContainer, issuers, intermediates)
@@ -301,7 +421,12 @@ func main() {
 
 	var c client
 	if !*unattended {
-		c, err = appclient.Connect(*serverAddr, *username)
+		c, err = appclient.Connect(ctx, appclient.Config{
+			Issuer:       *oauthIssuer,
+			ClientID:     *oauthClientID,
+			ClientSecret: *oauthClientSecret,
+			Username:     *username,
+		})
 		if err != nil {
 			logAndExit(EvtErrConnection, fmt.Sprintf("SSO error: %v", err))
 		}
@@ -312,13 +437,13 @@ func main() {
 		}
 	}
 
-	reqID, err := request(c, clientID, cert)
+	reqID, token, err := request(ctx, c, clientID, cert)
 	if err != nil {
 		logAndExit(EvtErrRequest, fmt.Sprintf("request: %v", err))
 	}
 	fmt.Println("Successfully submitted join request.")
 
-	resp, err := resultPoll(c, reqID, clientID)
+	resp, err := resultPoll(ctx, c, reqID, token, clientID, cert)
 	if err != nil {
 		logAndExit(EvtErrPoll, fmt.Sprintf("resultPoll: %v\n", err))
 	}
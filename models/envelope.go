@@ -0,0 +1,139 @@
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// EnvelopeVersion is the schema version of the Envelope published by this
+// version of the App.
+const EnvelopeVersion = 1
+
+// Pub/Sub attributes carrying the routing fields of an Envelope, so that
+// joiners and subscription filters can route messages without decoding them.
+const (
+	AttrVersion  = "splice_version"
+	AttrDomain   = "splice_domain"
+	AttrPriority = "splice_priority"
+	// AttrLane holds LaneAttended or LaneBulk, so that subscriptions can
+	// filter on the lane whatever priority a request was given.
+	AttrLane = "splice_lane"
+)
+
+// Lanes requests are published in, as reported by Envelope.Lane.
+const (
+	LaneAttended = "attended"
+	LaneBulk     = "bulk"
+)
+
+// Priorities of the lanes requests are published in. Joiners hand waiting
+// requests to their workers highest priority first.
+const (
+	// PriorityNormal is the priority of bulk requests that no one is waiting
+	// on, such as unattended joins.
+	PriorityNormal = 0
+	// PriorityAttended is the priority of requests a technician is waiting on.
+	PriorityAttended = 10
+)
+
+// ErrEnvelope is wrapped by the errors returned for malformed envelopes.
+var ErrEnvelope = errors.New("malformed message envelope")
+
+// Envelope announces a join request to the joiners. It carries enough about
+// the request for a joiner to decide whether and when to process it before
+// loading the request from the datastore.
+type Envelope struct {
+	// Version is the schema version of the envelope. Envelopes decoded from
+	// legacy messages, which only carry a request ID, have version 0.
+	Version   int    `json:"version"`
+	RequestID string `json:"request_id"`
+	// Domain is the domain the request asks to join. An empty Domain leaves
+	// the choice to the joiner.
+	Domain string `json:"domain,omitempty"`
+	// Priority orders requests waiting to be processed; higher is more urgent.
+	Priority int `json:"priority"`
+	// EnqueueTime is when the App published the request.
+	EnqueueTime time.Time `json:"enqueue_time"`
+	// Attempt counts how many times the App has published the request,
+	// starting at 1.
+	Attempt int `json:"attempt"`
+	// TraceContext carries the W3C trace context of the request.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// Encode returns the message data and attributes for e.
+func (e Envelope) Encode() ([]byte, map[string]string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Encode: %v", err)
+	}
+	attrs := map[string]string{
+		AttrVersion:  strconv.Itoa(e.Version),
+		AttrPriority: strconv.Itoa(e.Priority),
+		AttrLane:     e.Lane(),
+	}
+	if e.Domain != "" {
+		attrs[AttrDomain] = e.Domain
+	}
+	return data, attrs, nil
+}
+
+// Lane returns LaneAttended for requests with at least PriorityAttended, and
+// LaneBulk for the rest.
+func (e Envelope) Lane() string {
+	if e.Priority >= PriorityAttended {
+		return LaneAttended
+	}
+	return LaneBulk
+}
+
+// DecodeEnvelope parses a message published by the App. Legacy messages whose
+// data holds only a request ID decode to a version 0 envelope. Fields added by
+// newer schema versions are ignored. If the envelope carries no trace
+// context, it is read from the W3C trace context keys of attrs.
+func DecodeEnvelope(data []byte, attrs map[string]string) (Envelope, error) {
+	var e Envelope
+	// Request IDs are URL-safe base64, which never starts with a brace.
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		e.RequestID = string(data)
+	} else if err := json.Unmarshal(data, &e); err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrEnvelope, err)
+	}
+	if e.RequestID == "" {
+		return Envelope{}, fmt.Errorf("%w: no request ID", ErrEnvelope)
+	}
+	if len(e.TraceContext) == 0 {
+		for _, k := range traceKeys {
+			if v, ok := attrs[k]; ok {
+				if e.TraceContext == nil {
+					e.TraceContext = make(map[string]string)
+				}
+				e.TraceContext[k] = v
+			}
+		}
+	}
+	return e, nil
+}
+
+// traceKeys are the message attributes that carry W3C trace context.
+var traceKeys = []string{"traceparent", "tracestate"}
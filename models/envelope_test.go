@@ -0,0 +1,106 @@
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	in := Envelope{
+		Version:      EnvelopeVersion,
+		RequestID:    "abc-123_",
+		Domain:       "example.com",
+		Priority:     5,
+		EnqueueTime:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Attempt:      1,
+		TraceContext: map[string]string{"traceparent": "00-01-02-01"},
+	}
+	data, attrs, err := in.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned %v", err)
+	}
+	wantAttrs := map[string]string{AttrVersion: "1", AttrDomain: "example.com", AttrPriority: "5", AttrLane: LaneBulk}
+	if diff := cmp.Diff(wantAttrs, attrs); diff != "" {
+		t.Errorf("Encode() attributes diff (-want +got):\n%s", diff)
+	}
+	out, err := DecodeEnvelope(data, attrs)
+	if err != nil {
+		t.Fatalf("DecodeEnvelope() returned %v", err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Errorf("DecodeEnvelope(Encode()) diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	trace := map[string]string{"traceparent": "00-01-02-01"}
+	tests := []struct {
+		desc  string
+		data  string
+		attrs map[string]string
+		want  Envelope
+		err   error
+	}{
+		{"legacy request ID", "abc-123_", nil, Envelope{RequestID: "abc-123_"}, nil},
+		{"legacy with trace attributes", "abc-123_", trace, Envelope{RequestID: "abc-123_", TraceContext: trace}, nil},
+		{
+			"trace attributes among routing attributes", `{"version": 1, "request_id": "abc"}`,
+			map[string]string{"traceparent": "00-01-02-01", "tracestate": "k=v", AttrVersion: "1", AttrDomain: "example.com", AttrPriority: "10"},
+			Envelope{Version: 1, RequestID: "abc", TraceContext: map[string]string{"traceparent": "00-01-02-01", "tracestate": "k=v"}}, nil,
+		},
+		{"routing attributes only", `{"version": 1, "request_id": "abc"}`, map[string]string{AttrVersion: "1"}, Envelope{Version: 1, RequestID: "abc"}, nil},
+		{
+			"newer schema version",
+			`{"version": 9, "request_id": "abc", "priority": 1, "lane": "bulk"}`, nil,
+			Envelope{Version: 9, RequestID: "abc", Priority: 1}, nil,
+		},
+		{"malformed JSON", `{"request_id": `, nil, Envelope{}, ErrEnvelope},
+		{"no request ID", `{"version": 1}`, nil, Envelope{}, ErrEnvelope},
+		{"empty", "", nil, Envelope{}, ErrEnvelope},
+	}
+	for _, tt := range tests {
+		got, err := DecodeEnvelope([]byte(tt.data), tt.attrs)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: DecodeEnvelope() returned %v, want %v", tt.desc, err, tt.err)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: DecodeEnvelope() diff (-want +got):\n%s", tt.desc, diff)
+		}
+	}
+}
+
+func TestEnvelopeLane(t *testing.T) {
+	for priority, want := range map[int]string{
+		PriorityNormal:       LaneBulk,
+		5:                    LaneBulk,
+		PriorityAttended:     LaneAttended,
+		PriorityAttended + 5: LaneAttended,
+	} {
+		_, attrs, err := Envelope{Version: EnvelopeVersion, RequestID: "abc", Priority: priority}.Encode()
+		if err != nil {
+			t.Fatalf("Encode() returned %v", err)
+		}
+		if got := attrs[AttrLane]; got != want {
+			t.Errorf("priority %d: %s = %q, want %q", priority, AttrLane, got, want)
+		}
+	}
+}
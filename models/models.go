@@ -18,6 +18,7 @@ limitations under the License.
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/splice/appengine/server"
@@ -31,8 +32,16 @@ const (
 	RequestStatusCompleted  = "Completed"
 	RequestStatusFailed     = "Failed"
 	RequestStatusReturned   = "Returned"
+	// RequestStatusPendingApproval marks a request held for an administrator
+	// to approve before it is published to the joiners.
+	RequestStatusPendingApproval = "PendingApproval"
 )
 
+// LegacyClaimTimeout is how long a claim without an explicit lease is honored
+// before the request is considered orphaned. It only applies to requests
+// claimed by joiners that predate claim leases.
+const LegacyClaimTimeout = 300 * time.Second
+
 // ClientRequest models the allowable data that a client (the CLI) can
 // submit as part of a request to be joined.
 type ClientRequest struct {
@@ -46,27 +55,104 @@ type ClientRequest struct {
 	// Generators
 	GeneratorID   string
 	GeneratorData []byte
+
+	// (Optional) Domain is the domain to join. An empty Domain selects the
+	// default domain of the deployment.
+	Domain string
+	// (Optional) OU is the distinguished name of the organizational unit
+	// the machine account is created in. An empty OU selects the default
+	// computers container of the domain.
+	OU string
+	// (Optional) CertTemplate names the certificate template the host
+	// enrolls with once joined, in place of the default of its domain.
+	CertTemplate string
+	// (Optional) Policies lists the names of group policy objects to apply
+	// to the host when it is joined, in addition to those of its domain.
+	Policies []string
+
+	// Nonce is a challenge nonce issued by the App, which accepts each
+	// nonce once.
+	Nonce string
+	// Timestamp is the time at which the request was signed.
+	Timestamp time.Time
+	// Signature proves that the client holds the private key of ClientCert.
+	// It is a signature of SigningInput by that key, and is required of
+	// requests carrying a ClientCert unless the App disables verification.
+	Signature []byte
+}
+
+// SignatureVersion identifies the canonical form of a ClientRequest returned
+// by SigningInput.
+const SignatureVersion = "splice-request-v1"
+
+// SigningInput returns the canonical form of the request that clients sign:
+// a JSON array of SignatureVersion followed by every field of the request
+// except Signature, in a fixed order.
+func (r *ClientRequest) SigningInput() []byte {
+	// Marshalling strings, byte slices and string slices cannot fail.
+	b, _ := json.Marshal([]interface{}{
+		SignatureVersion,
+		r.Timestamp.UTC().Format(time.RFC3339Nano),
+		r.Hostname,
+		r.ClientID,
+		r.ClientCert,
+		r.GCEMetadata.InstanceID,
+		r.GCEMetadata.ProjectID,
+		r.GCEMetadata.Zone,
+		r.GCEMetadata.Audience,
+		r.GCEMetadata.Identity,
+		r.GeneratorID,
+		r.GeneratorData,
+		r.Domain,
+		r.OU,
+		r.CertTemplate,
+		r.Policies,
+		r.Nonce,
+	})
+	return b
 }
 
 // Request models a new request to join a machine to the domain. This includes all
 // data the Splice App may need to track the lifecycle of a request.
 type Request struct {
-	RequestID      string
-	ClientID       string
-	ClientCert     []byte
-	Hostname       string
-	AcceptTime     time.Time
-	ClaimBy        string
-	ClaimTime      time.Time
-	Status         string
+	RequestID  string
+	ClientID   string
+	ClientCert []byte
+	Hostname   string
+	AcceptTime time.Time
+	ClaimBy    string
+	ClaimTime  time.Time
+	Status     string
+
+	// LeaseID identifies the claim currently held on the request. It changes
+	// every time the request is claimed, so that a joiner can tell whether it
+	// still holds the claim it started with.
+	LeaseID string `datastore:",noindex"`
+	// LeaseExpiry is the time at which the current claim lapses unless the
+	// claiming joiner renews it.
+	LeaseExpiry    time.Time
 	CompletionTime time.Time
 	ResponseData   []byte `datastore:",noindex"`
 
+	// Attempts counts how many times the request has been published to the
+	// joiners.
+	Attempts int `datastore:",noindex"`
+	// Priority selects the lane the request is published in. See
+	// PriorityNormal and PriorityAttended.
+	Priority int `datastore:",noindex"`
+
 	// ExpireAt allows the Datastore to apply a TTL for old requests.
 	ExpireAt time.Time
 
 	// Unattended validation
 	GCEMetadata gce.Metadata `datastore:",noindex"`
+	// GCEVerified is set by the App once it has verified the GCE identity
+	// token of the request, so that validators may trust GCEMetadata.
+	GCEVerified bool `datastore:",noindex"`
+	// CertVerified is set by the App once the front end has vouched for
+	// ClientCert by presenting its fingerprint, so that validators may trust
+	// the certificate's issuer.
+	CertVerified bool `datastore:",noindex"`
 
 	//
 	// Encryption
@@ -74,6 +160,10 @@ type Request struct {
 
 	ResponseKey []byte `datastore:",noindex"`
 	CipherNonce []byte `datastore:",noindex"`
+	// EncryptionPolicy is the encryption policy the App enforced on the
+	// request, such as "rsa:2048|ec:256", or empty if it enforced none.
+	// Joiners always encrypt the join metadata of requests with a policy.
+	EncryptionPolicy string `datastore:",noindex"`
 
 	//
 	// Reuse
@@ -91,14 +181,217 @@ type Request struct {
 	// (Optional) GeneratorData allows for arbitrary add-on data to be encoded by the CLI
 	// for use by SpliceD. Its use will be generator-specific.
 	GeneratorData []byte `datastore:",noindex"`
+
+	//
+	// Domains
+	//
+
+	// Domain is the domain the request is joined to. It is empty for
+	// deployments serving a single domain.
+	Domain string
+	// OU is the distinguished name of the organizational unit the machine
+	// account is created in, or empty for the default computers container.
+	OU string `datastore:",noindex"`
+	// DomainController is the domain controller the machine account was
+	// provisioned against, or last attempted on failure. It is empty if
+	// SpliceD let Windows choose one.
+	DomainController string `datastore:",noindex"`
+
+	//
+	// Provisioning packages
+	//
+
+	// CertTemplate names the certificate template the host enrolls with once
+	// joined, or is empty for the default of its domain.
+	CertTemplate string `datastore:",noindex"`
+	// Policies lists the names of group policy objects applied to the host
+	// when it is joined, in addition to those of its domain.
+	Policies []string `datastore:",noindex"`
+
+	//
+	// Identity
+	//
+
+	// Requester identifies the user who made an attended request, as
+	// verified by the App. It is empty for unattended requests, and where
+	// the App does not verify users.
+	Requester string `datastore:",noindex"`
+	// RequesterGroups lists the groups of the requester, as asserted by its
+	// identity provider.
+	RequesterGroups []string `datastore:",noindex"`
+
+	//
+	// Approval
+	//
+
+	// Approver is the administrator who approved or denied the request, if
+	// it was held for approval.
+	Approver string `datastore:",noindex"`
+	// ApprovalReason is the reason the approver gave for their decision.
+	ApprovalReason string `datastore:",noindex"`
+	// ApprovalTime is the time at which the request was approved or denied.
+	ApprovalTime time.Time `datastore:",noindex"`
+
+	//
+	// Retrieval
+	//
+
+	// TokenHash is the SHA-256 hash of the retrieval token returned to the
+	// client, which must present the token to retrieve the result. The token
+	// itself is not stored.
+	TokenHash []byte `datastore:",noindex"`
+}
+
+// LeaseExpired reports whether the request has been claimed by a joiner whose
+// lease had lapsed as of now. Unclaimed requests have no lease to expire.
+func (r *Request) LeaseExpired(now time.Time) bool {
+	if r.ClaimBy == "" || r.ClaimTime.IsZero() {
+		return false
+	}
+	if r.LeaseExpiry.IsZero() {
+		return now.Sub(r.ClaimTime) > LegacyClaimTimeout
+	}
+	return now.After(r.LeaseExpiry)
+}
+
+// HoldsLease reports whether the joiner instance holds the claim identified by
+// leaseID on the request.
+func (r *Request) HoldsLease(instance, leaseID string) bool {
+	return r.Status == RequestStatusAccepted && r.ClaimBy == instance && r.LeaseID == leaseID
 }
 
 // StatusQuery models a request for the status of a join.
 type StatusQuery struct {
 	RequestID string
 	ClientID  string
+	// Token is the retrieval token the App returned for the request.
+	Token string
 
 	GCEMetadata gce.Metadata
+
+	// Nonce is a challenge nonce issued by the App, which accepts each
+	// nonce once.
+	Nonce string
+	// Timestamp is the time at which the query was signed.
+	Timestamp time.Time
+	// Signature is a signature of SigningInput by the key of the client
+	// certificate of the request. It is required for requests that carried
+	// a certificate, unless the App disables verification.
+	Signature []byte
+}
+
+// QuerySignatureVersion identifies the canonical form of a StatusQuery
+// returned by SigningInput.
+const QuerySignatureVersion = "splice-result-v2"
+
+// SigningInput returns the canonical form of the query that clients sign: a
+// JSON array of QuerySignatureVersion followed by every field of the query
+// except Signature, in a fixed order.
+func (q *StatusQuery) SigningInput() []byte {
+	// Marshalling strings and byte slices cannot fail.
+	b, _ := json.Marshal([]interface{}{
+		QuerySignatureVersion,
+		q.Timestamp.UTC().Format(time.RFC3339Nano),
+		q.RequestID,
+		q.ClientID,
+		q.Token,
+		q.GCEMetadata.InstanceID,
+		q.GCEMetadata.ProjectID,
+		q.GCEMetadata.Zone,
+		q.GCEMetadata.Audience,
+		q.GCEMetadata.Identity,
+		q.Nonce,
+	})
+	return b
+}
+
+// NonceResponse models the response to a request for a challenge nonce.
+type NonceResponse struct {
+	ErrorCode server.StatusCode
+	Status    string
+	Nonce     string
+	// ExpireTime is the time after which the nonce is no longer accepted.
+	ExpireTime time.Time
+}
+
+// JoinerHeartbeatInterval is how often a joiner publishes its Joiner record.
+const JoinerHeartbeatInterval = time.Minute
+
+// Joiner models the most recent heartbeat published by a SpliceD instance.
+// Joiners are stored under their Instance name, so each instance has exactly
+// one record.
+type Joiner struct {
+	Instance  string
+	Version   string
+	StartTime time.Time
+	LastSeen  time.Time
+
+	// Configuration summary
+	Domain      string
+	Domains     []string
+	ProjectID   string
+	Topic       string
+	EncryptBlob bool
+	VerifyCert  bool
+	PermitReuse bool
+	Workers     int
+	Generators  []string
+
+	// Current state
+	Paused   bool
+	InFlight int
+}
+
+// JoinerStatus reports a joiner's record along with the App's view of its liveness.
+type JoinerStatus struct {
+	Joiner
+	Stale bool
+}
+
+// FleetResponse models the response to a query for the registered joiners.
+type FleetResponse struct {
+	ErrorCode server.StatusCode
+	Status    string
+	Joiners   []JoinerStatus
+	// Live counts the joiners that are not stale. A queue with no live
+	// joiners will not make progress.
+	Live int
+}
+
+// ApprovalDecision models an administrator's decision on a request held for
+// approval.
+type ApprovalDecision struct {
+	RequestID string
+	// Approve publishes the request to the joiners if true, and fails it
+	// otherwise.
+	Approve bool
+	// Reason is recorded with the decision, and returned to the client of a
+	// denied request.
+	Reason string
+}
+
+// PendingRequest summarizes a request held for approval.
+type PendingRequest struct {
+	RequestID   string
+	Hostname    string
+	GeneratorID string
+	ClientID    string
+	Requester   string
+	Domain      string
+	OU          string
+	ProjectID   string
+	AcceptTime  time.Time
+	// ExpireTime is the time at which the request fails unless it is
+	// approved or denied first.
+	ExpireTime time.Time
+}
+
+// ApprovalsResponse models the response to a query for the requests held
+// for approval.
+type ApprovalsResponse struct {
+	ErrorCode server.StatusCode
+	Status    string
+	Pending   []PendingRequest
 }
 
 // Response models the response to a client request, returned by the App to the CLI.
@@ -109,6 +402,10 @@ type Response struct {
 	Hostname     string
 	ResponseData []byte
 
+	// Token is the secret the client presents to retrieve the result of
+	// the request. It is only returned when the request is accepted.
+	Token string `json:",omitempty"`
+
 	// Encryption
 	ResponseKey []byte
 	CipherNonce []byte
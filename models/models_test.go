@@ -0,0 +1,92 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		desc string
+		req  Request
+		want bool
+	}{
+		{"unclaimed", Request{}, false},
+		{"active lease", Request{ClaimBy: "spliced1", ClaimTime: now.Add(-time.Hour), LeaseExpiry: now.Add(time.Minute)}, false},
+		{"expired lease", Request{ClaimBy: "spliced1", ClaimTime: now.Add(-time.Hour), LeaseExpiry: now.Add(-time.Second)}, true},
+		{"recent legacy claim", Request{ClaimBy: "spliced1", ClaimTime: now.Add(-time.Minute)}, false},
+		{"stale legacy claim", Request{ClaimBy: "spliced1", ClaimTime: now.Add(-LegacyClaimTimeout - time.Second)}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.req.LeaseExpired(now); got != tt.want {
+			t.Errorf("%s: LeaseExpired() = %t, want %t", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestHoldsLease(t *testing.T) {
+	req := Request{Status: RequestStatusAccepted, ClaimBy: "spliced1", LeaseID: "lease1"}
+	tests := []struct {
+		desc     string
+		instance string
+		leaseID  string
+		want     bool
+	}{
+		{"holder", "spliced1", "lease1", true},
+		{"other joiner", "spliced2", "lease1", false},
+		{"superseded lease", "spliced1", "lease0", false},
+	}
+	for _, tt := range tests {
+		if got := req.HoldsLease(tt.instance, tt.leaseID); got != tt.want {
+			t.Errorf("%s: HoldsLease(%q, %q) = %t, want %t", tt.desc, tt.instance, tt.leaseID, got, tt.want)
+		}
+	}
+
+	req.Status = RequestStatusCompleted
+	if req.HoldsLease("spliced1", "lease1") {
+		t.Errorf("HoldsLease() on a completed request = true, want false")
+	}
+}
+
+func TestSigningInput(t *testing.T) {
+	ts := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	req := ClientRequest{Hostname: "host1", ClientID: "client1", Timestamp: ts, Policies: []string{"a", "b"}}
+	base := string(req.SigningInput())
+
+	// Signatures cover every field but Signature.
+	signed := req
+	signed.Signature = []byte("sig")
+	if got := string(signed.SigningInput()); got != base {
+		t.Errorf("SigningInput() with a signature = %s, want %s", got, base)
+	}
+	local := req
+	local.Timestamp = ts.In(time.FixedZone("PDT", -7*3600))
+	if got := string(local.SigningInput()); got != base {
+		t.Errorf("SigningInput() in another zone = %s, want %s", got, base)
+	}
+	for _, changed := range []ClientRequest{
+		{Hostname: "host2", ClientID: "client1", Timestamp: ts, Policies: []string{"a", "b"}},
+		{Hostname: "host1", ClientID: "client1", Timestamp: ts.Add(time.Second), Policies: []string{"a", "b"}},
+		{Hostname: "host1", ClientID: "client1", Timestamp: ts, Policies: []string{"a;b"}},
+		{Hostname: "host1", ClientID: "client1", Timestamp: ts, Policies: []string{"a", "b"}, OU: "OU=Lab"},
+	} {
+		if got := string(changed.SigningInput()); got == base {
+			t.Errorf("SigningInput() of %+v = SigningInput() of %+v", changed, req)
+		}
+	}
+}
@@ -20,6 +20,7 @@ package certs
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -92,6 +93,44 @@ func (c *Certificate) Generate(cn string, notBefore, notAfter time.Time) error {
 	return nil
 }
 
+// Sign signs data with the private key of the certificate, proving that the
+// caller holds it. RSA keys sign with PKCS #1 v1.5 and ECDSA keys with ASN.1
+// encoded signatures, both over the SHA-256 digest of data.
+func (c *Certificate) Sign(data []byte) ([]byte, error) {
+	signer, ok := c.Key.(crypto.Signer)
+	if !ok {
+		if signer, ok = c.Decrypter.(crypto.Signer); !ok {
+			return nil, errors.New("the certificate key cannot sign")
+		}
+	}
+	digest := sha256.Sum256(data)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// VerifySignature returns an error if sig is not a signature of data, as
+// produced by Certificate.Sign, by the key of the DER encoded certificate
+// cert.
+func VerifySignature(cert, data, sig []byte) error {
+	c, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return fmt.Errorf("x509.ParseCertificate returned %v", err)
+	}
+	digest := sha256.Sum256(data)
+	switch pub := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return fmt.Errorf("invalid signature: %v", err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported certificate key type %T", c.PublicKey)
+	}
+	return nil
+}
+
 // Fingerprint generates a sha256 certificate fingerprint
 func Fingerprint(cert []byte) [32]byte {
 	return sha256.Sum256(cert)
@@ -189,7 +228,7 @@ func VerifyCert(c []byte, hostname, base, path, caOrg, roots string, verify bool
 	return nil
 }
 
-// PublicKey takes a raw DER encoded cert, and returns only the public
+// PublicKey takes a raw DER encoded cert, and returns only the RSA or EC public
 // key portion of the certificate in DER format.
 func PublicKey(c []byte) ([]byte, error) {
 	cert, err := x509.ParseCertificate(c)
@@ -197,12 +236,13 @@ func PublicKey(c []byte) ([]byte, error) {
 		return nil, fmt.Errorf("x509.ParseCertificate(c): %v", err)
 	}
 
-	rsa, ok := cert.PublicKey.(*rsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("unsupported key type, not an RSA public key")
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, not an RSA or EC public key", cert.PublicKey)
 	}
 
-	public, err := x509.MarshalPKIXPublicKey(rsa)
+	public, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
 	if err != nil {
 		return nil, fmt.Errorf("error marshalling public key: %v", err)
 	}
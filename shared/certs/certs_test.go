@@ -17,7 +17,14 @@ limitations under the License.
 package certs
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"testing"
 	"time"
 )
@@ -108,3 +115,86 @@ func TestVerifyCert(t *testing.T) {
 		t.Errorf("VerifyCert(%s, \"\", \"\", \"\", false) failed a valid cert with %v", base, err)
 	}
 }
+
+func TestSign(t *testing.T) {
+	var c, other Certificate
+	if err := c.Generate("signer", notBefore, notAfter); err != nil {
+		t.Fatalf("Generate returned %v", err)
+	}
+	if err := other.Generate("other", notBefore, notAfter); err != nil {
+		t.Fatalf("Generate returned %v", err)
+	}
+	data := []byte("request")
+	sig, err := c.Sign(data)
+	if err != nil {
+		t.Fatalf("Sign returned %v", err)
+	}
+
+	if err := VerifySignature(c.Cert.Raw, data, sig); err != nil {
+		t.Errorf("VerifySignature returned %v", err)
+	}
+	if err := VerifySignature(c.Cert.Raw, []byte("tampered"), sig); err == nil {
+		t.Errorf("VerifySignature of other data succeeded")
+	}
+	if err := VerifySignature(other.Cert.Raw, data, sig); err == nil {
+		t.Errorf("VerifySignature with another certificate succeeded")
+	}
+	if err := VerifySignature([]byte("junk"), data, sig); err == nil {
+		t.Errorf("VerifySignature with an invalid certificate succeeded")
+	}
+	if _, err := (&Certificate{}).Sign(data); err == nil {
+		t.Errorf("Sign without a key succeeded")
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	var c Certificate
+	if err := c.Generate("rsa", notBefore, notAfter); err != nil {
+		t.Fatalf("Generate returned %v", err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned %v", err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned %v", err)
+	}
+	selfSigned := func(key crypto.Signer) []byte {
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "host"},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+		if err != nil {
+			t.Fatalf("x509.CreateCertificate returned %v", err)
+		}
+		return der
+	}
+
+	tests := []struct {
+		desc    string
+		cert    []byte
+		wantErr bool
+	}{
+		{"rsa", c.Cert.Raw, false},
+		{"ec", selfSigned(ec), false},
+		{"ed25519", selfSigned(ed), true},
+		{"unparseable", []byte("junk"), true},
+	}
+	for _, tt := range tests {
+		der, err := PublicKey(tt.cert)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: PublicKey returned %v, want error %t", tt.desc, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, err := x509.ParsePKIXPublicKey(der); err != nil {
+			t.Errorf("%s: PublicKey returned an unparseable key: %v", tt.desc, err)
+		}
+	}
+}
@@ -20,6 +20,9 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -28,35 +31,54 @@ import (
 	"io"
 )
 
+// hkdfInfo is prepended to the ephemeral public key to form the HKDF info of
+// AES keys derived for EC keys.
+const hkdfInfo = "splice metadata key"
+
 var (
 	newHash = sha256.New
 	rng     = rand.Reader
 )
 
-// Metadata holds the join metadata along with its RSA-encrypted AES key
+// Metadata holds the join metadata along with its wrapped AES key. For RSA
+// keys, AESKey holds the AES key encrypted with RSA-OAEP. For EC keys, it
+// holds the uncompressed ephemeral public key whose ECDH shared secret with
+// the client's key the AES key is derived from using HKDF-SHA256.
 type Metadata struct {
 	AESKey []byte
 	Data   []byte
 	Nonce  []byte
 }
 
-// Encrypt encrypts the metadata using an RSA-encrypted AES key.
+// Encrypt encrypts the metadata using an AES key wrapped to the client's RSA
+// or EC public key.
 func (m *Metadata) Encrypt(pubKey []byte) error {
-	// Generate a random AES private key.
-	aesKey := make([]byte, 32)
-	if _, err := rand.Read(aesKey); err != nil {
-		return fmt.Errorf("generate aes key: %v", err)
-	}
-
-	// RSA encrypt the key with the client's pubkey for transit.
-	cert, err := x509.ParsePKIXPublicKey(pubKey)
+	pub, err := x509.ParsePKIXPublicKey(pubKey)
 	if err != nil {
 		return fmt.Errorf("decoding public key: %v", err)
 	}
 
-	m.AESKey, err = rsa.EncryptOAEP(newHash(), rng, cert.(*rsa.PublicKey), aesKey, []byte(""))
-	if err != nil {
-		return fmt.Errorf("encrypting aes key: %v", err)
+	var aesKey []byte
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		// Generate a random AES private key.
+		aesKey = make([]byte, 32)
+		if _, err := rand.Read(aesKey); err != nil {
+			return fmt.Errorf("generate aes key: %v", err)
+		}
+
+		// RSA encrypt the key with the client's pubkey for transit.
+		m.AESKey, err = rsa.EncryptOAEP(newHash(), rng, k, aesKey, []byte(""))
+		if err != nil {
+			return fmt.Errorf("encrypting aes key: %v", err)
+		}
+	case *ecdsa.PublicKey:
+		m.AESKey, aesKey, err = wrapECDH(k)
+		if err != nil {
+			return fmt.Errorf("agreeing aes key: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
 	}
 
 	// AES encrypt the blob.
@@ -76,3 +98,69 @@ func (m *Metadata) Encrypt(pubKey []byte) error {
 
 	return nil
 }
+
+// wrapECDH generates an ephemeral key on the curve of pub, and returns its
+// public key along with the AES key derived from their shared secret.
+func wrapECDH(pub *ecdsa.PublicKey) (ephemeral, aesKey []byte, err error) {
+	remote, err := pub.ECDH()
+	if err != nil {
+		return nil, nil, fmt.Errorf("ecdsa.PublicKey.ECDH returned %v", err)
+	}
+	priv, err := remote.Curve().GenerateKey(rng)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating ephemeral key: %v", err)
+	}
+	secret, err := priv.ECDH(remote)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ecdh: %v", err)
+	}
+	ephemeral = priv.PublicKey().Bytes()
+	aesKey, err = deriveKey(secret, ephemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ephemeral, aesKey, nil
+}
+
+// unwrapECDH returns the AES key derived from the shared secret of priv and
+// the ephemeral public key of the metadata.
+func unwrapECDH(priv *ecdh.PrivateKey, ephemeral []byte) ([]byte, error) {
+	pub, err := priv.Curve().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("decoding ephemeral key: %v", err)
+	}
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("ecdh: %v", err)
+	}
+	return deriveKey(secret, ephemeral)
+}
+
+// deriveKey derives an AES-256 key from an ECDH shared secret and the
+// ephemeral public key it was agreed with.
+func deriveKey(secret, ephemeral []byte) ([]byte, error) {
+	key, err := hkdf.Key(newHash, secret, nil, hkdfInfo+string(ephemeral), 32)
+	if err != nil {
+		return nil, fmt.Errorf("hkdf: %v", err)
+	}
+	return key, nil
+}
+
+// open decrypts the metadata using the unwrapped AES key.
+func (m *Metadata) open(aesKey []byte) ([]byte, error) {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %s", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cipher.NewGCM: %s", err)
+	}
+
+	plaintext, err := aesgcm.Open(nil, m.Nonce, m.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("aesgcm.Open: %s", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+)
+
+func marshal(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKIXPublicKey returned %v", err)
+	}
+	return der
+}
+
+func TestEncryptRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned %v", err)
+	}
+	m := Metadata{Data: []byte("join metadata")}
+	if err := m.Encrypt(marshal(t, &key.PublicKey)); err != nil {
+		t.Fatalf("Encrypt returned %v", err)
+	}
+	aesKey, err := rsa.DecryptOAEP(newHash(), rng, key, m.AESKey, []byte(""))
+	if err != nil {
+		t.Fatalf("rsa.DecryptOAEP returned %v", err)
+	}
+	got, err := m.open(aesKey)
+	if err != nil || string(got) != "join metadata" {
+		t.Errorf("open() = %q, %v, want %q", got, err, "join metadata")
+	}
+}
+
+func TestEncryptEC(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		name := curve.Params().Name
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("%s: ecdsa.GenerateKey returned %v", name, err)
+		}
+		priv, err := key.ECDH()
+		if err != nil {
+			t.Fatalf("%s: ecdsa.PrivateKey.ECDH returned %v", name, err)
+		}
+		other, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("%s: ecdsa.GenerateKey returned %v", name, err)
+		}
+		otherPriv, err := other.ECDH()
+		if err != nil {
+			t.Fatalf("%s: ecdsa.PrivateKey.ECDH returned %v", name, err)
+		}
+
+		m := Metadata{Data: []byte("join metadata")}
+		if err := m.Encrypt(marshal(t, &key.PublicKey)); err != nil {
+			t.Fatalf("%s: Encrypt returned %v", name, err)
+		}
+		aesKey, err := unwrapECDH(priv, m.AESKey)
+		if err != nil {
+			t.Fatalf("%s: unwrapECDH returned %v", name, err)
+		}
+		got, err := m.open(aesKey)
+		if err != nil || string(got) != "join metadata" {
+			t.Errorf("%s: open() = %q, %v, want %q", name, got, err, "join metadata")
+		}
+
+		wrong, err := unwrapECDH(otherPriv, m.AESKey)
+		if err != nil {
+			t.Fatalf("%s: unwrapECDH with another key returned %v", name, err)
+		}
+		if _, err := m.open(wrong); err == nil {
+			t.Errorf("%s: open() with the key of another recipient succeeded", name)
+		}
+	}
+}
+
+func TestEncryptUnsupported(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned %v", err)
+	}
+	m := Metadata{Data: []byte("join metadata")}
+	if err := m.Encrypt(marshal(t, pub)); err == nil {
+		t.Errorf("Encrypt to an ed25519 key succeeded")
+	}
+	if err := m.Encrypt([]byte("not a key")); err == nil {
+		t.Errorf("Encrypt to an unparseable key succeeded")
+	}
+}
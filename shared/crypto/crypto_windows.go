@@ -1,3 +1,6 @@
+//go:build windows
+// +build windows
+
 /*
 Copyright 2019 Google LLC
 
@@ -14,22 +17,50 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// +build windows
-
 package crypto
 
 import (
 	"crypto"
-	"crypto/aes"
-	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
 	"crypto/rsa"
+	"encoding/binary"
 	"fmt"
+	"syscall"
+	"unsafe"
 
 	"github.com/google/certtostore"
 )
 
-// Decrypt decrypts a metadata blob using the host's private key.
-func (m *Metadata) Decrypt(privKey crypto.Decrypter) ([]byte, error) {
+const (
+	// Magic numbers of BCRYPT_ECCKEY_BLOB public key blobs.
+	ecdhP256Magic = 0x314B4345 // BCRYPT_ECDH_PUBLIC_P256_MAGIC
+	ecdhP384Magic = 0x334B4345 // BCRYPT_ECDH_PUBLIC_P384_MAGIC
+	ecdhP521Magic = 0x354B4345 // BCRYPT_ECDH_PUBLIC_P521_MAGIC
+)
+
+var (
+	ncrypt = syscall.MustLoadDLL("ncrypt.dll")
+
+	// Ref: https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptimportkey
+	nCryptImportKey = ncrypt.MustFindProc("NCryptImportKey")
+	// Ref: https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptsecretagreement
+	nCryptSecretAgreement = ncrypt.MustFindProc("NCryptSecretAgreement")
+	// Ref: https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptderivekey
+	nCryptDeriveKey = ncrypt.MustFindProc("NCryptDeriveKey")
+	// Ref: https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptgetproperty
+	nCryptGetProperty = ncrypt.MustFindProc("NCryptGetProperty")
+	// Ref: https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptfreeobject
+	nCryptFreeObject = ncrypt.MustFindProc("NCryptFreeObject")
+
+	eccPublicBlob          = syscall.StringToUTF16Ptr("ECCPUBLICBLOB")   // BCRYPT_ECCPUBLIC_BLOB
+	kdfRawSecret           = syscall.StringToUTF16Ptr("TRUNCATE")        // BCRYPT_KDF_RAW_SECRET
+	providerHandleProperty = syscall.StringToUTF16Ptr("Provider Handle") // NCRYPT_PROV_HANDLE
+)
+
+// Decrypt decrypts a metadata blob using the host's private key, which may be
+// a key in the certificate store or an RSA or ECDSA private key.
+func (m *Metadata) Decrypt(privKey crypto.PrivateKey) ([]byte, error) {
 	switch {
 	case m.AESKey == nil:
 		return nil, fmt.Errorf("AESKey missing")
@@ -44,6 +75,13 @@ func (m *Metadata) Decrypt(privKey crypto.Decrypter) ([]byte, error) {
 
 	switch k := privKey.(type) {
 	case *certtostore.Key:
+		if _, ok := k.Public().(*ecdsa.PublicKey); ok {
+			aesKey, err = unwrapNCrypt(k, m.AESKey)
+			if err != nil {
+				return nil, fmt.Errorf("unwrapNCrypt: %v", err)
+			}
+			break
+		}
 		opts := certtostore.DecrypterOpts{
 			Hashfunc: crypto.SHA256,
 			Flags:    certtostore.NCryptPadOAEPFlag,
@@ -57,24 +95,81 @@ func (m *Metadata) Decrypt(privKey crypto.Decrypter) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("DecryptOAEP: %s", err)
 		}
+	case *ecdsa.PrivateKey:
+		priv, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("ecdsa.PrivateKey.ECDH returned %v", err)
+		}
+		aesKey, err = unwrapECDH(priv, m.AESKey)
+		if err != nil {
+			return nil, fmt.Errorf("unwrapECDH: %v", err)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported key type %v", k)
 	}
 
 	// Continue decryption using the now decrypted AES key.
-	block, err := aes.NewCipher(aesKey)
+	return m.open(aesKey)
+}
+
+// unwrapNCrypt returns the AES key derived from the shared secret of a key
+// in the certificate store and the ephemeral public key of the metadata. The
+// key must permit key agreement, as keys of the ECDH algorithm group do.
+func unwrapNCrypt(k *certtostore.Key, ephemeral []byte) ([]byte, error) {
+	pub, err := k.Public().(*ecdsa.PublicKey).ECDH()
 	if err != nil {
-		return nil, fmt.Errorf("aes.NewCipher: %s", err)
+		return nil, fmt.Errorf("ecdsa.PublicKey.ECDH returned %v", err)
+	}
+	var magic uint32
+	switch pub.Curve() {
+	case ecdh.P256():
+		magic = ecdhP256Magic
+	case ecdh.P384():
+		magic = ecdhP384Magic
+	case ecdh.P521():
+		magic = ecdhP521Magic
+	}
+	if _, err := pub.Curve().NewPublicKey(ephemeral); err != nil {
+		return nil, fmt.Errorf("decoding ephemeral key: %v", err)
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("cipher.NewGCM: %s", err)
+	// BCRYPT_ECCKEY_BLOB holds the magic and coordinate size, followed by the
+	// coordinates of the uncompressed point without its 0x04 prefix.
+	size := (len(ephemeral) - 1) / 2
+	blob := binary.LittleEndian.AppendUint32(nil, magic)
+	blob = binary.LittleEndian.AppendUint32(blob, uint32(size))
+	blob = append(blob, ephemeral[1:]...)
+
+	// TransientTpmHandle returns the NCrypt handle of the key whatever its
+	// provider.
+	kh := k.TransientTpmHandle()
+	var ph uintptr
+	var n uint32
+	if r, _, _ := nCryptGetProperty.Call(kh, uintptr(unsafe.Pointer(providerHandleProperty)), uintptr(unsafe.Pointer(&ph)), unsafe.Sizeof(ph), uintptr(unsafe.Pointer(&n)), 0); r != 0 {
+		return nil, fmt.Errorf("NCryptGetProperty returned 0x%X", r)
 	}
+	defer nCryptFreeObject.Call(ph)
 
-	plaintext, err := aesgcm.Open(nil, m.Nonce, m.Data, nil)
-	if err != nil {
-		return nil, fmt.Errorf("aesgcm.Open: %s", err)
+	var eph uintptr
+	if r, _, _ := nCryptImportKey.Call(ph, 0, uintptr(unsafe.Pointer(eccPublicBlob)), 0, uintptr(unsafe.Pointer(&eph)), uintptr(unsafe.Pointer(&blob[0])), uintptr(len(blob)), 0); r != 0 {
+		return nil, fmt.Errorf("NCryptImportKey returned 0x%X", r)
+	}
+	defer nCryptFreeObject.Call(eph)
+
+	var sh uintptr
+	if r, _, _ := nCryptSecretAgreement.Call(kh, eph, uintptr(unsafe.Pointer(&sh)), 0); r != 0 {
+		return nil, fmt.Errorf("NCryptSecretAgreement returned 0x%X", r)
+	}
+	defer nCryptFreeObject.Call(sh)
+
+	secret := make([]byte, size)
+	if r, _, _ := nCryptDeriveKey.Call(sh, uintptr(unsafe.Pointer(kdfRawSecret)), 0, uintptr(unsafe.Pointer(&secret[0])), uintptr(len(secret)), uintptr(unsafe.Pointer(&n)), 0); r != 0 {
+		return nil, fmt.Errorf("NCryptDeriveKey returned 0x%X", r)
+	}
+	// BCRYPT_KDF_RAW_SECRET returns the secret in little-endian order.
+	secret = secret[:n]
+	for i, j := 0, len(secret)-1; i < j; i, j = i+1, j-1 {
+		secret[i], secret[j] = secret[j], secret[i]
 	}
-	return plaintext, nil
+	return deriveKey(secret, ephemeral)
 }
@@ -32,15 +32,21 @@ const (
 
 	// Flags from NetProvisionComputerAccount
 	netsetupProvisionReuseAccount = 0x00000002
+	netsetupProvisionRootCACerts  = 0x00000010
+	// Version of NETSETUP_PROVISIONING_PARAMS passed to NetCreateProvisioningPackage
+	netsetupProvisioningParamsWin8Version = 0x00000001
 	// Flags from NetRequestOfflineDomainJoin
 	netsetupProvisionOnlineCaller = 0x40000000
 
 	// Known error codes
 	errnoERROR_ACCESS_DENIED         = 5
 	errnoERROR_NOT_SUPPORTED         = 50
+	errnoERROR_BAD_NETPATH           = 53
 	errnoERROR_INVALID_PARAMETER     = 87
+	errnoERROR_NO_LOGON_SERVERS      = 1311
 	errnoERROR_INVALID_DOMAIN_ROLE   = 1354
 	errnoERROR_NO_SUCH_DOMAIN        = 1355
+	errnoRPC_S_SERVER_UNAVAILABLE    = 1722
 	errnoRPC_S_CALL_IN_PROGRESS      = 1791
 	errnoRPC_S_PROTSEQ_NOT_SUPPORTED = 1703
 	errnoNERR_DS8DCRequired          = 2720
@@ -62,8 +68,18 @@ var (
 	ErrNotSupported = errors.New("the request is not supported")
 	// ErrWorkstationSvc indicates that the workstation service has not been started
 	ErrWorkstationSvc = errors.New("the Workstation service has not been started")
+	// ErrUnreachable indicates that no connection to the domain controller could be made
+	ErrUnreachable = errors.New("the domain controller could not be reached")
 )
 
+// Transient reports whether err shows that the domain controller was never reached or
+// could not serve the domain, in which case provisioning may safely be retried against
+// another domain controller. Failures after the call reached a domain controller, such
+// as RPC_S_CALL_FAILED, are not transient, as the account may already have been created.
+func Transient(err error) bool {
+	return errors.Is(err, ErrUnreachable) || errors.Is(err, ErrNoSuchDomain)
+}
+
 // errnoErr converts errno return values from api calls into usable errors
 func errnoErr(e syscall.Errno) error {
 	switch e {
@@ -79,10 +95,21 @@ func errnoErr(e syscall.Errno) error {
 		return ErrExists
 	case errnoNERR_WkstaNotStarted:
 		return ErrWorkstationSvc
+	case errnoERROR_BAD_NETPATH, errnoERROR_NO_LOGON_SERVERS, errnoRPC_S_SERVER_UNAVAILABLE:
+		return ErrUnreachable
 	}
 	return e
 }
 
+// optionalUTF16Ptr converts s for an optional string parameter, which is
+// passed as NULL when s is empty.
+func optionalUTF16Ptr(s string) (*uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return syscall.UTF16PtrFromString(s)
+}
+
 var (
 	netapi32 = syscall.MustLoadDLL("Netapi32.dll")
 
@@ -90,6 +117,11 @@ var (
 	netProvisionComputerAccount = netapi32.MustFindProc("NetProvisionComputerAccount")
 	// Ref: https://msdn.microsoft.com/en-us/library/dd815229(v=vs.85).aspx
 	netRequestOfflineDomainJoin = netapi32.MustFindProc("NetRequestOfflineDomainJoin")
+	// Ref: https://learn.microsoft.com/en-us/windows/win32/api/lmjoin/nf-lmjoin-netcreateprovisioningpackage
+	// Only available from Windows 8 and Windows Server 2012.
+	netCreateProvisioningPackage, errNoPackages = netapi32.FindProc("NetCreateProvisioningPackage")
+	// Ref: https://learn.microsoft.com/en-us/windows/win32/api/lmapibuf/nf-lmapibuf-netapibufferfree
+	netAPIBufferFree = netapi32.MustFindProc("NetApiBufferFree")
 )
 
 // OfflineJoin uses provisioning metadata to conduct an offline domain join.
@@ -164,7 +196,10 @@ func TextData(hostname, domain string, reuse, djoinCompat bool) ([]byte, error)
 }
 
 // BinData produces provisioning data in binary form for use with the NetRequestOfflineDomainJoin function.
-func BinData(hostname string, domain string, reuse bool) ([]byte, error) {
+// The machine account is created in the OU with the distinguished name ou, or in the default computers
+// container if ou is empty, by the domain controller dc, or one chosen by Windows if dc is empty.
+// Errors for which Transient reports true may not occur against another domain controller.
+func BinData(hostname string, domain string, ou string, dc string, reuse bool) ([]byte, error) {
 	var binSize uint32
 	buff := make([]byte, buffSize)
 	ptrDomain, err := syscall.UTF16PtrFromString(domain)
@@ -175,6 +210,14 @@ func BinData(hostname string, domain string, reuse bool) ([]byte, error) {
 	if err != nil {
 		return buff, err
 	}
+	ptrOU, err := optionalUTF16Ptr(ou)
+	if err != nil {
+		return buff, err
+	}
+	ptrDC, err := optionalUTF16Ptr(dc)
+	if err != nil {
+		return buff, err
+	}
 
 	var dwOptions uintptr
 	if reuse {
@@ -184,16 +227,122 @@ func BinData(hostname string, domain string, reuse bool) ([]byte, error) {
 	r, _, err := netProvisionComputerAccount.Call(
 		uintptr(unsafe.Pointer(ptrDomain)),   //_In_      LPCWSTR lpDomain,
 		uintptr(unsafe.Pointer(ptrHostname)), //_In_      LPCWSTR lpMachineName,
-		0,                                    //_In_opt_  LPCWSTR lpMachineAccountOU,
-		0,                                    //_In_opt_  LPCWSTR lpDcName,
+		uintptr(unsafe.Pointer(ptrOU)),       //_In_opt_  LPCWSTR lpMachineAccountOU,
+		uintptr(unsafe.Pointer(ptrDC)),       //_In_opt_  LPCWSTR lpDcName,
 		dwOptions,                            //_In_      DWORD   dwOptions,
 		uintptr(unsafe.Pointer(&buff)),       //_Out_opt_ PBYTE   *pProvisionBinData,
 		uintptr(unsafe.Pointer(&binSize)),    //_Out_opt_ DWORD   *pdwProvisionBinDataSize,
 		0,                                    //_Out_opt_ LPWSTR  *pProvisionTextData
 	)
 	if r != 0 {
-		return buff[:binSize], fmt.Errorf("%v: Win32 error %d", errnoErr(syscall.Errno(r)), r)
+		return buff[:binSize], fmt.Errorf("%w: Win32 error %d", errnoErr(syscall.Errno(r)), r)
 	}
 
 	return buff[:binSize], nil
 }
+
+// PackageParams describes the machine account and the contents of a provisioning package.
+type PackageParams struct {
+	Hostname string
+	Domain   string
+	// OU is the distinguished name of the OU the account is created in, or empty for the
+	// default computers container.
+	OU string
+	// DC is the domain controller to provision against, or empty to let Windows choose one.
+	DC    string
+	Reuse bool
+	// CertTemplates lists the certificate templates the host enrolls with once joined.
+	CertTemplates []string
+	// Policies lists the names of the group policy objects applied to the host when it is joined.
+	Policies []string
+	// RootCerts embeds the root certificates of the domain in the package.
+	RootCerts bool
+}
+
+// provisioningParams mirrors the Windows 8 version of NETSETUP_PROVISIONING_PARAMS.
+type provisioningParams struct {
+	version                uint32
+	domain                 *uint16
+	hostName               *uint16
+	machineAccountOU       *uint16
+	dcName                 *uint16
+	provisionOptions       uint32
+	certTemplateNames      **uint16
+	certTemplateNameCount  uint32
+	machinePolicyNames     **uint16
+	machinePolicyNameCount uint32
+	machinePolicyPaths     **uint16
+	machinePolicyPathCount uint32
+}
+
+// utf16PtrArray converts list for a parameter taking an array of strings, which is passed
+// as NULL when list is empty.
+func utf16PtrArray(list []string) (**uint16, uint32, error) {
+	if len(list) == 0 {
+		return nil, 0, nil
+	}
+	ptrs := make([]*uint16, len(list))
+	for i, s := range list {
+		p, err := syscall.UTF16PtrFromString(s)
+		if err != nil {
+			return nil, 0, err
+		}
+		ptrs[i] = p
+	}
+	return &ptrs[0], uint32(len(ptrs)), nil
+}
+
+// Package produces a provisioning package in binary form for use with the
+// NetRequestOfflineDomainJoin function. Unlike BinData, the package may carry certificate
+// templates, group policies and the root certificates of the domain. ErrNotSupported is
+// returned on versions of Windows that cannot create provisioning packages. Errors for
+// which Transient reports true may not occur against another domain controller.
+func Package(p PackageParams) ([]byte, error) {
+	if errNoPackages != nil {
+		return nil, fmt.Errorf("%w: NetCreateProvisioningPackage: %v", ErrNotSupported, errNoPackages)
+	}
+
+	var params provisioningParams
+	params.version = netsetupProvisioningParamsWin8Version
+	var err error
+	if params.domain, err = syscall.UTF16PtrFromString(p.Domain); err != nil {
+		return nil, err
+	}
+	if params.hostName, err = syscall.UTF16PtrFromString(p.Hostname); err != nil {
+		return nil, err
+	}
+	if params.machineAccountOU, err = optionalUTF16Ptr(p.OU); err != nil {
+		return nil, err
+	}
+	if params.dcName, err = optionalUTF16Ptr(p.DC); err != nil {
+		return nil, err
+	}
+	if params.certTemplateNames, params.certTemplateNameCount, err = utf16PtrArray(p.CertTemplates); err != nil {
+		return nil, err
+	}
+	if params.machinePolicyNames, params.machinePolicyNameCount, err = utf16PtrArray(p.Policies); err != nil {
+		return nil, err
+	}
+	if p.Reuse {
+		params.provisionOptions |= netsetupProvisionReuseAccount
+	}
+	if p.RootCerts {
+		params.provisionOptions |= netsetupProvisionRootCACerts
+	}
+
+	var data *byte
+	var size uint32
+	r, _, _ := netCreateProvisioningPackage.Call(
+		uintptr(unsafe.Pointer(&params)), //_In_      PNETSETUP_PROVISIONING_PARAMS pProvisioningParams,
+		uintptr(unsafe.Pointer(&data)),   //_Out_opt_ PBYTE                         *ppPackageBinData,
+		uintptr(unsafe.Pointer(&size)),   //_Out_opt_ DWORD                         *pdwPackageBinDataSize,
+		0,                                //_Out_opt_ LPWSTR                        *ppPackageTextData
+	)
+	if r != 0 {
+		return nil, fmt.Errorf("%w: Win32 error %d", errnoErr(syscall.Errno(r)), r)
+	}
+	defer netAPIBufferFree.Call(uintptr(unsafe.Pointer(data)))
+
+	// The package is allocated by Windows, so it is copied before being freed.
+	return append([]byte(nil), unsafe.Slice(data, size)...), nil
+}
@@ -0,0 +1,58 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioning
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestErrnoErr(t *testing.T) {
+	tests := []struct {
+		desc      string
+		in        syscall.Errno
+		want      error
+		transient bool
+	}{
+		{"access denied", errnoERROR_ACCESS_DENIED, ErrAccessDenied, false},
+		{"not supported", errnoERROR_NOT_SUPPORTED, ErrNotSupported, false},
+		{"bad netpath", errnoERROR_BAD_NETPATH, ErrUnreachable, true},
+		{"invalid parameter", errnoERROR_INVALID_PARAMETER, ErrInvalidParameter, false},
+		{"no logon servers", errnoERROR_NO_LOGON_SERVERS, ErrUnreachable, true},
+		{"no such domain", errnoERROR_NO_SUCH_DOMAIN, ErrNoSuchDomain, true},
+		{"server unavailable", errnoRPC_S_SERVER_UNAVAILABLE, ErrUnreachable, true},
+		{"user exists", errnoNERR_UserExists, ErrExists, false},
+		{"workstation service", errnoNERR_WkstaNotStarted, ErrWorkstationSvc, false},
+		{"call failed", syscall.Errno(1726), syscall.Errno(1726), false},
+		{"call in progress", errnoRPC_S_CALL_IN_PROGRESS, syscall.Errno(errnoRPC_S_CALL_IN_PROGRESS), false},
+	}
+	for _, tt := range tests {
+		got := errnoErr(tt.in)
+		if !errors.Is(got, tt.want) {
+			t.Errorf("%s: errnoErr(%d) = %v, want %v", tt.desc, tt.in, got, tt.want)
+		}
+		wrapped := fmt.Errorf("NetCreateProvisioningPackage: %w", got)
+		if transient := Transient(wrapped); transient != tt.transient {
+			t.Errorf("%s: Transient(%v) = %t, want %t", tt.desc, wrapped, transient, tt.transient)
+		}
+	}
+}
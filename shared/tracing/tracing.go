@@ -0,0 +1,176 @@
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing follows a join request across the CLI, the App, Pub/Sub
+// and SpliceD with OpenTelemetry spans.
+//
+// The trace context travels between components in the W3C Trace Context
+// format: in HTTP headers from the CLI to the App, and in message attributes
+// from the App to SpliceD through Pub/Sub. Each component exports its own
+// spans as selected by a Config.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone disables exporting spans. The trace context is still
+	// propagated, so that downstream components can export their spans.
+	ExporterNone = "none"
+	// ExporterStdout writes spans to standard output as JSON.
+	ExporterStdout = "stdout"
+	// ExporterFile appends spans to the file at Config.Path as JSON.
+	ExporterFile = "file"
+
+	// RequestIDKey is the span attribute holding the ID of a join request.
+	RequestIDKey = attribute.Key("splice.request_id")
+
+	// tracerName names the tracer of all Splice components.
+	tracerName = "github.com/google/splice"
+)
+
+var (
+	// ErrExporter is wrapped by the errors returned for invalid exporter
+	// configurations.
+	ErrExporter = errors.New("invalid trace exporter")
+
+	// propagator carries the trace context between components.
+	propagator = propagation.TraceContext{}
+)
+
+// Config selects where a component exports its spans.
+type Config struct {
+	// Service names the component in exported spans, such as splice-cli.
+	Service string
+	// Exporter is one of the Exporter constants. An empty Exporter is
+	// treated as ExporterNone.
+	Exporter string
+	// Path is the file spans are appended to by ExporterFile.
+	Path string
+}
+
+// Validate checks that c selects a supported exporter.
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case "", ExporterNone, ExporterStdout:
+		return nil
+	case ExporterFile:
+		if c.Path == "" {
+			return fmt.Errorf("%w: a path is required for the %s exporter", ErrExporter, ExporterFile)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %q is not one of %s, %s or %s", ErrExporter, c.Exporter, ExporterNone, ExporterStdout, ExporterFile)
+}
+
+// Init installs the global tracer provider for conf. It returns a func that
+// flushes any pending spans and stops the exporter, which must be called
+// before the component exits.
+func Init(conf Config) (func(context.Context) error, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	var w io.Writer
+	closer := func() error { return nil }
+	switch conf.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		w = os.Stdout
+	case ExporterFile:
+		f, err := os.OpenFile(conf.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Init: opening trace file: %v", err)
+		}
+		w, closer = f, f.Close
+	}
+
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		closer()
+		return nil, fmt.Errorf("Init: creating exporter: %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", conf.Service))),
+	)
+	otel.SetTracerProvider(tp)
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if cerr := closer(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span named name as a child of any span in ctx. If reqID is
+// not empty, the span is annotated with the request ID.
+func Start(ctx context.Context, name, reqID string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if reqID != "" {
+		opts = append(opts, trace.WithAttributes(RequestIDKey.String(reqID)))
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End ends span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject writes the trace context of ctx to carrier.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+// Extract returns a copy of ctx carrying the trace context read from
+// carrier, if any.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+// Attributes returns the trace context of ctx as a set of message
+// attributes.
+func Attributes(ctx context.Context) map[string]string {
+	attrs := make(map[string]string)
+	Inject(ctx, propagation.MapCarrier(attrs))
+	return attrs
+}
+
+// FromAttributes returns a copy of ctx carrying the trace context read from
+// the message attributes attrs, if any.
+func FromAttributes(ctx context.Context, attrs map[string]string) context.Context {
+	return Extract(ctx, propagation.MapCarrier(attrs))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		in Config
+		ok bool
+	}{
+		{Config{}, true},
+		{Config{Exporter: ExporterNone}, true},
+		{Config{Exporter: ExporterStdout}, true},
+		{Config{Exporter: ExporterFile, Path: "spans.json"}, true},
+		{Config{Exporter: ExporterFile}, false},
+		{Config{Exporter: "jaeger"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.in.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%+v.Validate() = %v, want ok %t", tt.in, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrExporter) {
+			t.Errorf("%+v.Validate() = %v, want ErrExporter", tt.in, err)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+
+	attrs := Attributes(ctx)
+	if _, ok := attrs["traceparent"]; !ok {
+		t.Fatalf("Attributes() = %v, want a traceparent", attrs)
+	}
+	got := trace.SpanContextFromContext(Extract(context.Background(), propagation.MapCarrier(attrs)))
+	if got.TraceID() != parent.TraceID() || got.SpanID() != parent.SpanID() {
+		t.Errorf("Extract(Attributes()) = %v, want %v", got, parent)
+	}
+}
+
+func TestInitFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Init(Config{Service: "splice-test", Exporter: ExporterFile, Path: path})
+	if err != nil {
+		t.Fatalf("Init() returned %v", err)
+	}
+
+	ctx, parent := Start(context.Background(), "parent", "")
+	_, child := Start(ctx, "child", "req1")
+	End(child, errors.New("join failed"))
+	End(parent, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() returned %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) returned %v", path, err)
+	}
+	for _, want := range []string{`"Name":"parent"`, `"Name":"child"`, `"splice.request_id"`, `"req1"`, `"join failed"`, `"splice-test"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("exported spans %s do not contain %s", b, want)
+		}
+	}
+}
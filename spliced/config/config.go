@@ -0,0 +1,364 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config loads the SpliceD configuration from a layered set of
+// sources, such as the registry, a JSON or YAML file and the environment, and
+// reloads it while SpliceD runs.
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/splice/generators"
+	"github.com/google/splice/shared/tracing"
+	"github.com/google/splice/spliced/joiner"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultWorkers is the number of concurrent workers used when none are configured.
+const DefaultWorkers = 1
+
+var (
+	// ErrInvalid is wrapped by the errors returned for invalid configurations.
+	ErrInvalid = errors.New("invalid configuration")
+
+	// EnvPrefix prefixes the names of the environment variables read by Env.
+	EnvPrefix = "SPLICED_"
+)
+
+// Defaults returns the settings used for keys that are not set by any source.
+func Defaults() joiner.Config {
+	return joiner.Config{
+		EncryptBlob:  true,
+		VerifyCert:   true,
+		Workers:      DefaultWorkers,
+		LaneFairness: joiner.DefaultLaneFairness,
+	}
+}
+
+// Validate checks conf against the rules enforced by the configure command.
+// It holds for partial configurations, in which unset keys are left empty.
+func Validate(conf joiner.Config) error {
+	if conf.VerifyCert && conf.CaURL == "" && conf.RootsPath == "" {
+		return fmt.Errorf("%w: ca_root_url or roots_path is required when verify_certs=%t", ErrInvalid, conf.VerifyCert)
+	}
+	if conf.Workers < 0 {
+		return fmt.Errorf("%w: workers must not be negative, got %d", ErrInvalid, conf.Workers)
+	}
+	if !conf.VerifyCert && (conf.CaURL != "" || conf.CaURLPath != "" || conf.CaOrg != "") {
+		return fmt.Errorf("%w: ca_root_url, ca_cert_path and ca_cert_org are not required when verify_certs=%t", ErrInvalid, conf.VerifyCert)
+	}
+	if conf.LaneFairness < 0 {
+		return fmt.Errorf("%w: lane_fairness must not be negative, got %d", ErrInvalid, conf.LaneFairness)
+	}
+	if conf.HealthAddr != "" {
+		if err := validateLoopback(conf.HealthAddr); err != nil {
+			return fmt.Errorf("%w: health_addr: %v", ErrInvalid, err)
+		}
+	}
+	if err := TraceConfig(conf).Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := validateOUs(conf.AllowedOUs); err != nil {
+		return fmt.Errorf("%w: allowed_ous: %v", ErrInvalid, err)
+	}
+	if err := validateControllers(conf.DomainControllers); err != nil {
+		return fmt.Errorf("%w: domain_controllers: %v", ErrInvalid, err)
+	}
+	seen := map[string]bool{strings.ToLower(conf.Domain): true}
+	for d, dc := range conf.Domains {
+		if d == "" {
+			return fmt.Errorf("%w: domains must be named", ErrInvalid)
+		}
+		if seen[strings.ToLower(d)] {
+			return fmt.Errorf("%w: domain %s is configured more than once", ErrInvalid, d)
+		}
+		seen[strings.ToLower(d)] = true
+		if err := validateOUs(dc.AllowedOUs); err != nil {
+			return fmt.Errorf("%w: domain %s: allowed_ous: %v", ErrInvalid, d, err)
+		}
+		if err := validateControllers(dc.DomainControllers); err != nil {
+			return fmt.Errorf("%w: domain %s: domain_controllers: %v", ErrInvalid, d, err)
+		}
+	}
+	return nil
+}
+
+// validateControllers checks that the domain controllers of every site are
+// named, and that no site is listed twice.
+func validateControllers(sites map[string][]string) error {
+	seen := make(map[string]bool)
+	for site, dcs := range sites {
+		if site == "" {
+			return errors.New("sites must be named")
+		}
+		if seen[strings.ToLower(site)] {
+			return fmt.Errorf("site %s is listed more than once", site)
+		}
+		seen[strings.ToLower(site)] = true
+		for _, dc := range dcs {
+			if strings.TrimSpace(dc) == "" {
+				return fmt.Errorf("site %s lists an unnamed domain controller", site)
+			}
+		}
+	}
+	return nil
+}
+
+// validateOUs checks that every entry of ous is a distinguished name.
+func validateOUs(ous []string) error {
+	for _, ou := range ous {
+		for _, rdn := range strings.Split(ou, ",") {
+			if k, v, ok := strings.Cut(rdn, "="); !ok || strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
+				return fmt.Errorf("%q is not a distinguished name", ou)
+			}
+		}
+	}
+	return nil
+}
+
+// TraceConfig returns the tracing configuration of SpliceD held by conf.
+func TraceConfig(conf joiner.Config) tracing.Config {
+	return tracing.Config{Service: "spliced", Exporter: conf.TraceExporter, Path: conf.TraceFile}
+}
+
+// validateLoopback checks that addr is a host:port address on the loopback
+// interface, as the health listener must not be reachable from other hosts.
+func validateLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%q is not a loopback address", host)
+	}
+	return nil
+}
+
+// validateComplete checks that conf is valid and holds every setting that
+// SpliceD requires to run.
+func validateComplete(conf joiner.Config) error {
+	for _, r := range []struct{ key, value string }{
+		{"domain", conf.Domain},
+		{"instance", conf.Instance},
+		{"project", conf.ProjectID},
+		{"topic", conf.Topic},
+	} {
+		if r.value == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalid, r.key)
+		}
+	}
+	return Validate(conf)
+}
+
+// Source supplies configuration settings. A source only sets the keys it
+// holds, and leaves all others as they are.
+type Source interface {
+	// Name describes the source in log messages.
+	Name() string
+	// Load sets the keys held by the source in conf.
+	Load(conf *joiner.Config) error
+}
+
+// file implements Source for a configuration file.
+type file string
+
+// File returns a Source reading the configuration file at path. Files named
+// with a .yaml or .yml extension are parsed as YAML, and all others as JSON.
+// Keys are named as in the registry, and unknown keys are rejected.
+func File(path string) Source {
+	return file(path)
+}
+
+func (f file) Name() string {
+	return string(f)
+}
+
+func (f file) Load(conf *joiner.Config) error {
+	b, err := os.ReadFile(string(f))
+	if err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(string(f))) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(conf); err != nil {
+			return fmt.Errorf("parsing YAML config file %s: %v", f, err)
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(conf); err != nil {
+			return fmt.Errorf("parsing JSON config file %s: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// env implements Source for environment variables.
+type env func(string) (string, bool)
+
+// Env returns a Source reading each key from the environment variable named
+// by EnvPrefix and the upper-cased key, for example SPLICED_PERMIT_REUSE.
+// Lists are separated by semicolons, as their entries may contain commas.
+// lookup is typically os.LookupEnv.
+func Env(lookup func(string) (string, bool)) Source {
+	return env(lookup)
+}
+
+func (e env) Name() string {
+	return "environment"
+}
+
+func (e env) Load(conf *joiner.Config) error {
+	v := reflect.ValueOf(conf).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("json")
+		name := EnvPrefix + strings.ToUpper(key)
+		raw, ok := e(name)
+		if !ok {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(raw)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a boolean", name, raw)
+			}
+			f.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not an integer", name, raw)
+			}
+			f.SetInt(int64(n))
+		case reflect.Slice:
+			if f.Type().Elem().Kind() != reflect.String {
+				return fmt.Errorf("%s: unsupported setting type %s", name, f.Type())
+			}
+			var list []string
+			for _, s := range strings.Split(raw, ";") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+			f.Set(reflect.ValueOf(list))
+		default:
+			return fmt.Errorf("%s: unsupported setting type %s", name, f.Kind())
+		}
+	}
+	return nil
+}
+
+// Loader assembles a configuration from a list of sources.
+type Loader struct {
+	sources []Source
+}
+
+// NewLoader returns a Loader for sources. Later sources override the keys
+// set by earlier ones.
+func NewLoader(sources ...Source) *Loader {
+	return &Loader{sources: sources}
+}
+
+// Load applies every source in order on top of Defaults, and validates the
+// result.
+func (l *Loader) Load() (joiner.Config, error) {
+	conf := Defaults()
+	for _, s := range l.sources {
+		if err := s.Load(&conf); err != nil {
+			return joiner.Config{}, fmt.Errorf("loading configuration from %s: %w", s.Name(), err)
+		}
+	}
+	if conf.Workers == 0 {
+		conf.Workers = DefaultWorkers
+	}
+	if conf.LaneFairness == 0 {
+		conf.LaneFairness = joiner.DefaultLaneFairness
+	}
+	if err := validateComplete(conf); err != nil {
+		return joiner.Config{}, err
+	}
+	return conf, nil
+}
+
+// Watch reloads the configuration every interval until ctx is cancelled, and
+// applies it to j. Generators are reconfigured on every reload, so that
+// changes to their settings are picked up as well. A configuration that fails
+// to load or validate is logged and ignored, leaving j as it was.
+func (l *Loader) Watch(ctx context.Context, interval time.Duration, j *joiner.Joiner, log joiner.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := j.Config()
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := l.reload(j, &last, log)
+		if err == nil {
+			err = generators.ConfigureAll()
+		}
+		// Report each problem once, rather than on every reload.
+		switch {
+		case err != nil && err.Error() != lastErr:
+			log.Errorf(joiner.EvtErrConfiguration, "Configuration was not reloaded: %v", err)
+			lastErr = err.Error()
+		case err == nil && lastErr != "":
+			log.Infof(joiner.EvtConfiguration, "Configuration reloaded successfully.")
+			lastErr = ""
+		}
+	}
+}
+
+// reload loads the configuration and applies it to j if it differs from
+// last, which is updated to match.
+func (l *Loader) reload(j *joiner.Joiner, last *joiner.Config, log joiner.Logger) error {
+	conf, err := l.Load()
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(conf, *last) {
+		return nil
+	}
+	*last = conf
+	restart := j.Reconfigure(conf)
+	log.Infof(joiner.EvtConfiguration, "Configuration reloaded. Encrypt blob: %t, verify certs: %t, CA URL: %q, CA URL path: %q, CA expected org: %q, roots path: %q, permit reuse: %t.",
+		conf.EncryptBlob, conf.VerifyCert, conf.CaURL, conf.CaURLPath, conf.CaOrg, conf.RootsPath, conf.PermitReuse)
+	if len(restart) > 0 {
+		log.Warningf(joiner.EvtConfiguration, "Changes to %s only apply after SpliceD is restarted.", strings.Join(restart, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/splice/spliced/joiner"
+	spltesting "github.com/google/splice/spliced/testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile(%s) returned %v", path, err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   joiner.Config
+		ok   bool
+	}{
+		{"verify with CA URL", joiner.Config{VerifyCert: true, CaURL: "https://ca.example.com"}, true},
+		{"verify with roots", joiner.Config{VerifyCert: true, RootsPath: `C:\roots.pem`}, true},
+		{"verify without roots", joiner.Config{VerifyCert: true}, false},
+		{"no verify with CA org", joiner.Config{CaOrg: "Example"}, false},
+		{"negative workers", joiner.Config{Workers: -1}, false},
+		{"negative lane fairness", joiner.Config{LaneFairness: -1}, false},
+		{"no verify", joiner.Config{}, true},
+		{"health on loopback", joiner.Config{HealthAddr: "127.0.0.1:9464"}, true},
+		{"health on localhost", joiner.Config{HealthAddr: "localhost:9464"}, true},
+		{"health on all interfaces", joiner.Config{HealthAddr: ":9464"}, false},
+		{"health without port", joiner.Config{HealthAddr: "127.0.0.1"}, false},
+		{"trace to file", joiner.Config{TraceExporter: "file", TraceFile: `C:\spans.json`}, true},
+		{"trace to file without path", joiner.Config{TraceExporter: "file"}, false},
+		{"unknown trace exporter", joiner.Config{TraceExporter: "zipkin"}, false},
+		{"additional domain", joiner.Config{Domain: "example.com", Domains: map[string]joiner.DomainConfig{"lab.example.com": {}}}, true},
+		{"default domain repeated", joiner.Config{Domain: "example.com", Domains: map[string]joiner.DomainConfig{"EXAMPLE.com": {}}}, false},
+		{"unnamed domain", joiner.Config{Domain: "example.com", Domains: map[string]joiner.DomainConfig{"": {}}}, false},
+		{"allowed OU", joiner.Config{AllowedOUs: []string{"OU=Lab, DC=example,DC=com"}}, true},
+		{"malformed OU", joiner.Config{AllowedOUs: []string{"Lab"}}, false},
+		{"domain controllers", joiner.Config{DomainControllers: map[string][]string{"hq": {"dc1"}, joiner.AnySite: {"dc2"}}}, true},
+		{"site listed twice", joiner.Config{DomainControllers: map[string][]string{"hq": {"dc1"}, "HQ": {"dc2"}}}, false},
+		{"unnamed domain controller", joiner.Config{Domain: "example.com", Domains: map[string]joiner.DomainConfig{"lab.example.com": {DomainControllers: map[string][]string{"hq": {""}}}}}, false},
+		{"malformed domain OU", joiner.Config{Domain: "example.com", Domains: map[string]joiner.DomainConfig{"lab.example.com": {AllowedOUs: []string{"OU=Lab,"}}}}, false},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v, want ok %t", tt.desc, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Validate() = %v, want ErrInvalid", tt.desc, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	base := joiner.Config{
+		Domain:       "example.com",
+		Instance:     "joiner1",
+		ProjectID:    "project",
+		Topic:        "topic",
+		EncryptBlob:  true,
+		VerifyCert:   false,
+		Workers:      1,
+		LaneFairness: joiner.DefaultLaneFairness,
+	}
+	json := `{"domain": "example.com", "instance": "joiner1", "project": "project", "topic": "topic", "verify_certs": false}`
+	yaml := "domain: example.com\ninstance: joiner1\nproject: project\ntopic: topic\nverify_certs: false\nworkers: 4\n"
+	envs := func(m map[string]string) Source {
+		return Env(func(k string) (string, bool) {
+			v, ok := m[k]
+			return v, ok
+		})
+	}
+
+	withWorkers := base
+	withWorkers.Workers = 4
+	withReuse := base
+	withReuse.PermitReuse = true
+	withReuse.Topic = "other"
+	withLanes := base
+	withLanes.PriorityTopic = "attended"
+	withLanes.LaneFairness = 2
+	withOUs := base
+	withOUs.AllowedOUs = []string{"OU=Lab,DC=example,DC=com", "OU=Kiosks,DC=example,DC=com"}
+	withPackage := base
+	withPackage.CertTemplate = "Workstation"
+	withPackage.Policies = []string{"Baseline", "Lab Policy"}
+	withPackage.RootCerts = true
+
+	tests := []struct {
+		desc    string
+		sources []Source
+		want    joiner.Config
+		wantErr bool
+	}{
+		{"JSON", []Source{File(writeFile(t, "c.json", json))}, base, false},
+		{"YAML", []Source{File(writeFile(t, "c.yaml", yaml))}, withWorkers, false},
+		{
+			"environment overrides file",
+			[]Source{File(writeFile(t, "c.json", json)), envs(map[string]string{"SPLICED_PERMIT_REUSE": "true", "SPLICED_TOPIC": "other"})},
+			withReuse, false,
+		},
+		{
+			"priority lane from environment",
+			[]Source{File(writeFile(t, "c.json", json)), envs(map[string]string{"SPLICED_PRIORITY_TOPIC": "attended", "SPLICED_LANE_FAIRNESS": "2"})},
+			withLanes, false,
+		},
+		{
+			"allowed OUs from environment",
+			[]Source{File(writeFile(t, "c.json", json)), envs(map[string]string{"SPLICED_ALLOWED_OUS": "OU=Lab,DC=example,DC=com; OU=Kiosks,DC=example,DC=com"})},
+			withOUs, false,
+		},
+		{
+			"provisioning package from environment",
+			[]Source{File(writeFile(t, "c.json", json)), envs(map[string]string{"SPLICED_CERT_TEMPLATE": "Workstation", "SPLICED_POLICIES": "Baseline;Lab Policy", "SPLICED_ROOT_CERTS": "true"})},
+			withPackage, false,
+		},
+		{"missing required key", []Source{File(writeFile(t, "c.json", `{"domain": "example.com"}`))}, joiner.Config{}, true},
+		{"unknown key", []Source{File(writeFile(t, "c.yaml", yaml+"reuse: true\n"))}, joiner.Config{}, true},
+		{"missing file", []Source{File(filepath.Join(t.TempDir(), "missing.json"))}, joiner.Config{}, true},
+		{"fails validation", []Source{File(writeFile(t, "c.json", json)), envs(map[string]string{"SPLICED_VERIFY_CERTS": "1"})}, joiner.Config{}, true},
+		{"malformed environment", []Source{File(writeFile(t, "c.json", json)), envs(map[string]string{"SPLICED_WORKERS": "many"})}, joiner.Config{}, true},
+	}
+	for _, tt := range tests {
+		got, err := NewLoader(tt.sources...).Load()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Load() returned %v, want error %t", tt.desc, err, tt.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: Load() returned diff (-want +got):\n%s", tt.desc, diff)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile(%s) returned %v", path, err)
+		}
+	}
+	const required = "domain: example.com\ninstance: joiner1\nproject: project\n"
+	write(required + "topic: topic\nverify_certs: false\n")
+
+	l := NewLoader(File(path))
+	conf, err := l.Load()
+	if err != nil {
+		t.Fatalf("Load() returned %v", err)
+	}
+	logger := spltesting.Logger{Logf: t.Logf}
+	j := joiner.New(conf, nil, nil, nil, logger, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Watch(ctx, time.Millisecond, j, logger)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	await := func(desc string, ok func(joiner.Config) bool) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for !ok(j.Config()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: config = %+v", desc, j.Config())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// An invalid configuration is ignored.
+	write(required + "topic: topic\nverify_certs: false\npermit_reuse: true\nca_cert_org: Example\n")
+	time.Sleep(20 * time.Millisecond)
+	if j.Config().PermitReuse {
+		t.Errorf("invalid configuration was applied: %+v", j.Config())
+	}
+
+	// Reuse, CA and domain settings apply while running, but the topic only
+	// applies after a restart.
+	write(required + "permit_reuse: true\nverify_certs: true\nca_root_url: https://ca.example.com\ntopic: other\ndomains:\n  lab.example.com:\n    permit_reuse: true\n")
+	await("reuse, CA and domain settings", func(c joiner.Config) bool {
+		_, lab, ok := c.Lookup("lab.example.com")
+		return c.PermitReuse && c.VerifyCert && c.CaURL == "https://ca.example.com" && ok && lab.PermitReuse
+	})
+	if got := j.Config().Topic; got != "topic" {
+		t.Errorf("Topic = %q after reload, want topic", got)
+	}
+}
@@ -18,7 +18,10 @@ package main
 
 import (
 	"flag"
-	"fmt"
+	"strings"
+
+	"github.com/google/splice/spliced/config"
+	"github.com/google/splice/spliced/joiner"
 )
 
 var (
@@ -37,6 +40,15 @@ var (
 	fVerifyCertsCAOrg    = cFlags.String("ca_cert_org", "", "The expected issuing organization for the root certificate. Optional if verify_certs=true.")
 	fRootsPath           = cFlags.String("roots_path", "", "The path to a pemfile containing the roots to be used for certificate verification. Optional if verify_certs=true.")
 	fPermitReuse         = cFlags.Bool("permit_reuse", false, "Permit SpliceD to attempt to reuse existing domain accounts.")
+	fWorkers             = cFlags.Int("workers", 0, "The number of join requests SpliceD may process concurrently. Defaults to 1.")
+	fHealthAddr          = cFlags.String("health_addr", "", "The loopback address, such as 127.0.0.1:9464, on which to serve health and metrics endpoints. Optional.")
+	fTraceExporter       = cFlags.String("trace_exporter", "", "Where to export trace spans: none, stdout or file. Optional.")
+	fTraceFile           = cFlags.String("trace_file", "", "The file trace spans are appended to when trace_exporter=file.")
+	fPriorityTopic       = cFlags.String("priority_topic", "", "The Pub/Sub subscription holding higher-priority requests, such as attended joins. Optional.")
+	fLaneFairness        = cFlags.Int("lane_fairness", 0, "How many higher-priority requests may be handed to workers in a row while lower-priority requests wait. Defaults to 4.")
+	fAllowedOUs          = cFlags.String("allowed_ous", "", "A semicolon separated list of the distinguished names of the OUs requests may create machine accounts in. Optional.")
+	fSite                = cFlags.String("site", "", "The Active Directory site of this host, which selects its preferred domain controllers. Optional.")
+	fConfigFile          = cFlags.String("config_file", "", "The path to a JSON or YAML configuration file whose settings override the registry. Optional.")
 )
 
 func boolToUint32(b bool) uint32 {
@@ -46,15 +58,34 @@ func boolToUint32(b bool) uint32 {
 	return 0
 }
 
+// splitOUs splits a semicolon separated list of distinguished names.
+func splitOUs(list string) []string {
+	var ous []string
+	for _, ou := range strings.Split(list, ";") {
+		if ou = strings.TrimSpace(ou); ou != "" {
+			ous = append(ous, ou)
+		}
+	}
+	return ous
+}
+
 // Update updates the app configuration with new settings from the command line.
 func Update(args []string) error {
 	cFlags.Parse(args)
-	if *fVerifyCerts && *fVerifyCertsRootURL == "" && *fRootsPath == "" {
-		return fmt.Errorf("ca_root_url or roots_path is required when verify_certs=%t", *fVerifyCerts)
-	}
-
-	if !*fVerifyCerts && (*fVerifyCertsRootURL != "" || *fVerifyCertsRootPath != "" || *fVerifyCertsCAOrg != "") {
-		return fmt.Errorf("ca_root_url, ca_cert_path and ca_cert_org are not required when verify_certs=%t", *fVerifyCerts)
+	if err := config.Validate(joiner.Config{
+		VerifyCert:    *fVerifyCerts,
+		CaURL:         *fVerifyCertsRootURL,
+		CaURLPath:     *fVerifyCertsRootPath,
+		CaOrg:         *fVerifyCertsCAOrg,
+		RootsPath:     *fRootsPath,
+		Workers:       *fWorkers,
+		HealthAddr:    *fHealthAddr,
+		TraceExporter: *fTraceExporter,
+		TraceFile:     *fTraceFile,
+		LaneFairness:  *fLaneFairness,
+		AllowedOUs:    splitOUs(*fAllowedOUs),
+	}); err != nil {
+		return err
 	}
 
 	if *fDomain != "" {
@@ -104,5 +135,59 @@ func Update(args []string) error {
 		}
 	}
 
+	if *fWorkers > 0 {
+		if err := setDWordValue("workers", uint32(*fWorkers)); err != nil {
+			return err
+		}
+	}
+
+	if *fHealthAddr != "" {
+		if err := setStringValue("health_addr", *fHealthAddr); err != nil {
+			return err
+		}
+	}
+
+	if *fTraceExporter != "" {
+		if err := setStringValue("trace_exporter", *fTraceExporter); err != nil {
+			return err
+		}
+	}
+
+	if *fTraceFile != "" {
+		if err := setStringValue("trace_file", *fTraceFile); err != nil {
+			return err
+		}
+	}
+
+	if *fPriorityTopic != "" {
+		if err := setStringValue("priority_topic", *fPriorityTopic); err != nil {
+			return err
+		}
+	}
+
+	if *fLaneFairness > 0 {
+		if err := setDWordValue("lane_fairness", uint32(*fLaneFairness)); err != nil {
+			return err
+		}
+	}
+
+	if *fAllowedOUs != "" {
+		if err := setStringsValue("allowed_ous", splitOUs(*fAllowedOUs)); err != nil {
+			return err
+		}
+	}
+
+	if *fSite != "" {
+		if err := setStringValue("site", *fSite); err != nil {
+			return err
+		}
+	}
+
+	if *fConfigFile != "" {
+		if err := setStringValue("config_file", *fConfigFile); err != nil {
+			return err
+		}
+	}
+
 	return setDWordValue("permit_reuse", boolToUint32(*fPermitReuse))
 }
@@ -0,0 +1,320 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health serves the local health, readiness, status and metrics
+// endpoints of SpliceD to monitoring agents running on the same host.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/splice/spliced/joiner"
+	"github.com/google/splice/spliced/metric/tracker"
+)
+
+const (
+	// metricPrefix prefixes the names of all exported metrics.
+	metricPrefix = "splice_"
+	// contentType is the content type of the Prometheus text exposition format.
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Check reports whether a dependency of SpliceD is reachable.
+type Check func(ctx context.Context) error
+
+// Entry describes a logged warning or error.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// ErrorLog implements joiner.Logger. It records the last warning or error
+// logged under each event ID, and passes every entry on to another Logger.
+type ErrorLog struct {
+	next joiner.Logger
+
+	mu   sync.Mutex
+	last map[uint32]Entry
+}
+
+// NewErrorLog returns an ErrorLog passing entries on to next.
+func NewErrorLog(next joiner.Logger) *ErrorLog {
+	return &ErrorLog{next: next, last: make(map[uint32]Entry)}
+}
+
+func (l *ErrorLog) record(id uint32, level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last[id] = Entry{Time: time.Now().UTC(), Level: level, Message: fmt.Sprintf(format, args...)}
+}
+
+// Infof implements joiner.Logger.
+func (l *ErrorLog) Infof(id uint32, format string, args ...interface{}) {
+	l.next.Infof(id, format, args...)
+}
+
+// Warningf implements joiner.Logger.
+func (l *ErrorLog) Warningf(id uint32, format string, args ...interface{}) {
+	l.record(id, "warning", format, args...)
+	l.next.Warningf(id, format, args...)
+}
+
+// Errorf implements joiner.Logger.
+func (l *ErrorLog) Errorf(id uint32, format string, args ...interface{}) {
+	l.record(id, "error", format, args...)
+	l.next.Errorf(id, format, args...)
+}
+
+// Last returns the last warning or error logged under each event ID.
+func (l *ErrorLog) Last() map[uint32]Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last := make(map[uint32]Entry, len(l.last))
+	for id, e := range l.last {
+		last[id] = e
+	}
+	return last
+}
+
+// Status describes the current state of a joiner.
+type Status struct {
+	Instance   string           `json:"instance"`
+	Version    string           `json:"version"`
+	Paused     bool             `json:"paused"`
+	InFlight   []string         `json:"in_flight"`
+	LastErrors map[uint32]Entry `json:"last_errors"`
+}
+
+// Server serves the health endpoints of a joiner.
+type Server struct {
+	joiner  *joiner.Joiner
+	metrics *tracker.Tracker
+	errors  *ErrorLog
+	checks  map[string]Check
+
+	// CheckTimeout bounds how long each readiness check may take.
+	CheckTimeout time.Duration
+}
+
+// New returns a Server reporting on j, whose metrics are held by metrics and
+// whose log entries pass through errs. checks are named readiness checks,
+// typically for the subscription and the store.
+func New(j *joiner.Joiner, metrics *tracker.Tracker, errs *ErrorLog, checks map[string]Check) *Server {
+	return &Server{
+		joiner:       j,
+		metrics:      metrics,
+		errors:       errs,
+		checks:       checks,
+		CheckTimeout: 5 * time.Second,
+	}
+}
+
+// Handler returns a handler serving the following endpoints:
+//
+//	/healthz  reports that SpliceD is alive.
+//	/readyz   reports whether every readiness check passes.
+//	/statusz  reports the Status of the joiner as JSON.
+//	/metrics  reports the metrics in the Prometheus text format.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/statusz", s.statusz)
+	mux.HandleFunc("/metrics", s.metricsz)
+	return mux
+}
+
+// Serve serves the Handler on l until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Serve: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := http.StatusOK
+	var body string
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(r.Context(), s.CheckTimeout)
+		err := s.checks[name](ctx)
+		cancel()
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			body += fmt.Sprintf("%s: %v\n", name, err)
+			continue
+		}
+		body += fmt.Sprintf("%s: ok\n", name)
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
+
+// Status returns the current Status of the joiner.
+func (s *Server) Status() Status {
+	inFlight := s.joiner.Control.InFlight()
+	sort.Strings(inFlight)
+	return Status{
+		Instance:   s.joiner.Config().Instance,
+		Version:    s.joiner.Version,
+		Paused:     s.joiner.Control.Paused(),
+		InFlight:   inFlight,
+		LastErrors: s.errors.Last(),
+	}
+}
+
+func (s *Server) statusz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.Status())
+}
+
+// formatLabels renders labels in the Prometheus text format, sorted by name,
+// followed by any extra name and value pairs. Label values are quoted as Go
+// strings, which escapes backslashes, quotes and newlines as Prometheus does.
+func formatLabels(labels tracker.Labels, extra ...string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (s *Server) metricsz(w http.ResponseWriter, r *http.Request) {
+	kinds := make(map[string]string)
+	for _, name := range joiner.Counters {
+		kinds[name] = "counter"
+	}
+	for _, name := range joiner.Gauges {
+		kinds[name] = "gauge"
+	}
+
+	// Metrics updated by series are exported by series, and all others by
+	// their value.
+	values := s.metrics.Snapshot()
+	series := make(map[string][]tracker.Series)
+	for _, ser := range s.metrics.Series() {
+		series[ser.Name] = append(series[ser.Name], ser)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	for name := range series {
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", contentType)
+	for _, name := range names {
+		kind, ok := kinds[name]
+		if !ok {
+			kind = "untyped"
+		}
+		metric := metricPrefix + name
+		if kind == "counter" {
+			metric += "_total"
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric, kind)
+		if len(series[name]) == 0 {
+			fmt.Fprintf(w, "%s %d\n", metric, values[name])
+			continue
+		}
+		for _, ser := range series[name] {
+			fmt.Fprintf(w, "%s%s %d\n", metric, formatLabels(ser.Labels), ser.Value)
+		}
+	}
+
+	var last string
+	for _, d := range s.metrics.Histograms() {
+		metric := metricPrefix + d.Name
+		if d.Name != last {
+			fmt.Fprintf(w, "# TYPE %s histogram\n", metric)
+			last = d.Name
+		}
+		var cumulative uint64
+		for i, bound := range d.Buckets {
+			cumulative += d.Counts[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", metric, formatLabels(d.Labels, "le", le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", metric, formatLabels(d.Labels, "le", "+Inf"), d.Count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", metric, formatLabels(d.Labels), strconv.FormatFloat(d.Sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", metric, formatLabels(d.Labels), d.Count)
+	}
+
+	status := s.Status()
+	paused := 0
+	if status.Paused {
+		paused = 1
+	}
+	fmt.Fprintf(w, "# TYPE %[1]sin_flight_requests gauge\n%[1]sin_flight_requests %d\n", metricPrefix, len(status.InFlight))
+	fmt.Fprintf(w, "# TYPE %[1]spaused gauge\n%[1]spaused %d\n", metricPrefix, paused)
+
+	ids := make([]int, 0, len(status.LastErrors))
+	for id := range status.LastErrors {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	fmt.Fprintf(w, "# TYPE %slast_error_timestamp_seconds gauge\n", metricPrefix)
+	for _, id := range ids {
+		e := status.LastErrors[uint32(id)]
+		fmt.Fprintf(w, "%slast_error_timestamp_seconds%s %d\n",
+			metricPrefix, formatLabels(nil, "event", strconv.Itoa(id), "level", e.Level), e.Time.Unix())
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/splice/spliced/joiner"
+	"github.com/google/splice/spliced/metric/tracker"
+	spltesting "github.com/google/splice/spliced/testing"
+)
+
+func newServer(t *testing.T, checks map[string]Check) (*Server, *joiner.Joiner, *ErrorLog) {
+	t.Helper()
+	metrics := spltesting.NewTracker()
+	errs := NewErrorLog(spltesting.Logger{Logf: t.Logf})
+	j := joiner.New(joiner.Config{Instance: "joiner1"}, nil, nil, nil, errs, metrics)
+	j.Version = "1.2.3"
+	return New(j, metrics, errs, checks), j, errs
+}
+
+func get(t *testing.T, s *Server, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	b, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatalf("reading %s returned %v", path, err)
+	}
+	return rec.Code, string(b)
+}
+
+func TestReadyz(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("unreachable") }
+	tests := []struct {
+		desc   string
+		checks map[string]Check
+		want   int
+	}{
+		{"all reachable", map[string]Check{"store": ok, "subscription": ok}, http.StatusOK},
+		{"store unreachable", map[string]Check{"store": down, "subscription": ok}, http.StatusServiceUnavailable},
+		{"no checks", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		s, _, _ := newServer(t, tt.checks)
+		if got, body := get(t, s, "/readyz"); got != tt.want {
+			t.Errorf("%s: /readyz returned %d (%q), want %d", tt.desc, got, body, tt.want)
+		}
+	}
+}
+
+func TestStatusz(t *testing.T) {
+	s, j, errs := newServer(t, nil)
+	if err := j.Control.Begin("req1"); err != nil {
+		t.Fatalf("Begin(req1) returned %v", err)
+	}
+	defer j.Control.End("req1")
+	j.Control.Pause()
+	errs.Errorf(joiner.EvtErrClaim, "claim %s failed", "req0")
+	errs.Warningf(joiner.EvtErrClaim, "claim %s failed", "req1")
+	errs.Infof(joiner.EvtNewRequest, "not an error")
+
+	code, body := get(t, s, "/statusz")
+	if code != http.StatusOK {
+		t.Fatalf("/statusz returned %d, want %d", code, http.StatusOK)
+	}
+	var got Status
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%q) returned %v", body, err)
+	}
+	if got.Instance != "joiner1" || got.Version != "1.2.3" || !got.Paused {
+		t.Errorf("/statusz returned %+v, want paused joiner1 at 1.2.3", got)
+	}
+	if diff := cmp.Diff([]string{"req1"}, got.InFlight); diff != "" {
+		t.Errorf("/statusz in-flight requests diff (-want +got):\n%s", diff)
+	}
+	if len(got.LastErrors) != 1 || got.LastErrors[joiner.EvtErrClaim].Message != "claim req1 failed" {
+		t.Errorf("/statusz last errors = %+v, want the claim warning only", got.LastErrors)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s, _, errs := newServer(t, nil)
+	s.metrics.Get("join_success").Increment()
+	s.metrics.Get("join_success").Increment()
+	s.metrics.Get("busy_workers").Set(3)
+	s.metrics.With("failures", tracker.Labels{"class": "claim"}).Increment()
+	s.metrics.With("failures", tracker.Labels{"class": "join"}).Increment()
+	s.metrics.Histogram("provisioning_seconds", tracker.Labels{"reuse": "true"}).Observe(0.75)
+	s.metrics.Histogram("provisioning_seconds", tracker.Labels{"reuse": "true"}).Observe(7200)
+	errs.Errorf(joiner.EvtErrSubscription, "subscription failed")
+
+	code, body := get(t, s, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("/metrics returned %d, want %d", code, http.StatusOK)
+	}
+	for _, want := range []string{
+		"# TYPE splice_join_success_total counter\nsplice_join_success_total 2\n",
+		"# TYPE splice_busy_workers gauge\nsplice_busy_workers 3\n",
+		"# TYPE splice_failures_total counter\nsplice_failures_total{class=\"claim\"} 1\nsplice_failures_total{class=\"join\"} 1\n",
+		"# TYPE splice_provisioning_seconds histogram\n",
+		"splice_provisioning_seconds_bucket{reuse=\"true\",le=\"0.5\"} 0\nsplice_provisioning_seconds_bucket{reuse=\"true\",le=\"1\"} 1\n",
+		"splice_provisioning_seconds_bucket{reuse=\"true\",le=\"3600\"} 1\nsplice_provisioning_seconds_bucket{reuse=\"true\",le=\"+Inf\"} 2\n",
+		"splice_provisioning_seconds_sum{reuse=\"true\"} 7200.75\nsplice_provisioning_seconds_count{reuse=\"true\"} 2\n",
+		"splice_in_flight_requests 0\n",
+		"splice_paused 0\n",
+		`splice_last_error_timestamp_seconds{event="4002",level="error"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics returned %q, want it to contain %q", body, want)
+		}
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	s, _, _ := newServer(t, map[string]Check{"store": func(context.Context) error { return errors.New("unreachable") }})
+	if got, _ := get(t, s, "/healthz"); got != http.StatusOK {
+		t.Errorf("/healthz returned %d, want %d", got, http.StatusOK)
+	}
+}
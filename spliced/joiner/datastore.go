@@ -0,0 +1,92 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/google/splice/models"
+)
+
+// Datastore implements Store using the Cloud Datastore.
+type Datastore struct {
+	client *datastore.Client
+}
+
+// NewDatastore returns a Datastore for the Cloud project projectID.
+func NewDatastore(ctx context.Context, projectID string) (*Datastore, error) {
+	client, err := datastore.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("NewDatastore: datastore client creation failed with %v", err)
+	}
+	return &Datastore{client: client}, nil
+}
+
+// Close closes the datastore client.
+func (d *Datastore) Close() error {
+	return d.client.Close()
+}
+
+// Update implements Store.
+func (d *Datastore) Update(ctx context.Context, reqID string, fn func(*models.Request) error) error {
+	tx, err := d.client.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("Update: opening a datastore transaction failed with %v", err)
+	}
+	defer tx.Rollback()
+
+	var requests []models.Request
+	ancestor := datastore.NameKey("RequestID", reqID, nil)
+	query := datastore.NewQuery("Request").Ancestor(ancestor).Transaction(tx)
+
+	keys, err := d.client.GetAll(ctx, query, &requests)
+	if err != nil {
+		return fmt.Errorf("Update: obtaining request from the datastore failed with %v", err)
+	}
+	if len(requests) < 1 {
+		return fmt.Errorf("Update: no request received with ID %s: %w", reqID, ErrNotFound)
+	}
+
+	if err := fn(&requests[0]); err != nil {
+		return err
+	}
+
+	if _, err := tx.Put(keys[0], &requests[0]); err != nil {
+		return fmt.Errorf("Update: datastore update failed with %v", err)
+	}
+	if _, err := tx.Commit(); err != nil {
+		return fmt.Errorf("Update: datastore commit failed with %v", err)
+	}
+	return nil
+}
+
+// PutJoiner implements Store.
+func (d *Datastore) PutJoiner(ctx context.Context, j *models.Joiner) error {
+	if _, err := d.client.Put(ctx, datastore.NameKey("Joiner", j.Instance, nil), j); err != nil {
+		return fmt.Errorf("PutJoiner: datastore update failed with %v", err)
+	}
+	return nil
+}
+
+// Check reports whether the datastore can be reached.
+func (d *Datastore) Check(ctx context.Context) error {
+	query := datastore.NewQuery("Joiner").KeysOnly().Limit(1)
+	if _, err := d.client.GetAll(ctx, query, nil); err != nil {
+		return fmt.Errorf("Check: datastore query failed with %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// errOtherDomain indicates a request for a domain the joiner does not serve.
+var errOtherDomain = errors.New("request is for a domain this joiner does not serve")
+
+// DomainConfig holds the provisioning settings of a domain served by a
+// joiner in addition to Config.Domain.
+type DomainConfig struct {
+	PermitReuse bool `json:"permit_reuse" yaml:"permit_reuse"`
+	// AllowedOUs lists the organizational units of the domain that requests
+	// may create machine accounts in, by distinguished name.
+	AllowedOUs []string `json:"allowed_ous" yaml:"allowed_ous"`
+	// DomainControllers lists the preferred domain controllers of the
+	// domain by site. See Controllers.
+	DomainControllers map[string][]string `json:"domain_controllers" yaml:"domain_controllers"`
+
+	// CertTemplate names the certificate template hosts enroll with once
+	// joined, unless the request selects another one.
+	CertTemplate string `json:"cert_template" yaml:"cert_template"`
+	// Policies lists the names of the group policy objects applied to every
+	// host when it is joined.
+	Policies []string `json:"policies" yaml:"policies"`
+	// RootCerts embeds the root certificates of the domain in the
+	// provisioning metadata.
+	RootCerts bool `json:"root_certs" yaml:"root_certs"`
+	// AllowedCertTemplates lists the certificate templates requests may
+	// select.
+	AllowedCertTemplates []string `json:"allowed_cert_templates" yaml:"allowed_cert_templates"`
+	// AllowedPolicies lists the group policy objects requests may add to
+	// Policies.
+	AllowedPolicies []string `json:"allowed_policies" yaml:"allowed_policies"`
+}
+
+// Package returns the certificate template and group policies to provision a
+// host with, given the template and policies its request selected. The
+// request may only select templates listed in AllowedCertTemplates and
+// policies listed in AllowedPolicies, which are matched without regard to
+// case. If no template is selected, CertTemplate is used.
+func (dc DomainConfig) Package(template string, policies []string) (string, []string, error) {
+	if template == "" {
+		template = dc.CertTemplate
+	} else if !containsFold(dc.AllowedCertTemplates, template) {
+		return "", nil, fmt.Errorf("certificate template %q is not allowed by this joiner", template)
+	}
+	all := append([]string(nil), dc.Policies...)
+	for _, p := range policies {
+		if !containsFold(dc.AllowedPolicies, p) {
+			return "", nil, fmt.Errorf("group policy %q is not allowed by this joiner", p)
+		}
+		if !containsFold(all, p) {
+			all = append(all, p)
+		}
+	}
+	return template, all, nil
+}
+
+// containsFold reports whether list contains s, without regard to case.
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnySite keys the domain controllers preferred by joiners in any site.
+const AnySite = "*"
+
+// Controllers returns the domain controllers to provision against from site,
+// in the order they are tried: the preferred domain controllers of site,
+// followed by those of AnySite. Site names are compared without regard to
+// case. If no domain controller is preferred, the single empty name returned
+// lets the platform choose one.
+func (dc DomainConfig) Controllers(site string) []string {
+	var dcs []string
+	seen := make(map[string]bool)
+	add := func(names []string) {
+		for _, n := range names {
+			if !seen[strings.ToLower(n)] {
+				seen[strings.ToLower(n)] = true
+				dcs = append(dcs, n)
+			}
+		}
+	}
+	for s, names := range dc.DomainControllers {
+		if s != AnySite && strings.EqualFold(s, site) {
+			add(names)
+		}
+	}
+	add(dc.DomainControllers[AnySite])
+	if len(dcs) == 0 {
+		return []string{""}
+	}
+	return dcs
+}
+
+// AllowsOU reports whether a machine account may be created in the
+// organizational unit with the distinguished name ou. An empty ou, which
+// selects the default computers container, is always allowed. Any other ou
+// must be one of AllowedOUs or lie beneath one of them. Distinguished names
+// are compared without regard to case or to spaces around their separators.
+func (dc DomainConfig) AllowsOU(ou string) bool {
+	if ou == "" {
+		return true
+	}
+	ou = canonicalDN(ou)
+	for _, a := range dc.AllowedOUs {
+		a = canonicalDN(a)
+		if a != "" && (ou == a || strings.HasSuffix(ou, ","+a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalDN returns the distinguished name dn in lower case, with the
+// spaces around its components removed.
+func canonicalDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		k, v, _ := strings.Cut(p, "=")
+		parts[i] = strings.TrimSpace(k) + "=" + strings.TrimSpace(v)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
+
+// Lookup returns the name and provisioning settings of the domain requested
+// as name, and whether c serves it. Domain names are compared without regard
+// to case. An empty name selects Config.Domain, whose provisioning settings
+// are the top-level ones of c.
+func (c Config) Lookup(name string) (string, DomainConfig, bool) {
+	if name == "" || strings.EqualFold(name, c.Domain) {
+		return c.Domain, DomainConfig{
+			PermitReuse:          c.PermitReuse,
+			AllowedOUs:           c.AllowedOUs,
+			DomainControllers:    c.DomainControllers,
+			CertTemplate:         c.CertTemplate,
+			Policies:             c.Policies,
+			RootCerts:            c.RootCerts,
+			AllowedCertTemplates: c.AllowedCertTemplates,
+			AllowedPolicies:      c.AllowedPolicies,
+		}, true
+	}
+	for d, dc := range c.Domains {
+		if strings.EqualFold(name, d) {
+			return d, dc, true
+		}
+	}
+	return "", DomainConfig{}, false
+}
+
+// ServedDomains returns the names of all domains served under c, sorted.
+func (c Config) ServedDomains() []string {
+	domains := []string{c.Domain}
+	for d := range c.Domains {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	return domains
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAllowsOU(t *testing.T) {
+	dc := DomainConfig{AllowedOUs: []string{"OU=Lab, DC=example,DC=com"}}
+	tests := []struct {
+		ou   string
+		want bool
+	}{
+		{"", true},
+		{"ou=lab,dc=example,dc=com", true},
+		{"OU=Bench,OU=Lab,DC=example,DC=com", true},
+		{"OU=OldLab,DC=example,DC=com", false},
+		{"OU=Servers,DC=example,DC=com", false},
+	}
+	for _, tt := range tests {
+		if got := dc.AllowsOU(tt.ou); got != tt.want {
+			t.Errorf("AllowsOU(%q) = %t, want %t", tt.ou, got, tt.want)
+		}
+	}
+}
+
+func TestControllers(t *testing.T) {
+	dc := DomainConfig{DomainControllers: map[string][]string{
+		"HQ":    {"dc1.example.com", "dc2.example.com"},
+		"lab":   {"dc4.example.com"},
+		AnySite: {"dc3.example.com", "DC1.example.com"},
+	}}
+	tests := []struct {
+		desc string
+		conf DomainConfig
+		site string
+		want []string
+	}{
+		{"site first", dc, "hq", []string{"dc1.example.com", "dc2.example.com", "dc3.example.com"}},
+		{"other site", dc, "branch", []string{"dc3.example.com", "DC1.example.com"}},
+		{"no site", dc, "", []string{"dc3.example.com", "DC1.example.com"}},
+		{"none preferred", DomainConfig{}, "hq", []string{""}},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, tt.conf.Controllers(tt.site)); diff != "" {
+			t.Errorf("%s: Controllers(%q) returned diff (-want +got):\n%s", tt.desc, tt.site, diff)
+		}
+	}
+}
+
+func TestPackage(t *testing.T) {
+	dc := DomainConfig{
+		CertTemplate:         "Workstation",
+		Policies:             []string{"Baseline"},
+		AllowedCertTemplates: []string{"LabMachine"},
+		AllowedPolicies:      []string{"Lab Policy", "Baseline"},
+	}
+	tests := []struct {
+		desc         string
+		template     string
+		policies     []string
+		wantTemplate string
+		wantPolicies []string
+		wantErr      bool
+	}{
+		{"defaults", "", nil, "Workstation", []string{"Baseline"}, false},
+		{"allowed selection", "labmachine", []string{"LAB POLICY", "baseline"}, "labmachine", []string{"Baseline", "LAB POLICY"}, false},
+		{"template not allowed", "Workstation", nil, "", nil, true},
+		{"policy not allowed", "", []string{"Kiosk"}, "", nil, true},
+	}
+	for _, tt := range tests {
+		template, policies, err := dc.Package(tt.template, tt.policies)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Package() returned %v, want error %t", tt.desc, err, tt.wantErr)
+			continue
+		}
+		if template != tt.wantTemplate {
+			t.Errorf("%s: Package() returned template %q, want %q", tt.desc, template, tt.wantTemplate)
+		}
+		if diff := cmp.Diff(tt.wantPolicies, policies); diff != "" {
+			t.Errorf("%s: Package() returned policies diff (-want +got):\n%s", tt.desc, diff)
+		}
+	}
+}
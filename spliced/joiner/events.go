@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package joiner
 
 /*
  * Internal Events
@@ -33,6 +33,10 @@ const (
 	EvtStartup
 	// EvtShutdown indicates SpliceD shutdown
 	EvtShutdown
+	// EvtPaused indicates the daemon has stopped accepting new requests
+	EvtPaused
+	// EvtResumed indicates the daemon has resumed accepting new requests
+	EvtResumed
 )
 
 const (
@@ -50,6 +54,8 @@ const (
 	EvtJoinFailure
 	// EvtNameGeneration indicates a dynamic name generation event
 	EvtNameGeneration
+	// EvtRelease indicates an unfinished request was released to other joiners
+	EvtRelease
 )
 
 /*
@@ -71,6 +77,10 @@ const (
 	EvtErrClaim
 	// EvtErrReturn indicates an error returning a request
 	EvtErrReturn
+	// EvtErrRelease indicates an error releasing an unfinished request
+	EvtErrRelease
+	// EvtErrConfiguration indicates an error loading or applying configuration
+	EvtErrConfiguration
 )
 
 const (
@@ -85,4 +95,13 @@ const (
 	// EvtErrNaming indicates a failure determining a hostname for a request. This
 	// could be a problem with the request or a problem with a generator.
 	EvtErrNaming
+	// EvtErrMessage indicates a message that could not be decoded or was
+	// meant for another joiner
+	EvtErrMessage
+	// EvtErrOU indicates a request for an organizational unit that is not
+	// allowed by the joiner
+	EvtErrOU
+	// EvtErrPackage indicates a request for a certificate template or group
+	// policy that is not allowed by the joiner
+	EvtErrPackage
 )
@@ -0,0 +1,552 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package joiner processes domain join requests independently of the platform
+that hosts it.
+
+The configuration, provisioner, queue, store and logger used by a Joiner are
+injected, so that the same request-processing core runs inside the Windows
+service and in portable end-to-end tests.
+
+A single long-lived queue receiver feeds a pool of workers. Each worker
+claims the request carried by a message with a renewable lease, processes
+it and returns the result through the store.
+*/
+package joiner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/splice/generators"
+	"github.com/google/splice/models"
+	"github.com/google/splice/shared/tracing"
+	"github.com/google/splice/spliced/lifecycle"
+	"github.com/google/splice/spliced/metric/tracker"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
+)
+
+var (
+	// ErrHandled indicates that a request was already dealt with, either by
+	// this joiner or another one. Messages for handled requests are
+	// acknowledged, as redelivering them would serve no purpose.
+	ErrHandled = errors.New("request was already handled")
+
+	// ErrNotFound indicates that a request does not exist in the store.
+	ErrNotFound = errors.New("request not found")
+
+	// Counters lists the counter metrics that must be registered with the
+	// tracker passed to New.
+	Counters = []string{
+		"failure_205",
+		"failure_206",
+		"failure_207",
+		"failure_208",
+		"failure_210",
+		"failure_211",
+		"failure_212",
+		"failure_213",
+		"failure_214",
+		"failures",
+		"join_attempt",
+		"join_fail",
+		"join_success",
+	}
+
+	// Gauges lists the gauge metrics that must be registered with the
+	// tracker passed to New.
+	Gauges = []string{
+		"busy_workers",
+	}
+
+	// Histograms lists the histograms, measured in seconds, that must be
+	// registered with the tracker passed to New using Buckets.
+	Histograms = []string{
+		"end_to_end_seconds",
+		"provisioning_seconds",
+		"queue_wait_seconds",
+	}
+
+	// Buckets holds the upper bounds, in seconds, of the buckets of every
+	// histogram in Histograms.
+	Buckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+	// failureClasses names the class of failure counted by each of the
+	// failure counters, which labels the failures counter.
+	failureClasses = map[string]string{
+		"failure_205": "subscription",
+		"failure_206": "claim",
+		"failure_207": "join",
+		"failure_208": "return",
+		"failure_210": "encryption",
+		"failure_211": "verification",
+		"failure_212": "public_key",
+		"failure_213": "ou",
+		"failure_214": "package",
+	}
+)
+
+// Config holds the settings of a joiner. The keys used for each setting in
+// configuration files and the registry are given by its tags.
+type Config struct {
+	Domain         string `json:"domain" yaml:"domain"`
+	Instance       string `json:"instance" yaml:"instance"`
+	ProjectID      string `json:"project" yaml:"project"`
+	Topic          string `json:"topic" yaml:"topic"`
+	EncryptBlob    bool   `json:"encrypt_blob" yaml:"encrypt_blob"`
+	VerifyCert     bool   `json:"verify_certs" yaml:"verify_certs"`
+	CaURL          string `json:"ca_root_url" yaml:"ca_root_url"`
+	CaURLPath      string `json:"ca_cert_path" yaml:"ca_cert_path"`
+	CaOrg          string `json:"ca_cert_org" yaml:"ca_cert_org"`
+	RootsPath      string `json:"roots_path" yaml:"roots_path"`
+	PermitReuse    bool   `json:"permit_reuse" yaml:"permit_reuse"`
+	UseTestBackend bool   `json:"use_test_backend" yaml:"use_test_backend"`
+	Workers        int    `json:"workers" yaml:"workers"`
+	HealthAddr     string `json:"health_addr" yaml:"health_addr"`
+	TraceExporter  string `json:"trace_exporter" yaml:"trace_exporter"`
+	TraceFile      string `json:"trace_file" yaml:"trace_file"`
+	PriorityTopic  string `json:"priority_topic" yaml:"priority_topic"`
+	LaneFairness   int    `json:"lane_fairness" yaml:"lane_fairness"`
+	// AllowedOUs lists the organizational units of Domain that requests may
+	// create machine accounts in. See DomainConfig.AllowsOU.
+	AllowedOUs []string `json:"allowed_ous" yaml:"allowed_ous"`
+	// Site names the Active Directory site of the joiner, which selects its
+	// preferred domain controllers.
+	Site string `json:"site" yaml:"site"`
+	// DomainControllers lists the preferred domain controllers of Domain by
+	// site. See DomainConfig.Controllers.
+	DomainControllers map[string][]string `json:"domain_controllers" yaml:"domain_controllers"`
+	// CertTemplate, Policies, RootCerts, AllowedCertTemplates and
+	// AllowedPolicies select the contents of the provisioning packages of
+	// Domain. See DomainConfig.
+	CertTemplate         string   `json:"cert_template" yaml:"cert_template"`
+	Policies             []string `json:"policies" yaml:"policies"`
+	RootCerts            bool     `json:"root_certs" yaml:"root_certs"`
+	AllowedCertTemplates []string `json:"allowed_cert_templates" yaml:"allowed_cert_templates"`
+	AllowedPolicies      []string `json:"allowed_policies" yaml:"allowed_policies"`
+	// Domains holds the domains served in addition to Domain, by name.
+	Domains map[string]DomainConfig `json:"domains" yaml:"domains"`
+}
+
+// Message carries a join request delivered by a Queue. Every Message must be
+// settled exactly once.
+type Message interface {
+	// Data returns the data of the message, which holds a models.Envelope or,
+	// for messages published by older Apps, a bare request ID.
+	Data() []byte
+	// Attributes returns the attributes of the message, which carry the
+	// routing fields of the envelope and the trace context of the request.
+	Attributes() map[string]string
+	// Settle acknowledges the message if err is nil or wraps ErrHandled, and
+	// returns it to the queue for redelivery otherwise.
+	Settle(err error)
+}
+
+// Handled reports whether a message whose claim returned err should be
+// acknowledged, as the request is then durably claimed or no longer needs
+// processing. Any other error is treated as transient.
+func Handled(err error) bool {
+	return err == nil || errors.Is(err, ErrHandled)
+}
+
+// Queue delivers join requests to a joiner.
+type Queue interface {
+	// Receive passes messages to deliver until ctx is cancelled or the queue
+	// fails. At most maxOutstanding messages are held unsettled at any one
+	// time. Receive returns nil once ctx is cancelled.
+	Receive(ctx context.Context, maxOutstanding int, deliver func(context.Context, Message)) error
+}
+
+// Store holds join requests and joiner heartbeats.
+type Store interface {
+	// Update loads the request identified by reqID and passes it to fn in a
+	// single transaction. The request is written back only if fn returns nil.
+	// Errors wrapping ErrNotFound are returned if the request does not exist.
+	Update(ctx context.Context, reqID string, fn func(*models.Request) error) error
+	// PutJoiner records the heartbeat of a joiner.
+	PutJoiner(ctx context.Context, j *models.Joiner) error
+}
+
+// Logger records events under the event IDs defined in this package.
+type Logger interface {
+	Infof(id uint32, format string, args ...interface{})
+	Warningf(id uint32, format string, args ...interface{})
+	Errorf(id uint32, format string, args ...interface{})
+}
+
+// ExitEvt holds an event explaining why Run had to exit.
+type ExitEvt struct {
+	Code    uint32
+	Message string
+}
+
+// Joiner processes join requests pulled from a queue.
+type Joiner struct {
+	mu          sync.RWMutex
+	conf        Config
+	provisioner Provisioner
+	queue       Queue
+	store       Store
+	log         Logger
+	metrics     *tracker.Tracker
+
+	// Control pauses, drains and stops the joiner.
+	Control *lifecycle.Controller
+	// Version identifies the joiner build in its heartbeats.
+	Version string
+
+	// DrainTimeout bounds how long Shutdown waits for in-flight requests to
+	// finish before releasing them.
+	DrainTimeout time.Duration
+	// LeaseDuration is how long a claim remains valid without being renewed.
+	LeaseDuration time.Duration
+	// LeaseRenewal is how often a claim is renewed while its request is processed.
+	LeaseRenewal time.Duration
+
+	// busy counts the workers currently processing a claimed request.
+	busy atomic.Int64
+}
+
+// New returns a Joiner for conf using the injected dependencies. All metrics
+// listed in Counters, Gauges and Histograms must be registered with metrics.
+func New(conf Config, provisioner Provisioner, queue Queue, store Store, log Logger, metrics *tracker.Tracker) *Joiner {
+	return &Joiner{
+		conf:          conf,
+		provisioner:   provisioner,
+		queue:         queue,
+		store:         store,
+		log:           log,
+		metrics:       metrics,
+		Control:       lifecycle.New(),
+		Version:       "unknown",
+		DrainTimeout:  20 * time.Second,
+		LeaseDuration: 2 * time.Minute,
+		LeaseRenewal:  30 * time.Second,
+	}
+}
+
+// Config returns the current configuration of j.
+func (j *Joiner) Config() Config {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.conf
+}
+
+// Reconfigure applies the settings in conf that can change while j is
+// running: certificate verification, blob encryption, the reuse policy, the
+// allowed OUs, the preferred domain controllers, the contents of provisioning
+// packages, lane fairness and the additional domains served.
+// Requests that are already being processed keep their settings. It returns
+// the keys of the settings that differ from the running configuration but
+// only apply after a restart.
+func (j *Joiner) Reconfigure(conf Config) []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var restart []string
+	for _, c := range []struct {
+		key     string
+		changed bool
+	}{
+		{"domain", conf.Domain != j.conf.Domain},
+		{"instance", conf.Instance != j.conf.Instance},
+		{"project", conf.ProjectID != j.conf.ProjectID},
+		{"topic", conf.Topic != j.conf.Topic},
+		{"use_test_backend", conf.UseTestBackend != j.conf.UseTestBackend},
+		{"workers", conf.Workers != j.conf.Workers},
+		{"health_addr", conf.HealthAddr != j.conf.HealthAddr},
+		{"trace_exporter", conf.TraceExporter != j.conf.TraceExporter},
+		{"trace_file", conf.TraceFile != j.conf.TraceFile},
+		{"priority_topic", conf.PriorityTopic != j.conf.PriorityTopic},
+	} {
+		if c.changed {
+			restart = append(restart, c.key)
+		}
+	}
+
+	j.conf.EncryptBlob = conf.EncryptBlob
+	j.conf.VerifyCert = conf.VerifyCert
+	j.conf.CaURL = conf.CaURL
+	j.conf.CaURLPath = conf.CaURLPath
+	j.conf.CaOrg = conf.CaOrg
+	j.conf.RootsPath = conf.RootsPath
+	j.conf.PermitReuse = conf.PermitReuse
+	j.conf.AllowedOUs = conf.AllowedOUs
+	j.conf.Site = conf.Site
+	j.conf.DomainControllers = conf.DomainControllers
+	j.conf.CertTemplate = conf.CertTemplate
+	j.conf.Policies = conf.Policies
+	j.conf.RootCerts = conf.RootCerts
+	j.conf.AllowedCertTemplates = conf.AllowedCertTemplates
+	j.conf.AllowedPolicies = conf.AllowedPolicies
+	j.conf.LaneFairness = conf.LaneFairness
+	j.conf.Domains = conf.Domains
+	return restart
+}
+
+// handleMessage claims the request carried by msg, settles the message and
+// processes the request if the claim succeeded. It is safe for concurrent use
+// by multiple workers.
+func (j *Joiner) handleMessage(ctx context.Context, msg Message) {
+	env, err := models.DecodeEnvelope(msg.Data(), msg.Attributes())
+	if err != nil {
+		// Redelivering a message that cannot be decoded would not help.
+		msg.Settle(fmt.Errorf("%w: %v", ErrHandled, err))
+		j.log.Errorf(EvtErrMessage, "Discarded message %q: %v", msg.Data(), err)
+		return
+	}
+	reqID := env.RequestID
+	j.log.Infof(EvtNewRequest, "Worker pulled message for processing, %v (version %d, priority %d, attempt %d, enqueued %v)",
+		reqID, env.Version, env.Priority, env.Attempt, env.EnqueueTime)
+
+	// Requests for another domain were published to the wrong topic or
+	// subscription. Returning them would only have them redelivered here, so
+	// they are acknowledged unclaimed, and the App publishes them again once
+	// they have gone unclaimed for too long.
+	if _, _, ok := j.Config().Lookup(env.Domain); !ok {
+		msg.Settle(fmt.Errorf("%w: %v: request %s is for domain %s", ErrHandled, errOtherDomain, reqID, env.Domain))
+		j.log.Errorf(EvtErrMessage, "Discarded misrouted request %s for domain %s", reqID, env.Domain)
+		return
+	}
+
+	// Spans of the request continue the trace started by the client.
+	ctx = tracing.FromAttributes(ctx, env.TraceContext)
+	ctx, span := tracing.Start(ctx, "handleMessage", reqID, trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+
+	// Duplicate deliveries of a request this instance is already working on
+	// are acknowledged without being claimed a second time. Messages arriving
+	// while paused or stopping are returned for redelivery.
+	if err := j.Control.Begin(reqID); err != nil {
+		if errors.Is(err, lifecycle.ErrDuplicate) {
+			err = fmt.Errorf("%w: %v", ErrHandled, err)
+		}
+		msg.Settle(err)
+		j.log.Infof(EvtNewRequest, "Request %s was not claimed: %v", reqID, err)
+		return
+	}
+	defer j.Control.End(reqID)
+
+	req, err := j.claimRequest(ctx, reqID)
+	if errors.Is(err, errOtherDomain) {
+		msg.Settle(fmt.Errorf("%w: %v", ErrHandled, err))
+		j.log.Errorf(EvtErrMessage, "Discarded misrouted request %s: %v", reqID, err)
+		return
+	}
+	msg.Settle(err)
+	if errors.Is(err, ErrHandled) {
+		j.log.Infof(EvtNewRequest, "Request %s was acknowledged without processing: %v", reqID, err)
+		return
+	}
+	if err != nil {
+		// The message has been returned to the queue for redelivery.
+		j.log.Errorf(EvtErrClaim, "%v", err)
+		j.fail("failure_206")
+		return
+	}
+
+	labels := requestLabels(&req, j.Config())
+	if !req.AcceptTime.IsZero() {
+		j.metrics.Histogram("queue_wait_seconds", labels).Observe(req.ClaimTime.Sub(req.AcceptTime).Seconds())
+	}
+
+	j.metrics.Get("busy_workers").Set(j.busy.Inc())
+	defer func() { j.metrics.Get("busy_workers").Set(j.busy.Dec()) }()
+
+	// The heartbeat must have stopped before the result is returned, so that
+	// a late renewal cannot contend with the transaction in returnRequest.
+	hctx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		j.heartbeat(hctx, reqID, req.LeaseID)
+	}()
+
+	success := true
+	meta, err := j.processRequest(ctx, &req)
+	if err != nil {
+		success = false
+	}
+	stopHeartbeat()
+	<-heartbeatDone
+
+	if err = j.returnRequest(ctx, &req, labels, success, &meta); err != nil {
+		j.log.Errorf(EvtErrReturn, "%v", err)
+		j.fail("failure_208")
+	}
+	for i := range meta.Data {
+		meta.Data[i] = 0
+	}
+}
+
+// fail counts a failure with the given failure counter, and with the
+// failures counter labeled by the class of the failure.
+func (j *Joiner) fail(counter string) {
+	j.metrics.Get(counter).Increment()
+	j.metrics.With("failures", tracker.Labels{"class": failureClasses[counter]}).Increment()
+}
+
+// worker processes the messages handed out by sched until it is closed.
+func (j *Joiner) worker(ctx context.Context, sched *scheduler) {
+	for {
+		msg, ok := sched.pop(j.Config().LaneFairness)
+		if !ok {
+			return
+		}
+		j.handleMessage(ctx, msg)
+	}
+}
+
+// registerJoiner records a Joiner heartbeat describing this instance in the
+// store.
+func (j *Joiner) registerJoiner(ctx context.Context, started time.Time) error {
+	conf := j.Config()
+	gens := generators.List()
+	sort.Strings(gens)
+	hb := &models.Joiner{
+		Instance:    conf.Instance,
+		Version:     j.Version,
+		StartTime:   started,
+		LastSeen:    time.Now().UTC(),
+		Domain:      conf.Domain,
+		Domains:     conf.ServedDomains(),
+		ProjectID:   conf.ProjectID,
+		Topic:       conf.Topic,
+		EncryptBlob: conf.EncryptBlob,
+		VerifyCert:  conf.VerifyCert,
+		PermitReuse: conf.PermitReuse,
+		Workers:     conf.Workers,
+		Generators:  gens,
+		Paused:      j.Control.Paused(),
+		InFlight:    len(j.Control.InFlight()),
+	}
+	if err := j.store.PutJoiner(ctx, hb); err != nil {
+		return fmt.Errorf("registerJoiner: %v", err)
+	}
+	return nil
+}
+
+// joinerHeartbeat records this instance's Joiner heartbeat every
+// models.JoinerHeartbeatInterval until ctx is cancelled.
+func (j *Joiner) joinerHeartbeat(ctx context.Context) {
+	started := time.Now().UTC()
+	ticker := time.NewTicker(models.JoinerHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := j.registerJoiner(ctx, started); err != nil && ctx.Err() == nil {
+			j.log.Warningf(EvtErrMisc, "Failed to publish joiner heartbeat: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run processes requests continuously until ctx is cancelled.
+//
+// The queue receiver never holds more unsettled messages than there are
+// workers, and only pulls new messages while j.Control is running. Messages
+// waiting for a worker are handed out highest priority first, but a lane with
+// messages waiting is never passed over more than Config.LaneFairness times in
+// a row.
+// Cancelling ctx stops the receiver, but not the requests already in flight;
+// those are drained or released through Shutdown.
+func (j *Joiner) Run(ctx context.Context) ExitEvt {
+	if err := generators.ConfigureAll(); err != nil {
+		return ExitEvt{EvtErrStartup, fmt.Sprintf("Failed to configure generators. %v", err)}
+	}
+
+	// The number of workers only changes on restart.
+	workers := j.Config().Workers
+
+	// In-flight requests must be able to finish and record their results
+	// after the receiver has been told to stop.
+	workCtx := context.WithoutCancel(ctx)
+	sched := newScheduler()
+	defer sched.close()
+	for i := 0; i < workers; i++ {
+		go j.worker(workCtx, sched)
+	}
+	j.metrics.Get("busy_workers").Set(0)
+	go j.joinerHeartbeat(ctx)
+
+	deliver := func(_ context.Context, msg Message) {
+		sched.push(msg)
+	}
+
+	for {
+		if err := j.Control.WaitRunning(ctx); err != nil {
+			return ExitEvt{EvtShutdown, fmt.Sprintf("Request processing stopped. %v", err)}
+		}
+
+		j.log.Infof(EvtWaiting, "Awaiting join requests with %d workers...", workers)
+		rctx, cancel := j.Control.RunningContext(ctx)
+		// Messages no worker has picked up yet are returned for redelivery
+		// as soon as the receiver is told to stop: the queue may wait for
+		// every message to be settled before Receive returns.
+		flushed := make(chan struct{})
+		go func() {
+			defer close(flushed)
+			<-rctx.Done()
+			sched.flush(rctx.Err())
+		}()
+		err := j.queue.Receive(rctx, workers, deliver)
+		cancel()
+		<-flushed
+		// Messages delivered while the receiver was stopping are returned
+		// too.
+		sched.flush(rctx.Err())
+		if ctx.Err() != nil {
+			return ExitEvt{EvtShutdown, fmt.Sprintf("Request processing stopped. %v", ctx.Err())}
+		}
+		if err == nil && j.Control.Paused() {
+			j.log.Infof(EvtPaused, "Request processing paused.")
+			continue
+		}
+		if err == nil {
+			err = errors.New("queue receiver stopped unexpectedly")
+		}
+		j.fail("failure_205")
+		j.log.Errorf(EvtErrSubscription, "%v", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(1 * time.Minute):
+		}
+	}
+}
+
+// Shutdown stops j from admitting new requests and waits up to
+// j.DrainTimeout for in-flight requests to finish. Requests still in flight
+// after that are released back to the Accepted state.
+func (j *Joiner) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), j.DrainTimeout)
+	defer cancel()
+	released, err := j.Control.Shutdown(ctx, func(reqID string) error {
+		return j.releaseRequest(context.Background(), reqID)
+	})
+	for _, reqID := range released {
+		j.log.Infof(EvtRelease, "Released unfinished request %s.", reqID)
+	}
+	if err != nil {
+		j.log.Errorf(EvtErrRelease, "Failed to release unfinished requests: %v", err)
+	}
+}
@@ -0,0 +1,611 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/splice/models"
+	"github.com/google/splice/shared/tracing"
+	"github.com/google/splice/spliced/joiner"
+	"github.com/google/splice/spliced/metric/tracker"
+	spltesting "github.com/google/splice/spliced/testing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHandled(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   error
+		ack  bool
+	}{
+		{"claimed", nil, true},
+		{"already handled", joiner.ErrHandled, true},
+		{"wrapped handled", fmt.Errorf("claimed by another joiner: %w", joiner.ErrHandled), true},
+		{"transient", errors.New("datastore commit failed"), false},
+	}
+	for _, tt := range tests {
+		if got := joiner.Handled(tt.in); got != tt.ack {
+			t.Errorf("%s: Handled(%v) = %t, want %t", tt.desc, tt.in, got, tt.ack)
+		}
+	}
+}
+
+// run starts a joiner named instance against store and queue, and stops it
+// when the test completes.
+func run(t *testing.T, instance string, store *spltesting.Store, queue *spltesting.Queue) *spltesting.InactiveDirectory {
+	ad := spltesting.NewInactiveDirectory()
+	j := joiner.New(joiner.Config{Domain: "example.com", Instance: instance, Workers: 1}, ad, queue, store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	})
+	return ad
+}
+
+// awaitAcked waits until n messages have been acknowledged.
+func awaitAcked(t *testing.T, queue *spltesting.Queue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(queue.Acked()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("acknowledged messages = %v, want %d", queue.Acked(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunClaims(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		desc       string
+		in         models.Request
+		wantStatus string
+		wantClaim  string
+	}{
+		{
+			"unclaimed",
+			models.Request{Status: models.RequestStatusAccepted},
+			models.RequestStatusCompleted, "joiner1",
+		},
+		{
+			"leased by another joiner",
+			models.Request{Status: models.RequestStatusAccepted, ClaimBy: "joiner2", ClaimTime: now, LeaseID: "a", LeaseExpiry: now.Add(time.Hour)},
+			models.RequestStatusAccepted, "joiner2",
+		},
+		{
+			"lease of another joiner expired",
+			models.Request{Status: models.RequestStatusAccepted, ClaimBy: "joiner2", ClaimTime: now.Add(-time.Hour), LeaseID: "a", LeaseExpiry: now.Add(-time.Minute)},
+			models.RequestStatusCompleted, "joiner1",
+		},
+		{
+			"already completed",
+			models.Request{Status: models.RequestStatusCompleted, ClaimBy: "joiner2"},
+			models.RequestStatusCompleted, "joiner2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			store, queue := spltesting.NewStore(), spltesting.NewQueue()
+			tt.in.RequestID = "req1"
+			tt.in.Hostname = "host1"
+			store.Put(tt.in)
+			run(t, "joiner1", store, queue)
+
+			queue.Publish("req1")
+			awaitAcked(t, queue, 1)
+			// The result is written after the message is acknowledged.
+			deadline := time.Now().Add(10 * time.Second)
+			got, _ := store.Get("req1")
+			for got.Status != tt.wantStatus && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+				got, _ = store.Get("req1")
+			}
+			if got.Status != tt.wantStatus || got.ClaimBy != tt.wantClaim {
+				t.Errorf("request = %s claimed by %q, want %s claimed by %q", got.Status, got.ClaimBy, tt.wantStatus, tt.wantClaim)
+			}
+		})
+	}
+}
+
+func TestRunMissingRequest(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	ad := run(t, "joiner1", store, queue)
+
+	queue.Publish("missing")
+	awaitAcked(t, queue, 1)
+	if n := queue.Nacks(); n != 0 {
+		t.Errorf("Nacks() = %d, want 0", n)
+	}
+	if len(ad.Computers) != 0 {
+		t.Errorf("joined %v, want nothing", ad.Computers)
+	}
+}
+
+func TestRunEnvelopes(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	for _, id := range []string{"req1", "req2"} {
+		store.Put(models.Request{RequestID: id, Hostname: id, Status: models.RequestStatusAccepted})
+	}
+	ad := run(t, "joiner1", store, queue)
+
+	publish := func(env models.Envelope) {
+		data, attrs, err := env.Encode()
+		if err != nil {
+			t.Fatalf("Encode() returned %v", err)
+		}
+		queue.PublishMessage(data, attrs)
+	}
+	// A malformed message and a misrouted request for another domain are
+	// both discarded.
+	queue.PublishMessage([]byte(`{"version": `), nil)
+	publish(models.Envelope{Version: models.EnvelopeVersion, RequestID: "req2", Domain: "other.example.com", Attempt: 1})
+	publish(models.Envelope{Version: models.EnvelopeVersion, RequestID: "req1", Domain: "EXAMPLE.com", Attempt: 1})
+	awaitAcked(t, queue, 3)
+
+	if diff := cmp.Diff([]string{`{"version": `, "req2", "req1"}, queue.Acked()); diff != "" {
+		t.Errorf("acknowledged messages diff (-want +got):\n%s", diff)
+	}
+	if n := queue.Nacks(); n != 0 {
+		t.Errorf("Nacks() = %d, want the request for other.example.com discarded", n)
+	}
+	if got, _ := store.Get("req2"); got.ClaimBy != "" {
+		t.Errorf("request for other.example.com claimed by %q, want unclaimed", got.ClaimBy)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	got, _ := store.Get("req1")
+	for got.Status != models.RequestStatusCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		got, _ = store.Get("req1")
+	}
+	if got.Status != models.RequestStatusCompleted || len(ad.Computers) != 1 {
+		t.Errorf("request req1 is %s and joined %v, want req1 completed and joined", got.Status, ad.Computers)
+	}
+}
+
+func TestRunDomains(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	for _, r := range []models.Request{
+		{RequestID: "req1", Hostname: "host1"},
+		{RequestID: "req2", Hostname: "host2", Domain: "LAB.example.com", AttemptReuse: true},
+		{RequestID: "req3", Hostname: "host3", Domain: "other.example.com"},
+	} {
+		r.Status = models.RequestStatusAccepted
+		store.Put(r)
+	}
+	ad := spltesting.NewInactiveDirectory()
+	// Reuse is only permitted in the lab domain.
+	ad.Computers["host2"] = true
+	conf := joiner.Config{
+		Domain:   "example.com",
+		Instance: "joiner1",
+		Workers:  1,
+		Domains:  map[string]joiner.DomainConfig{"lab.example.com": {PermitReuse: true}},
+	}
+	j := joiner.New(conf, ad, queue, store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	}()
+
+	// Messages from older Apps carry no domain, so req3 is only turned down
+	// once it has been loaded.
+	for _, id := range []string{"req3", "req1", "req2"} {
+		queue.Publish(id)
+	}
+	awaitAcked(t, queue, 3)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		r1, _ := store.Get("req1")
+		r2, _ := store.Get("req2")
+		if r1.Status != models.RequestStatusAccepted && r2.Status != models.RequestStatusAccepted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("requests = %s and %s, want both processed", r1.Status, r2.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for id, want := range map[string]string{"req1": models.RequestStatusCompleted, "req2": models.RequestStatusCompleted, "req3": models.RequestStatusAccepted} {
+		if got, _ := store.Get(id); got.Status != want || (want == models.RequestStatusAccepted && got.ClaimBy != "") {
+			t.Errorf("request %s is %s claimed by %q, want %s", id, got.Status, got.ClaimBy, want)
+		}
+	}
+	if diff := cmp.Diff(map[string]string{"host1": "example.com", "host2": "lab.example.com"}, ad.Domains); diff != "" {
+		t.Errorf("joined domains diff (-want +got):\n%s", diff)
+	}
+	if n := queue.Nacks(); n != 0 {
+		t.Errorf("Nacks() = %d, want the request for other.example.com discarded", n)
+	}
+}
+
+func TestRunOUs(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	for _, r := range []models.Request{
+		{RequestID: "req1", Hostname: "host1"},
+		{RequestID: "req2", Hostname: "host2", OU: "OU=Lab, OU=Computers,DC=example,DC=com"},
+		{RequestID: "req3", Hostname: "host3", OU: "OU=Servers,DC=example,DC=com"},
+	} {
+		r.Status = models.RequestStatusAccepted
+		store.Put(r)
+	}
+	ad := spltesting.NewInactiveDirectory()
+	conf := joiner.Config{
+		Domain:     "example.com",
+		Instance:   "joiner1",
+		Workers:    1,
+		AllowedOUs: []string{"ou=computers,dc=example,dc=com"},
+	}
+	j := joiner.New(conf, ad, queue, store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	}()
+
+	for _, id := range []string{"req1", "req2", "req3"} {
+		queue.Publish(id)
+	}
+	awaitAcked(t, queue, 3)
+	want := map[string]string{"req1": models.RequestStatusCompleted, "req2": models.RequestStatusCompleted, "req3": models.RequestStatusFailed}
+	deadline := time.Now().Add(10 * time.Second)
+	for id, status := range want {
+		for {
+			got, _ := store.Get(id)
+			if got.Status == status {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("request %s is %s, want %s", id, got.Status, status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if diff := cmp.Diff(map[string]string{"host1": "", "host2": "OU=Lab, OU=Computers,DC=example,DC=com"}, ad.OUs); diff != "" {
+		t.Errorf("joined OUs diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunDomainControllers(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	for _, r := range []models.Request{
+		{RequestID: "req1", Hostname: "host1"},
+		{RequestID: "req2", Hostname: "host2"},
+	} {
+		r.Status = models.RequestStatusAccepted
+		store.Put(r)
+	}
+	ad := spltesting.NewInactiveDirectory()
+	ad.Unreachable["dc1"] = true
+	// host2 exists and reuse is denied, which is not retried on another DC.
+	ad.Computers["host2"] = true
+	conf := joiner.Config{
+		Domain:            "example.com",
+		Instance:          "joiner1",
+		Workers:           1,
+		Site:              "hq",
+		DomainControllers: map[string][]string{"hq": {"dc1", "dc2"}, joiner.AnySite: {"dc3"}},
+	}
+	rec := spltesting.NewRecorder(ad)
+	j := joiner.New(conf, rec, queue, store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	}()
+
+	queue.Publish("req1")
+	queue.Publish("req2")
+	awaitAcked(t, queue, 2)
+	want := map[string]string{"req1": models.RequestStatusCompleted, "req2": models.RequestStatusFailed}
+	deadline := time.Now().Add(10 * time.Second)
+	for id, status := range want {
+		for {
+			got, _ := store.Get(id)
+			if got.Status == status {
+				if got.DomainController != "dc2" {
+					t.Errorf("request %s was provisioned against %q, want dc2", id, got.DomainController)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("request %s is %s, want %s", id, got.Status, status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if diff := cmp.Diff(map[string]string{"host1": "dc2"}, ad.DCs); diff != "" {
+		t.Errorf("joined DCs diff (-want +got):\n%s", diff)
+	}
+	attempts := make(map[string][]string)
+	for _, c := range rec.Calls() {
+		attempts[c.Options.Name] = append(attempts[c.Options.Name], c.Options.DC)
+	}
+	if diff := cmp.Diff(map[string][]string{"host1": {"dc1", "dc2"}, "host2": {"dc1", "dc2"}}, attempts); diff != "" {
+		t.Errorf("provisioning attempts diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunPackages(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	for _, r := range []models.Request{
+		{RequestID: "req1", Hostname: "host1"},
+		{RequestID: "req2", Hostname: "host2", CertTemplate: "LabMachine", Policies: []string{"Lab Policy"}},
+		{RequestID: "req3", Hostname: "host3", Policies: []string{"Kiosk Lockdown"}},
+	} {
+		r.Status = models.RequestStatusAccepted
+		store.Put(r)
+	}
+	rec := spltesting.NewRecorder(spltesting.NewInactiveDirectory())
+	conf := joiner.Config{
+		Domain:               "example.com",
+		Instance:             "joiner1",
+		Workers:              1,
+		CertTemplate:         "Workstation",
+		Policies:             []string{"Baseline"},
+		RootCerts:            true,
+		AllowedCertTemplates: []string{"LabMachine"},
+		AllowedPolicies:      []string{"Lab Policy"},
+	}
+	j := joiner.New(conf, rec, queue, store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	}()
+
+	for _, id := range []string{"req1", "req2", "req3"} {
+		queue.Publish(id)
+	}
+	awaitAcked(t, queue, 3)
+	want := map[string]string{"req1": models.RequestStatusCompleted, "req2": models.RequestStatusCompleted, "req3": models.RequestStatusFailed}
+	deadline := time.Now().Add(10 * time.Second)
+	for id, status := range want {
+		for {
+			got, _ := store.Get(id)
+			if got.Status == status {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("request %s is %s, want %s", id, got.Status, status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The refused request never reaches the provisioner.
+	got := make(map[string]joiner.ProvisionOptions)
+	for _, c := range rec.Calls() {
+		got[c.Options.Name] = c.Options
+	}
+	wantOpts := map[string]joiner.ProvisionOptions{
+		"host1": {Name: "host1", Domain: "example.com", CertTemplate: "Workstation", Policies: []string{"Baseline"}, RootCerts: true},
+		"host2": {Name: "host2", Domain: "example.com", CertTemplate: "LabMachine", Policies: []string{"Baseline", "Lab Policy"}, RootCerts: true},
+	}
+	if diff := cmp.Diff(wantOpts, got); diff != "" {
+		t.Errorf("provisioning options diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunLanes(t *testing.T) {
+	store, bulk, attended := spltesting.NewStore(), spltesting.NewQueue(), spltesting.NewQueue()
+	for _, id := range []string{"req1", "req2"} {
+		store.Put(models.Request{RequestID: id, Hostname: id, Status: models.RequestStatusAccepted})
+	}
+	j := joiner.New(joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1}, spltesting.NewInactiveDirectory(), joiner.Lanes(attended, bulk), store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	}()
+
+	bulk.Publish("req1")
+	attended.Publish("req2")
+	awaitAcked(t, bulk, 1)
+	awaitAcked(t, attended, 1)
+}
+
+// blockingDirectory holds every join until release is closed.
+type blockingDirectory struct {
+	*spltesting.InactiveDirectory
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingDirectory) Provision(ctx context.Context, opts joiner.ProvisionOptions) (joiner.ProvisionResult, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.InactiveDirectory.Provision(ctx, opts)
+}
+
+func TestRunPause(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	for _, id := range []string{"req1", "req2"} {
+		store.Put(models.Request{RequestID: id, Hostname: id, Status: models.RequestStatusAccepted})
+	}
+	ad := &blockingDirectory{InactiveDirectory: spltesting.NewInactiveDirectory(), started: make(chan struct{}, 2), release: make(chan struct{})}
+	j := joiner.New(joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1}, ad, queue, store, spltesting.Logger{Logf: t.Logf}, spltesting.NewTracker())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	}()
+	defer close(ad.release)
+
+	// req1 keeps the only worker busy, so req2 waits for it in the joiner.
+	queue.Publish("req1")
+	<-ad.started
+	queue.Publish("req2")
+	awaitAcked(t, queue, 1)
+	for queue.Pending() != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Pausing returns req2 to the queue at once, without waiting for req1.
+	j.Control.Pause()
+	deadline := time.Now().Add(5 * time.Second)
+	for queue.Nacks() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Nacks() = 0 while req1 is in flight, want req2 returned on pause")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, _ := store.Get("req2"); got.ClaimBy != "" {
+		t.Errorf("req2 claimed by %q after pause, want unclaimed", got.ClaimBy)
+	}
+}
+
+func TestRunMetrics(t *testing.T) {
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	accepted := time.Now().UTC().Add(-time.Minute)
+	for _, id := range []string{"req1", "req2"} {
+		store.Put(models.Request{RequestID: id, Hostname: "host1", Status: models.RequestStatusAccepted, AcceptTime: accepted})
+	}
+	metrics := spltesting.NewTracker()
+	j := joiner.New(joiner.Config{Domain: "example.com", Instance: "joiner1", Workers: 1}, spltesting.NewInactiveDirectory(), queue, store, spltesting.Logger{Logf: t.Logf}, metrics)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan joiner.ExitEvt, 1)
+	go func() { done <- j.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		j.Shutdown()
+	}()
+
+	// The second request fails, as host1 already exists and reuse is denied.
+	queue.Publish("req1")
+	queue.Publish("req2")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		r1, _ := store.Get("req1")
+		r2, _ := store.Get("req2")
+		if r1.Status != models.RequestStatusAccepted && r2.Status != models.RequestStatusAccepted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("requests = %s and %s, want both returned", r1.Status, r2.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	labels := tracker.Labels{"domain": "example.com", "generator": "none", "reuse": "false"}
+	want := []tracker.Series{
+		{Name: "failures", Labels: tracker.Labels{"class": "join"}, Value: 1},
+		{Name: "join_attempt", Labels: labels, Value: 2},
+		{Name: "join_fail", Labels: labels, Value: 1},
+		{Name: "join_success", Labels: labels, Value: 1},
+	}
+	// Outcomes are counted after the result is written.
+	for time.Now().Before(deadline) && len(metrics.Series()) < len(want) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := cmp.Diff(want, metrics.Series()); diff != "" {
+		t.Errorf("Series() returned diff (-want +got):\n%s", diff)
+	}
+
+	counts := make(map[string]uint64)
+	for _, d := range metrics.Histograms() {
+		counts[d.Name] += d.Count
+		if d.Name == "queue_wait_seconds" && d.Sum < time.Minute.Seconds() {
+			t.Errorf("queue_wait_seconds sum = %f, want at least a minute", d.Sum)
+		}
+	}
+	if diff := cmp.Diff(map[string]uint64{"end_to_end_seconds": 2, "provisioning_seconds": 2, "queue_wait_seconds": 2}, counts); diff != "" {
+		t.Errorf("histogram counts diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunTracing(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(old)
+
+	store, queue := spltesting.NewStore(), spltesting.NewQueue()
+	store.Put(models.Request{RequestID: "req1", Hostname: "host1", Status: models.RequestStatusAccepted})
+	run(t, "joiner1", store, queue)
+
+	// The App publishes the trace context of the client's request.
+	client := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}, TraceFlags: trace.FlagsSampled})
+	env := models.Envelope{
+		Version:      models.EnvelopeVersion,
+		RequestID:    "req1",
+		Attempt:      1,
+		TraceContext: tracing.Attributes(trace.ContextWithSpanContext(context.Background(), client)),
+	}
+	data, attrs, err := env.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned %v", err)
+	}
+	queue.PublishMessage(data, attrs)
+
+	want := []string{"claimRequest", "processRequest", "returnRequest", "handleMessage"}
+	deadline := time.Now().Add(10 * time.Second)
+	for len(exp.GetSpans()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var got []string
+	for _, s := range exp.GetSpans() {
+		got = append(got, s.Name)
+		if s.SpanContext.TraceID() != client.TraceID() {
+			t.Errorf("span %s has trace ID %s, want %s", s.Name, s.SpanContext.TraceID(), client.TraceID())
+		}
+		var reqID string
+		for _, a := range s.Attributes {
+			if a.Key == tracing.RequestIDKey {
+				reqID = a.Value.AsString()
+			}
+		}
+		if reqID != "req1" {
+			t.Errorf("span %s has request ID %q, want req1", s.Name, reqID)
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("exported spans diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/google/splice/models"
+)
+
+// DefaultLaneFairness is the lane fairness used when none is configured.
+const DefaultLaneFairness = 4
+
+// Lanes returns a Queue that receives from all of queues at once, such as one
+// subscription per priority lane. Each queue holds up to maxOutstanding
+// unsettled messages of its own, so that a backlog in one lane cannot keep
+// the messages of another from being pulled.
+func Lanes(queues ...Queue) Queue {
+	return lanes(queues)
+}
+
+type lanes []Queue
+
+// Receive implements Queue. If any queue fails, the others are stopped and
+// the first error is returned.
+func (l lanes) Receive(ctx context.Context, maxOutstanding int, deliver func(context.Context, Message)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(l))
+	for _, q := range l {
+		go func(q Queue) {
+			errs <- q.Receive(ctx, maxOutstanding, deliver)
+		}(q)
+	}
+	var first error
+	for range l {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+			cancel()
+		}
+	}
+	return first
+}
+
+// scheduler holds the messages pulled from the queue until a worker is free,
+// and hands them out highest priority first. To keep bulk work from starving,
+// a lane that has been passed over fairness times in a row while it had
+// messages waiting is served next.
+type scheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[int][]Message
+	skipped map[int]int
+	closed  bool
+}
+
+func newScheduler() *scheduler {
+	s := &scheduler{pending: make(map[int][]Message), skipped: make(map[int]int)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// priority returns the priority of the request carried by msg. Messages that
+// cannot be decoded are handled at normal priority, and discarded by the
+// worker that picks them up.
+func priority(msg Message) int {
+	env, err := models.DecodeEnvelope(msg.Data(), msg.Attributes())
+	if err != nil {
+		return models.PriorityNormal
+	}
+	return env.Priority
+}
+
+// push queues msg for the next free worker.
+func (s *scheduler) push(msg Message) {
+	p := priority(msg)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[p] = append(s.pending[p], msg)
+	s.cond.Signal()
+}
+
+// pop waits for a message and removes it from the scheduler. It returns false
+// once the scheduler is closed.
+func (s *scheduler) pop(fairness int) (Message, bool) {
+	if fairness < 1 {
+		fairness = DefaultLaneFairness
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.pending) == 0 && !s.closed {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return nil, false
+	}
+
+	waiting := make([]int, 0, len(s.pending))
+	for p := range s.pending {
+		waiting = append(waiting, p)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(waiting)))
+	lane := waiting[0]
+	for _, p := range waiting[1:] {
+		if s.skipped[p] >= fairness {
+			lane = p
+			break
+		}
+	}
+	for _, p := range waiting {
+		if p < lane {
+			s.skipped[p]++
+		}
+	}
+	delete(s.skipped, lane)
+
+	msg := s.pending[lane][0]
+	if s.pending[lane] = s.pending[lane][1:]; len(s.pending[lane]) == 0 {
+		delete(s.pending, lane)
+	}
+	return msg, true
+}
+
+// flush returns every waiting message to the queue with err.
+func (s *scheduler) flush(err error) {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[int][]Message)
+	s.skipped = make(map[int]int)
+	s.mu.Unlock()
+	for _, msgs := range pending {
+		for _, msg := range msgs {
+			msg.Settle(err)
+		}
+	}
+}
+
+// close wakes all workers waiting in pop, which return false.
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/splice/models"
+)
+
+// fakeMessage carries an envelope for the request id at priority.
+type fakeMessage struct {
+	id       string
+	priority int
+	settled  error
+}
+
+func (m *fakeMessage) Data() []byte {
+	data, _, err := models.Envelope{Version: models.EnvelopeVersion, RequestID: m.id, Priority: m.priority}.Encode()
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func (m *fakeMessage) Attributes() map[string]string { return nil }
+
+func (m *fakeMessage) Settle(err error) { m.settled = err }
+
+func TestSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		desc     string
+		fairness int
+		in       string
+		want     string
+	}{
+		{"one lane", 2, "b1 b2 b3", "b1 b2 b3"},
+		{"attended first", 10, "b1 b2 a1 a2", "a1 a2 b1 b2"},
+		{"bulk served every third message", 2, "b1 b2 a1 a2 a3 a4 a5", "a1 a2 b1 a3 a4 b2 a5"},
+		{"legacy at normal priority", 2, "legacy a1", "a1 legacy"},
+	}
+	for _, tt := range tests {
+		s := newScheduler()
+		for _, id := range strings.Fields(tt.in) {
+			p := models.PriorityNormal
+			if strings.HasPrefix(id, "a") {
+				p = models.PriorityAttended
+			}
+			var msg Message = &fakeMessage{id: id, priority: p}
+			if id == "legacy" {
+				msg = legacyMessage(id)
+			}
+			s.push(msg)
+		}
+		var got []string
+		for range strings.Fields(tt.in) {
+			msg, ok := s.pop(tt.fairness)
+			if !ok {
+				t.Fatalf("%s: pop() returned false with messages waiting", tt.desc)
+			}
+			got = append(got, requestID(t, msg))
+		}
+		if diff := cmp.Diff(strings.Fields(tt.want), got); diff != "" {
+			t.Errorf("%s: order diff (-want +got):\n%s", tt.desc, diff)
+		}
+	}
+}
+
+func TestSchedulerFlush(t *testing.T) {
+	s := newScheduler()
+	msgs := []*fakeMessage{{id: "b1"}, {id: "a1", priority: models.PriorityAttended}}
+	for _, m := range msgs {
+		s.push(m)
+	}
+	stopped := errors.New("receiver stopped")
+	s.flush(stopped)
+	for _, m := range msgs {
+		if m.settled != stopped {
+			t.Errorf("message %s settled with %v, want %v", m.id, m.settled, stopped)
+		}
+	}
+
+	done := make(chan bool)
+	go func() {
+		_, ok := s.pop(1)
+		done <- ok
+	}()
+	s.close()
+	if <-done {
+		t.Error("pop() returned true after close, want false")
+	}
+}
+
+// legacyMessage carries a bare request ID.
+type legacyMessage string
+
+func (m legacyMessage) Data() []byte                  { return []byte(m) }
+func (m legacyMessage) Attributes() map[string]string { return nil }
+func (m legacyMessage) Settle(error)                  {}
+
+func requestID(t *testing.T, msg Message) string {
+	t.Helper()
+	env, err := models.DecodeEnvelope(msg.Data(), msg.Attributes())
+	if err != nil {
+		t.Fatalf("DecodeEnvelope() returned %v", err)
+	}
+	return env.RequestID
+}
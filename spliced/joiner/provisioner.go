@@ -0,0 +1,119 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrTransient is wrapped by Provisioner errors showing that the domain
+	// controller was never reached or could not serve the domain. The request is then retried against the
+	// next preferred domain controller, so errors raised after a DC may have
+	// acted on the request must not wrap it.
+	ErrTransient = errors.New("transient provisioning failure")
+
+	// ErrAccountExists is wrapped by Provisioner errors for a machine account
+	// that already exists when reuse is not permitted.
+	ErrAccountExists = errors.New("reuse disabled and host already exists")
+
+	// ErrUnsupported is wrapped by Provisioner errors for options that the
+	// provisioner cannot honor.
+	ErrUnsupported = errors.New("provisioning option is not supported")
+)
+
+// ProvisionOptions describes the machine account to provision and the
+// metadata to return for it.
+type ProvisionOptions struct {
+	// Name is the host name of the machine account.
+	Name string
+	// Domain is the domain the machine account is created in.
+	Domain string
+	// OU is the distinguished name of the organizational unit the machine
+	// account is created in, or empty for the default computers container.
+	OU string
+	// DC is the domain controller to provision against, or empty to let the
+	// platform choose one.
+	DC string
+	// Reuse permits an existing machine account of the same name to be
+	// reused. Otherwise provisioning fails with ErrAccountExists.
+	Reuse bool
+
+	// CertTemplate names a certificate template the host enrolls with once
+	// joined.
+	CertTemplate string
+	// Policies lists the names of group policy objects applied to the host
+	// when it is joined.
+	Policies []string
+	// RootCerts embeds the root certificates of the domain in the metadata.
+	RootCerts bool
+}
+
+// ProvisionResult holds the outcome of a successful provisioning call.
+type ProvisionResult struct {
+	// Blob holds the provisioning metadata for the host.
+	Blob []byte
+	// DC is the domain controller that provisioned the machine account, if
+	// known.
+	DC string
+	// AccountDN is the distinguished name of the machine account.
+	AccountDN string
+}
+
+// Provisioner creates machine accounts and returns the provisioning metadata
+// that joins a host to them.
+type Provisioner interface {
+	// Provision creates or, if permitted, reuses the machine account
+	// described by opts. Errors showing that opts.DC could not be reached
+	// must wrap ErrTransient.
+	Provision(ctx context.Context, opts ProvisionOptions) (ProvisionResult, error)
+}
+
+// ProvisionError describes a failed provisioning call.
+type ProvisionError struct {
+	// DC is the domain controller the call was made against, if any.
+	DC string
+	// Err is the cause of the failure, which typically wraps one of
+	// ErrTransient, ErrAccountExists or ErrUnsupported.
+	Err error
+}
+
+func (e *ProvisionError) Error() string {
+	if e.DC == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("domain controller %s: %v", e.DC, e.Err)
+}
+
+func (e *ProvisionError) Unwrap() error {
+	return e.Err
+}
+
+// AccountDN returns the distinguished name of the machine account for name
+// in the organizational unit ou, or in the default computers container of
+// domain if ou is empty.
+func AccountDN(name, domain, ou string) string {
+	if ou != "" {
+		return "CN=" + name + "," + ou
+	}
+	dn := "CN=" + name + ",CN=Computers"
+	for _, label := range strings.Split(domain, ".") {
+		dn += ",DC=" + label
+	}
+	return dn
+}
@@ -0,0 +1,359 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package joiner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/splice/generators"
+	"github.com/google/splice/models"
+	"github.com/google/splice/shared/certs"
+	"github.com/google/splice/shared/crypto"
+	"github.com/google/splice/shared/tracing"
+	"github.com/google/splice/spliced/metric/tracker"
+)
+
+// errLeaseLost indicates that a lease is no longer held by this instance.
+var errLeaseLost = errors.New("lease is no longer held")
+
+// newLeaseID returns a random identifier for a new claim.
+func newLeaseID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("newLeaseID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// returnRequest passes the result of the operation to the store on its way to the client.
+// The result is only written if this instance still holds the lease on req.
+// The outcome is counted under labels once the result is written.
+func (j *Joiner) returnRequest(ctx context.Context, req *models.Request, labels tracker.Labels, success bool, meta *crypto.Metadata) (err error) {
+	ctx, span := tracing.Start(ctx, "returnRequest", req.RequestID)
+	defer func() { tracing.End(span, err) }()
+
+	var returned models.Request
+	instance := j.Config().Instance
+	err = j.store.Update(ctx, req.RequestID, func(r *models.Request) error {
+		// The lease may have lapsed while the request was being processed, in
+		// which case the request may now be claimed by another joiner.
+		if !r.HoldsLease(instance, req.LeaseID) {
+			return fmt.Errorf("returnRequest: lease on request is no longer held (status %s, claimed by %q), refusing to overwrite it", r.Status, r.ClaimBy)
+		}
+
+		r.ResponseData = meta.Data
+		r.DomainController = req.DomainController
+		if success {
+			r.Status = models.RequestStatusCompleted
+			r.ResponseKey = meta.AESKey
+			r.CipherNonce = meta.Nonce
+		} else {
+			r.Status = models.RequestStatusFailed
+		}
+
+		r.CompletionTime = time.Now().UTC()
+		r.LeaseExpiry = time.Time{}
+		returned = *r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	result := "success"
+	if success {
+		j.metrics.With("join_success", labels).Increment()
+	} else {
+		result = "failure"
+		j.metrics.With("join_fail", labels).Increment()
+	}
+	if !returned.AcceptTime.IsZero() {
+		e2e := labels.With("result", result)
+		j.metrics.Histogram("end_to_end_seconds", e2e).Observe(returned.CompletionTime.Sub(returned.AcceptTime).Seconds())
+	}
+	return nil
+}
+
+// claimRequest attempts to claim a new join request from the store.
+//
+// A successful claim holds a lease on the request until LeaseExpiry, which
+// must be renewed with renewLease for as long as the request is processed.
+// Requests claimed by another joiner whose lease has lapsed may be claimed.
+//
+// Errors wrapping ErrHandled indicate that the request no longer needs
+// processing, either because it does not exist or because it was claimed by
+// another joiner. A request already claimed by this instance is claimed again,
+// so that a redelivery following a crash picks up where the joiner left off.
+func (j *Joiner) claimRequest(ctx context.Context, reqID string) (claimed models.Request, err error) {
+	ctx, span := tracing.Start(ctx, "claimRequest", reqID)
+	defer func() {
+		// Handled requests are not failures, as there is nothing left to do.
+		spanErr := err
+		if errors.Is(err, ErrHandled) {
+			span.AddEvent(err.Error())
+			spanErr = nil
+		}
+		tracing.End(span, spanErr)
+	}()
+
+	conf := j.Config()
+	err = j.store.Update(ctx, reqID, func(req *models.Request) error {
+		now := time.Now().UTC()
+		claimable := req.ClaimBy == "" || req.ClaimBy == conf.Instance || req.LeaseExpired(now)
+		if req.Status != models.RequestStatusAccepted || !claimable {
+			return fmt.Errorf("%w: claimRequest: request to %s already %s and will be ignored", ErrHandled, req.ClaimBy, req.Status)
+		}
+		// Messages from older Apps carry no domain, so the request itself
+		// is checked before it is claimed.
+		if _, _, ok := conf.Lookup(req.Domain); !ok {
+			return fmt.Errorf("claimRequest: %w: %s", errOtherDomain, req.Domain)
+		}
+
+		var err error
+		if req.LeaseID, err = newLeaseID(); err != nil {
+			return err
+		}
+		req.ClaimBy = conf.Instance
+		req.ClaimTime = now
+		req.LeaseExpiry = now.Add(j.LeaseDuration)
+		claimed = *req
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return claimed, fmt.Errorf("%w: %v", ErrHandled, err)
+	}
+	return claimed, err
+}
+
+// renewLease extends the lease identified by leaseID on a request claimed by
+// this instance.
+func (j *Joiner) renewLease(ctx context.Context, reqID, leaseID string) error {
+	instance := j.Config().Instance
+	return j.store.Update(ctx, reqID, func(req *models.Request) error {
+		if !req.HoldsLease(instance, leaseID) {
+			return fmt.Errorf("renewLease: %w (status %s, claimed by %q)", errLeaseLost, req.Status, req.ClaimBy)
+		}
+		req.LeaseExpiry = time.Now().UTC().Add(j.LeaseDuration)
+		return nil
+	})
+}
+
+// heartbeat renews the lease identified by leaseID every j.LeaseRenewal until
+// ctx is cancelled or the lease is lost.
+func (j *Joiner) heartbeat(ctx context.Context, reqID, leaseID string) {
+	ticker := time.NewTicker(j.LeaseRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := j.renewLease(ctx, reqID, leaseID)
+		if errors.Is(err, errLeaseLost) {
+			j.log.Warningf(EvtErrClaim, "Lost the lease on request %s: %v", reqID, err)
+			j.fail("failure_206")
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			// Keep trying; the lease only lapses after LeaseDuration.
+			j.log.Warningf(EvtErrClaim, "Failed to renew the lease on request %s: %v", reqID, err)
+		}
+	}
+}
+
+// releaseRequest hands a request claimed by this instance back to the
+// Accepted state, so that it can be claimed by another joiner once it is
+// republished. Requests no longer claimed by this instance are left alone.
+func (j *Joiner) releaseRequest(ctx context.Context, reqID string) error {
+	errSkip := errors.New("request is not claimed by this instance")
+	instance := j.Config().Instance
+	err := j.store.Update(ctx, reqID, func(req *models.Request) error {
+		if req.Status != models.RequestStatusAccepted || req.ClaimBy != instance {
+			return errSkip
+		}
+		req.ClaimBy = ""
+		req.ClaimTime = time.Time{}
+		req.LeaseID = ""
+		req.LeaseExpiry = time.Time{}
+		return nil
+	})
+	if errors.Is(err, errSkip) {
+		return nil
+	}
+	return err
+}
+
+// requestLabels returns the labels under which metrics describing req are
+// counted.
+func requestLabels(req *models.Request, conf Config) tracker.Labels {
+	generator := req.GeneratorID
+	if generator == "" {
+		generator = "none"
+	}
+	domain, _, _ := conf.Lookup(req.Domain)
+	return tracker.Labels{
+		"domain":    domain,
+		"generator": generator,
+		"reuse":     strconv.FormatBool(permitReuse(req, conf)),
+	}
+}
+
+func permitReuse(req *models.Request, conf Config) bool {
+	// Always deny reuse if configured locally for the domain
+	if _, dc, _ := conf.Lookup(req.Domain); !dc.PermitReuse {
+		return false
+	}
+	// If allowed locally, do what the server wants
+	return req.AttemptReuse
+}
+
+func (j *Joiner) getName(req *models.Request) (string, error) {
+	if req.Hostname != "" {
+		return req.Hostname, nil
+	}
+	if req.GeneratorID == "" {
+		return "", errors.New("request must contain either Hostname or GeneratorID")
+	}
+	j.log.Infof(EvtNameGeneration, "Attempting hostname generation using generator %s for request %s.", req.GeneratorID, req.RequestID)
+	return generators.Run(req.GeneratorID, req.GeneratorData)
+}
+
+// join provisions the machine account of req. The certificate template,
+// policies and root certificate settings of the provisioning package are
+// taken from pkg.
+func (j *Joiner) join(ctx context.Context, req *models.Request, conf Config, pkg ProvisionOptions) ([]byte, error) {
+	wantName, err := j.getName(req)
+	if err != nil {
+		j.log.Warningf(EvtErrNaming, "Failed to determine a hostname for request %s: %v", req.RequestID, err)
+		return nil, err
+	}
+
+	domain, dc, ok := conf.Lookup(req.Domain)
+	if !ok {
+		return nil, fmt.Errorf("domain %s is not served by this joiner", req.Domain)
+	}
+	reuse := permitReuse(req, conf)
+	j.log.Infof(EvtJoinAttempt, "Attempting to join host %s to domain %s in OU %q. Hostname reuse is set to %t.", wantName, domain, req.OU, reuse)
+	labels := requestLabels(req, conf)
+	j.metrics.With("join_attempt", labels).Increment()
+	start := time.Now()
+	defer func() {
+		j.metrics.Histogram("provisioning_seconds", labels).Observe(time.Since(start).Seconds())
+	}()
+
+	// Transient failures are retried against the next preferred domain
+	// controller. The one used last is recorded on the request, to help
+	// troubleshoot replication delays.
+	dcs := dc.Controllers(conf.Site)
+	for i, name := range dcs {
+		req.DomainController = name
+		opts := pkg
+		opts.Name, opts.Domain, opts.OU, opts.DC, opts.Reuse = wantName, domain, req.OU, name, reuse
+		res, err := j.provisioner.Provision(ctx, opts)
+		if err == nil {
+			if res.DC != "" {
+				req.DomainController = res.DC
+			}
+			j.log.Infof(EvtJoinSuccess, "Computer object %q joined to domain %q as %q using domain controller %q", wantName, domain, res.AccountDN, req.DomainController)
+			return res.Blob, nil
+		}
+		if !errors.Is(err, ErrTransient) || i == len(dcs)-1 {
+			j.log.Warningf(EvtJoinFailure, "Failed to join host %s to domain %s (reuse=%t, dc=%q) with: %v", wantName, domain, reuse, name, err)
+			return nil, err
+		}
+		j.log.Warningf(EvtJoinFailure, "Failed to join host %s to domain %s using domain controller %q, trying %q next: %v", wantName, domain, name, dcs[i+1], err)
+	}
+	return nil, errors.New("no domain controller to provision against")
+}
+
+// processRequest takes a claimed request, performs any necessary
+// checks, processes it and always returns a metadata object
+// with the results. Errors in this func are considered non-fatal
+// and are logged and returned within the metadata for display to
+// the client. The request is processed with the configuration current
+// when processing starts.
+func (j *Joiner) processRequest(ctx context.Context, req *models.Request) (meta crypto.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "processRequest", req.RequestID)
+	defer func() { tracing.End(span, err) }()
+	conf := j.Config()
+
+	var fqdn string
+	if req.Hostname != "" {
+		domain, _, _ := conf.Lookup(req.Domain)
+		fqdn = req.Hostname + "." + domain
+	}
+
+	if err := certs.VerifyCert(req.ClientCert, fqdn, conf.CaURL, conf.CaURLPath, conf.CaOrg, conf.RootsPath, conf.VerifyCert); err != nil {
+		j.log.Warningf(EvtErrVerification, "Client verification failed: %v", err)
+		j.fail("failure_211")
+		meta.Data = []byte(err.Error())
+		return meta, err
+	}
+
+	// The App checks the OU, certificate template and policies against its
+	// own allowlists, but the joiner has the final say over how machine
+	// accounts are provisioned.
+	_, dc, _ := conf.Lookup(req.Domain)
+	if !dc.AllowsOU(req.OU) {
+		err := fmt.Errorf("OU %q is not allowed by this joiner", req.OU)
+		j.log.Warningf(EvtErrOU, "Request %s was refused: %v", req.RequestID, err)
+		j.fail("failure_213")
+		meta.Data = []byte(err.Error())
+		return meta, err
+	}
+	template, policies, err := dc.Package(req.CertTemplate, req.Policies)
+	if err != nil {
+		j.log.Warningf(EvtErrPackage, "Request %s was refused: %v", req.RequestID, err)
+		j.fail("failure_214")
+		meta.Data = []byte(err.Error())
+		return meta, err
+	}
+
+	blob, err := j.join(ctx, req, conf, ProvisionOptions{CertTemplate: template, Policies: policies, RootCerts: dc.RootCerts})
+	if err != nil {
+		j.fail("failure_207")
+		meta.Data = []byte(err.Error())
+		return meta, err
+	}
+	meta.Data = blob
+
+	// Requests the App enforced an encryption policy on are encrypted even
+	// if this joiner does not require it.
+	if conf.EncryptBlob || req.EncryptionPolicy != "" {
+		pub, err := certs.PublicKey(req.ClientCert)
+		if err != nil {
+			j.log.Warningf(EvtErrEncryption, "Unable to obtain certificate public key: %v", err)
+			j.fail("failure_212")
+			meta.Data = []byte(err.Error())
+			return meta, err
+		}
+
+		if err := meta.Encrypt(pub); err != nil {
+			j.log.Warningf(EvtErrEncryption, "encryptMeta: %v", err)
+			j.fail("failure_210")
+			meta.Data = []byte(err.Error())
+			return meta, err
+		}
+	}
+
+	return meta, nil
+}
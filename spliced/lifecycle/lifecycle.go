@@ -0,0 +1,214 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lifecycle coordinates pausing, draining and stopping the SpliceD
+// workers independently of the Windows service that manages them.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrPaused is returned when new work is refused because the controller is paused.
+	ErrPaused = errors.New("joiner is paused")
+	// ErrStopping is returned when new work is refused because the controller is stopping.
+	ErrStopping = errors.New("joiner is stopping")
+	// ErrDuplicate is returned when a request is already being worked on.
+	ErrDuplicate = errors.New("request is already in flight")
+)
+
+// Controller gates new work while paused and tracks the requests that are in
+// flight, so that they can be drained or released on shutdown. A Controller
+// is safe for concurrent use.
+type Controller struct {
+	mu       sync.Mutex
+	paused   bool
+	stopping bool
+	inflight map[string]bool
+	// changed is closed and replaced every time the state of the controller
+	// changes, waking up anything waiting on a transition.
+	changed chan struct{}
+}
+
+// New returns a running Controller.
+func New() *Controller {
+	return &Controller{
+		inflight: make(map[string]bool),
+		changed:  make(chan struct{}),
+	}
+}
+
+// notify wakes up all waiters. c.mu must be held.
+func (c *Controller) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Pause stops the controller from admitting new work. Work already in flight
+// is unaffected.
+func (c *Controller) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = true
+	c.notify()
+}
+
+// Resume admits new work after a call to Pause.
+func (c *Controller) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = false
+	c.notify()
+}
+
+// Paused reports whether the controller is paused.
+func (c *Controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// WaitRunning blocks until the controller is not paused. It returns an error
+// if ctx is cancelled first or the controller is stopping.
+func (c *Controller) WaitRunning(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		paused, stopping, changed := c.paused, c.stopping, c.changed
+		c.mu.Unlock()
+		if stopping {
+			return ErrStopping
+		}
+		if !paused {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// RunningContext returns a copy of ctx that is cancelled as soon as the
+// controller is paused or stopped. It is used to bound receivers that should
+// only pull new work while the controller is running.
+func (c *Controller) RunningContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	rctx, cancel := context.WithCancel(ctx)
+	go func() {
+		for {
+			c.mu.Lock()
+			running, changed := !c.paused && !c.stopping, c.changed
+			c.mu.Unlock()
+			if !running {
+				cancel()
+				return
+			}
+			select {
+			case <-rctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}()
+	return rctx, cancel
+}
+
+// Begin registers reqID as in flight. It returns ErrPaused or ErrStopping if
+// new work is not currently admitted, and ErrDuplicate if reqID is already in
+// flight. Every successful call to Begin must be paired with a call to End.
+func (c *Controller) Begin(reqID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.stopping:
+		return ErrStopping
+	case c.paused:
+		return ErrPaused
+	case c.inflight[reqID]:
+		return fmt.Errorf("%w: %s", ErrDuplicate, reqID)
+	}
+	c.inflight[reqID] = true
+	return nil
+}
+
+// End marks reqID as no longer in flight.
+func (c *Controller) End(reqID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, reqID)
+	c.notify()
+}
+
+// InFlight returns the sorted IDs of all requests currently in flight.
+func (c *Controller) InFlight() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make([]string, 0, len(c.inflight))
+	for id := range c.inflight {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Drain blocks until no requests are in flight or ctx is done, whichever
+// comes first. New work is still admitted unless the controller is paused or
+// stopping.
+func (c *Controller) Drain(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		n, changed := len(c.inflight), c.changed
+		c.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests still in flight: %w", n, ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// Shutdown permanently stops the controller from admitting new work and
+// drains the requests in flight until ctx is done. Requests that are still in
+// flight after that are passed to release, so that they can be handed back
+// for another joiner to claim. Shutdown returns the IDs of the released
+// requests along with any errors returned by release.
+func (c *Controller) Shutdown(ctx context.Context, release func(reqID string) error) ([]string, error) {
+	c.mu.Lock()
+	c.stopping = true
+	c.notify()
+	c.mu.Unlock()
+
+	if err := c.Drain(ctx); err == nil {
+		return nil, nil
+	}
+
+	var released []string
+	var errs []error
+	for _, id := range c.InFlight() {
+		if err := release(id); err != nil {
+			errs = append(errs, fmt.Errorf("releasing %s: %w", id, err))
+			continue
+		}
+		released = append(released, id)
+	}
+	return released, errors.Join(errs...)
+}
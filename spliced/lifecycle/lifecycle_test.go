@@ -0,0 +1,150 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBegin(t *testing.T) {
+	c := New()
+	if err := c.Begin("req1"); err != nil {
+		t.Fatalf("Begin(req1) = %v, want nil", err)
+	}
+	if err := c.Begin("req1"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Begin(req1) for a duplicate = %v, want %v", err, ErrDuplicate)
+	}
+	c.Pause()
+	if err := c.Begin("req2"); !errors.Is(err, ErrPaused) {
+		t.Errorf("Begin(req2) while paused = %v, want %v", err, ErrPaused)
+	}
+	c.Resume()
+	if err := c.Begin("req2"); err != nil {
+		t.Errorf("Begin(req2) after resume = %v, want nil", err)
+	}
+	if diff := cmp.Diff([]string{"req1", "req2"}, c.InFlight()); diff != "" {
+		t.Errorf("InFlight() produced unexpected diff: %v", diff)
+	}
+	c.End("req1")
+	if diff := cmp.Diff([]string{"req2"}, c.InFlight()); diff != "" {
+		t.Errorf("InFlight() after End produced unexpected diff: %v", diff)
+	}
+}
+
+func TestWaitRunning(t *testing.T) {
+	c := New()
+	c.Pause()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.WaitRunning(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitRunning() while paused = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error)
+	go func() { done <- c.WaitRunning(context.Background()) }()
+	c.Resume()
+	if err := <-done; err != nil {
+		t.Errorf("WaitRunning() after resume = %v, want nil", err)
+	}
+}
+
+func TestRunningContext(t *testing.T) {
+	c := New()
+	ctx, cancel := c.RunningContext(context.Background())
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("RunningContext() while running: ctx.Err() = %v, want nil", err)
+	}
+	c.Pause()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("RunningContext() was not cancelled by Pause")
+	}
+
+	ctx, cancel = c.RunningContext(context.Background())
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("RunningContext() while paused was not cancelled")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	c := New()
+	if err := c.Begin("req1"); err != nil {
+		t.Fatalf("Begin(req1) = %v, want nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Drain(ctx); err == nil {
+		t.Errorf("Drain() with work in flight = nil, want err")
+	}
+
+	go c.End("req1")
+	if err := c.Drain(context.Background()); err != nil {
+		t.Errorf("Drain() = %v, want nil", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		desc     string
+		finish   bool
+		released []string
+	}{
+		{"in-flight work finishes", true, nil},
+		{"in-flight work is released", false, []string{"req1"}},
+	}
+	for _, tt := range tests {
+		c := New()
+		if err := c.Begin("req1"); err != nil {
+			t.Fatalf("%s: Begin(req1) = %v, want nil", tt.desc, err)
+		}
+		if tt.finish {
+			go func() {
+				time.Sleep(5 * time.Millisecond)
+				c.End("req1")
+			}()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		var got []string
+		released, err := c.Shutdown(ctx, func(id string) error {
+			got = append(got, id)
+			return nil
+		})
+		cancel()
+		if err != nil {
+			t.Errorf("%s: Shutdown() = %v, want nil", tt.desc, err)
+		}
+		if diff := cmp.Diff(tt.released, released); diff != "" {
+			t.Errorf("%s: Shutdown() produced unexpected diff: %v", tt.desc, diff)
+		}
+		if diff := cmp.Diff(tt.released, got); diff != "" {
+			t.Errorf("%s: release was called with unexpected diff: %v", tt.desc, diff)
+		}
+		if err := c.Begin("req2"); !errors.Is(err, ErrStopping) {
+			t.Errorf("%s: Begin(req2) after Shutdown = %v, want %v", tt.desc, err, ErrStopping)
+		}
+	}
+}
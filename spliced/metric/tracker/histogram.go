@@ -0,0 +1,112 @@
+/*
+Copyright 2026 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"sort"
+	"sync"
+)
+
+// Distribution is the state of a histogram for one set of labels.
+type Distribution struct {
+	Name   string
+	Labels Labels
+	// Buckets holds the inclusive upper bound of each bucket.
+	Buckets []float64
+	// Counts holds the number of observations in each bucket, excluding those
+	// counted by earlier buckets. Observations above the last bound are only
+	// reflected in Count.
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// histogram holds the series of a histogram, all sharing the same buckets.
+type histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*distribution
+}
+
+func newHistogram(buckets []float64) *histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &histogram{buckets: b, series: make(map[string]*distribution)}
+}
+
+// with returns the series of h identified by labels, creating it if necessary.
+func (h *histogram) with(labels Labels) *distribution {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := labels.key()
+	d, ok := h.series[key]
+	if !ok {
+		d = &distribution{labels: labels.clone(), buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = d
+	}
+	return d
+}
+
+func (h *histogram) snapshot(name string) []Distribution {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	dists := make([]Distribution, 0, len(h.series))
+	for _, d := range h.series {
+		dists = append(dists, d.snapshot(name))
+	}
+	return dists
+}
+
+// distribution implements Observer for one series of a histogram.
+type distribution struct {
+	labels  Labels
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe implements Observer.
+func (d *distribution) Observe(v float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if i := sort.SearchFloat64s(d.buckets, v); i < len(d.buckets) {
+		d.counts[i]++
+	}
+	d.count++
+	d.sum += v
+}
+
+func (d *distribution) snapshot(name string) Distribution {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return Distribution{
+		Name:    name,
+		Labels:  d.labels.clone(),
+		Buckets: append([]float64(nil), d.buckets...),
+		Counts:  append([]uint64(nil), d.counts...),
+		Count:   d.count,
+		Sum:     d.sum,
+	}
+}
@@ -15,10 +15,18 @@ limitations under the License.
 */
 
 // Package tracker manages all internal state metrics for the SpliceD application.
+//
+// Metrics registered with Add are reported to the metric backend. Series of a
+// metric that carry labels, and histograms, are only held in memory, from
+// where they are exported by the health listener.
 package tracker
 
 import (
+	"sort"
+	"strings"
 	"sync"
+
+	"go.uber.org/atomic"
 )
 
 // Metric models a metric tracking the internal state of the SpliceD application.
@@ -27,25 +35,82 @@ type Metric interface {
 	Set(int64) error
 }
 
+// Observer models a metric that records a distribution of observed values.
+type Observer interface {
+	Observe(float64)
+}
+
+// Labels identify a series of a metric, such as the generator a request used.
+type Labels map[string]string
+
+// key returns a canonical representation of l.
+func (l Labels) key() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(l[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// clone returns a copy of l.
+func (l Labels) clone() Labels {
+	c := make(Labels, len(l))
+	for k, v := range l {
+		c[k] = v
+	}
+	return c
+}
+
+// With returns a copy of l that also holds the label name set to value.
+func (l Labels) With(name, value string) Labels {
+	c := l.clone()
+	c[name] = value
+	return c
+}
+
+// discard is a Metric and Observer that ignores all updates. It is returned
+// for metrics that were never registered.
+type discard struct{}
+
+func (discard) Increment() error { return nil }
+func (discard) Set(int64) error  { return nil }
+func (discard) Observe(float64)  {}
+
 // Tracker maintains a map of all internal metrics.
 type Tracker struct {
-	mu       sync.Mutex
-	counters map[string]Metric
+	mu         sync.Mutex
+	counters   map[string]Metric
+	series     map[string]map[string]*labeled
+	histograms map[string]*histogram
 }
 
 // New allocates a new metric Tracker object.
 func New() *Tracker {
 	return &Tracker{
-		counters: make(map[string]Metric),
+		counters:   make(map[string]Metric),
+		series:     make(map[string]map[string]*labeled),
+		histograms: make(map[string]*histogram),
 	}
 }
 
-// Get retrieves a metric by name.
+// Get retrieves a metric by name. Updates to metrics that were never
+// registered with Add are discarded.
 func (t *Tracker) Get(name string) Metric {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	return t.counters[name]
+	if m, ok := t.counters[name]; ok {
+		return m
+	}
+	return discard{}
 }
 
 // Add adds a new metric to the tracker.
@@ -55,3 +120,160 @@ func (t *Tracker) Add(name string, m Metric) {
 
 	t.counters[name] = m
 }
+
+// labeled is the series of a metric for one set of labels. Increments are also
+// applied to the metric itself, which holds the total across all series. Set
+// only affects the series, as a gauge has no meaningful total.
+type labeled struct {
+	labels Labels
+	parent Metric
+	value  atomic.Int64
+}
+
+func (l *labeled) Increment() error {
+	l.value.Inc()
+	return l.parent.Increment()
+}
+
+func (l *labeled) Set(v int64) error {
+	l.value.Store(v)
+	return nil
+}
+
+// With retrieves the series of the metric name identified by labels, creating
+// it if necessary. Increments of the series also increment the metric returned
+// by Get(name).
+func (t *Tracker) With(name string, labels Labels) Metric {
+	parent := t.Get(name)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := labels.key()
+	if t.series[name] == nil {
+		t.series[name] = make(map[string]*labeled)
+	}
+	l, ok := t.series[name][key]
+	if !ok {
+		l = &labeled{labels: labels.clone(), parent: parent}
+		t.series[name][key] = l
+	}
+	return l
+}
+
+// AddHistogram registers a histogram counting observations into buckets,
+// which are the inclusive upper bounds of each bucket in increasing order.
+func (t *Tracker) AddHistogram(name string, buckets []float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.histograms[name] = newHistogram(buckets)
+}
+
+// Histogram retrieves the series of the histogram name identified by labels.
+// Observations of histograms that were never registered with AddHistogram are
+// discarded.
+func (t *Tracker) Histogram(name string, labels Labels) Observer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.histograms[name]
+	if !ok {
+		return discard{}
+	}
+	return h.with(labels)
+}
+
+// Valuer is implemented by metrics whose current value can be read back.
+type Valuer interface {
+	Value() int64
+}
+
+// Recorder wraps a Metric and records its value locally, so that metrics
+// reported to a remote backend can also be read back.
+type Recorder struct {
+	m     Metric
+	value atomic.Int64
+}
+
+// NewRecorder returns a Recorder forwarding updates to m.
+func NewRecorder(m Metric) *Recorder {
+	return &Recorder{m: m}
+}
+
+// Increment increments the recorded value and the wrapped metric.
+func (r *Recorder) Increment() error {
+	r.value.Inc()
+	return r.m.Increment()
+}
+
+// Set sets the recorded value and the wrapped metric.
+func (r *Recorder) Set(v int64) error {
+	r.value.Store(v)
+	return r.m.Set(v)
+}
+
+// Value returns the recorded value.
+func (r *Recorder) Value() int64 {
+	return r.value.Load()
+}
+
+// Snapshot returns the current value of every metric implementing Valuer.
+func (t *Tracker) Snapshot() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	values := make(map[string]int64)
+	for name, m := range t.counters {
+		if v, ok := m.(Valuer); ok {
+			values[name] = v.Value()
+		}
+	}
+	return values
+}
+
+// Series is the value of a metric for one set of labels.
+type Series struct {
+	Name   string
+	Labels Labels
+	Value  int64
+}
+
+// Series returns every labeled series, ordered by metric name and labels.
+func (t *Tracker) Series() []Series {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var series []Series
+	for name, byKey := range t.series {
+		for _, l := range byKey {
+			series = append(series, Series{Name: name, Labels: l.labels.clone(), Value: l.value.Load()})
+		}
+	}
+	sort.Slice(series, func(i, k int) bool {
+		if series[i].Name != series[k].Name {
+			return series[i].Name < series[k].Name
+		}
+		return series[i].Labels.key() < series[k].Labels.key()
+	})
+	return series
+}
+
+// Histograms returns every histogram series, ordered by histogram name and
+// labels.
+func (t *Tracker) Histograms() []Distribution {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var dists []Distribution
+	for name, h := range t.histograms {
+		dists = append(dists, h.snapshot(name)...)
+	}
+	sort.Slice(dists, func(i, k int) bool {
+		if dists[i].Name != dists[k].Name {
+			return dists[i].Name < dists[k].Name
+		}
+		return dists[i].Labels.key() < dists[k].Labels.key()
+	})
+	return dists
+}
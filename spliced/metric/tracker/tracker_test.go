@@ -39,3 +39,91 @@ func TestAdd(t *testing.T) {
 		t.Fatalf("m.Get(test1): got %v, want %v", out, in)
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	m := New()
+	m.Add("unreadable", &TestMetric{Name: "unreadable"})
+	m.Add("counter", NewRecorder(&TestMetric{Name: "counter"}))
+	m.Add("gauge", NewRecorder(&TestMetric{Name: "gauge"}))
+
+	m.Get("counter").Increment()
+	m.Get("counter").Increment()
+	m.Get("gauge").Set(7)
+
+	want := map[string]int64{"counter": 2, "gauge": 7}
+	if diff := cmp.Diff(want, m.Snapshot()); diff != "" {
+		t.Errorf("Snapshot() returned diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetUnregistered(t *testing.T) {
+	m := New()
+	if err := m.Get("missing").Increment(); err != nil {
+		t.Errorf("Get(missing).Increment() returned %v", err)
+	}
+	m.Histogram("missing", Labels{"class": "join"}).Observe(1)
+	if got := m.Histograms(); len(got) != 0 {
+		t.Errorf("Histograms() = %v, want none", got)
+	}
+}
+
+func TestWith(t *testing.T) {
+	m := New()
+	m.Add("join_fail", NewRecorder(&TestMetric{}))
+
+	m.With("join_fail", Labels{"generator": "prefix", "reuse": "false"}).Increment()
+	m.With("join_fail", Labels{"reuse": "false", "generator": "prefix"}).Increment()
+	m.With("join_fail", Labels{"generator": "", "reuse": "true"}).Increment()
+	m.With("unregistered", Labels{"class": "claim"}).Increment()
+
+	want := []Series{
+		{Name: "join_fail", Labels: Labels{"generator": "", "reuse": "true"}, Value: 1},
+		{Name: "join_fail", Labels: Labels{"generator": "prefix", "reuse": "false"}, Value: 2},
+		{Name: "unregistered", Labels: Labels{"class": "claim"}, Value: 1},
+	}
+	if diff := cmp.Diff(want, m.Series()); diff != "" {
+		t.Errorf("Series() returned diff (-want +got):\n%s", diff)
+	}
+	if got := m.Snapshot()["join_fail"]; got != 3 {
+		t.Errorf("Snapshot()[join_fail] = %d, want 3", got)
+	}
+}
+
+func TestWithSet(t *testing.T) {
+	m := New()
+	m.Add("busy_workers", NewRecorder(&TestMetric{}))
+
+	m.Get("busy_workers").Set(5)
+	m.With("busy_workers", Labels{"lane": "attended"}).Set(2)
+	m.With("busy_workers", Labels{"lane": "bulk"}).Set(3)
+	m.With("busy_workers", Labels{"lane": "attended"}).Set(1)
+
+	want := []Series{
+		{Name: "busy_workers", Labels: Labels{"lane": "attended"}, Value: 1},
+		{Name: "busy_workers", Labels: Labels{"lane": "bulk"}, Value: 3},
+	}
+	if diff := cmp.Diff(want, m.Series()); diff != "" {
+		t.Errorf("Series() returned diff (-want +got):\n%s", diff)
+	}
+	if got := m.Snapshot()["busy_workers"]; got != 5 {
+		t.Errorf("Snapshot()[busy_workers] = %d, want 5", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	m := New()
+	m.AddHistogram("provisioning_seconds", []float64{10, 1})
+
+	for _, v := range []float64{0.5, 1, 5, 20} {
+		m.Histogram("provisioning_seconds", Labels{"reuse": "true"}).Observe(v)
+	}
+	m.Histogram("provisioning_seconds", Labels{"reuse": "false"}).Observe(2)
+
+	want := []Distribution{
+		{Name: "provisioning_seconds", Labels: Labels{"reuse": "false"}, Buckets: []float64{1, 10}, Counts: []uint64{0, 1}, Count: 1, Sum: 2},
+		{Name: "provisioning_seconds", Labels: Labels{"reuse": "true"}, Buckets: []float64{1, 10}, Counts: []uint64{2, 1}, Count: 4, Sum: 26.5},
+	}
+	if diff := cmp.Diff(want, m.Histograms()); diff != "" {
+		t.Errorf("Histograms() returned diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build windows
+// +build windows
+
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/splice/shared/provisioning"
+	"github.com/google/splice/spliced/joiner"
+)
+
+// netProvisioner implements joiner.Provisioner with NetProvisionComputerAccount,
+// or with NetCreateProvisioningPackage for requests whose metadata must carry a
+// certificate template, group policies or root certificates.
+type netProvisioner struct{}
+
+// Provision provisions the machine account described by opts. Failures of
+// the domain controller are flagged as transient, so that the joiner retries
+// them against its next preferred domain controller.
+func (netProvisioner) Provision(ctx context.Context, opts joiner.ProvisionOptions) (joiner.ProvisionResult, error) {
+	var blob []byte
+	var err error
+	if opts.CertTemplate != "" || len(opts.Policies) > 0 || opts.RootCerts {
+		params := provisioning.PackageParams{
+			Hostname:  opts.Name,
+			Domain:    opts.Domain,
+			OU:        opts.OU,
+			DC:        opts.DC,
+			Reuse:     opts.Reuse,
+			Policies:  opts.Policies,
+			RootCerts: opts.RootCerts,
+		}
+		if opts.CertTemplate != "" {
+			params.CertTemplates = []string{opts.CertTemplate}
+		}
+		blob, err = provisioning.Package(params)
+	} else {
+		blob, err = provisioning.BinData(opts.Name, opts.Domain, opts.OU, opts.DC, opts.Reuse)
+	}
+
+	switch {
+	case err == nil:
+		return joiner.ProvisionResult{
+			Blob:      blob,
+			DC:        opts.DC,
+			AccountDN: joiner.AccountDN(opts.Name, opts.Domain, opts.OU),
+		}, nil
+	case provisioning.Transient(err):
+		err = fmt.Errorf("%w: %w", joiner.ErrTransient, err)
+	case errors.Is(err, provisioning.ErrExists):
+		err = fmt.Errorf("%w: %w", joiner.ErrAccountExists, err)
+	case errors.Is(err, provisioning.ErrNotSupported):
+		err = fmt.Errorf("%w: %w", joiner.ErrUnsupported, err)
+	}
+	return joiner.ProvisionResult{}, &joiner.ProvisionError{DC: opts.DC, Err: err}
+}
@@ -18,26 +18,90 @@ limitations under the License.
 package pubsub
 
 import (
+	"fmt"
+
 	"golang.org/x/net/context"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/google/splice/spliced/joiner"
 )
 
-var (
-	// NewClient passes through the underlying NewClient
-	NewClient = pubsub.NewClient
-)
+// Subscription implements joiner.Queue using a Pub/Sub subscription.
+type Subscription struct {
+	client *pubsub.Client
+	name   string
+}
+
+// NewSubscription returns a Subscription for the subscription name in the
+// Cloud project projectID.
+func NewSubscription(ctx context.Context, projectID, name string) (*Subscription, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return &Subscription{client: client, name: name}, nil
+}
+
+// Close closes the Pub/Sub client.
+func (s *Subscription) Close() error {
+	return s.client.Close()
+}
+
+// message implements joiner.Message for a Pub/Sub message.
+type message struct {
+	msg *pubsub.Message
+}
+
+// Data implements joiner.Message.
+func (m *message) Data() []byte {
+	return m.msg.Data
+}
 
-// NewJoinRequest pulls messages from the publisher.
-func NewJoinRequest(ctx context.Context, client *pubsub.Client, topic string) (string, error) {
-	data := ""
-	sub := client.Subscription(topic)
-	sub.ReceiveSettings.MaxOutstandingMessages = 1
-	cctx, cancel := context.WithCancel(ctx)
-	err := sub.Receive(cctx, func(ctx context.Context, msg *pubsub.Message) {
-		data = string(msg.Data)
+// Attributes implements joiner.Message.
+func (m *message) Attributes() map[string]string {
+	return m.msg.Attributes
+}
+
+// Settle implements joiner.Message.
+func (m *message) Settle(err error) {
+	settle(m.msg, err)
+}
+
+// acker is the part of a Pub/Sub message that settles it.
+type acker interface {
+	Ack()
+	Nack()
+}
+
+// settle acknowledges msg if err is nil or wraps joiner.ErrHandled, and
+// returns it for redelivery otherwise.
+func settle(msg acker, err error) {
+	if joiner.Handled(err) {
 		msg.Ack()
-		cancel()
+		return
+	}
+	msg.Nack()
+}
+
+// Receive implements joiner.Queue. At most maxOutstanding messages are pulled
+// from the subscription without being settled, so that the subscription does
+// not pull more work than the receiving workers can take on.
+func (s *Subscription) Receive(ctx context.Context, maxOutstanding int, deliver func(context.Context, joiner.Message)) error {
+	sub := s.client.Subscription(s.name)
+	sub.ReceiveSettings.MaxOutstandingMessages = maxOutstanding
+	return sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		deliver(ctx, &message{msg: msg})
 	})
-	return data, err
+}
+
+// Check reports whether the subscription exists and can be reached.
+func (s *Subscription) Check(ctx context.Context) error {
+	ok, err := s.client.Subscription(s.name).Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("Check: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("Check: subscription %s does not exist", s.name)
+	}
+	return nil
 }
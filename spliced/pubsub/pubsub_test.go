@@ -0,0 +1,57 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/splice/spliced/joiner"
+	"github.com/google/splice/spliced/lifecycle"
+)
+
+// fakeMessage records how it was settled.
+type fakeMessage struct {
+	acks, nacks int
+}
+
+func (m *fakeMessage) Ack()  { m.acks++ }
+func (m *fakeMessage) Nack() { m.nacks++ }
+
+func TestSettle(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   error
+		ack  bool
+	}{
+		{"claimed", nil, true},
+		{"already handled", joiner.ErrHandled, true},
+		{"wrapped handled", fmt.Errorf("claimed by another joiner: %w", joiner.ErrHandled), true},
+		{"transient", errors.New("datastore commit failed"), false},
+		{"paused", lifecycle.ErrPaused, false},
+	}
+	for _, tt := range tests {
+		var msg fakeMessage
+		settle(&msg, tt.in)
+		want := fakeMessage{nacks: 1}
+		if tt.ack {
+			want = fakeMessage{acks: 1}
+		}
+		if msg != want {
+			t.Errorf("%s: settle(%v) acked %d and nacked %d times, want %d and %d", tt.desc, tt.in, msg.acks, msg.nacks, want.acks, want.nacks)
+		}
+	}
+}
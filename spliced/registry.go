@@ -17,104 +17,220 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"golang.org/x/sys/windows/registry"
+	"github.com/google/splice/spliced/config"
+	"github.com/google/splice/spliced/joiner"
 )
 
 const (
-	rootKey = `SOFTWARE\Splice\spliced`
+	rootKey    = `SOFTWARE\Splice\spliced`
+	domainsKey = rootKey + `\domains`
 )
 
-type appcfg struct {
-	Domain         string
-	Instance       string
-	ProjectID      string
-	Topic          string
-	EncryptBlob    bool
-	VerifyCert     bool
-	CaURL          string
-	CaURLPath      string
-	CaOrg          string
-	RootsPath      string
-	PermitReuse    bool
-	UseTestBackend bool
+// registrySource implements config.Source for the SpliceD registry key.
+// Values that are missing from the registry are left unset.
+type registrySource struct{}
+
+func (registrySource) Name() string {
+	return `HKLM\` + rootKey
 }
 
-func getConfig() (appcfg, error) {
-	var conf appcfg
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, rootKey, registry.ALL_ACCESS)
-	if err != nil {
-		return conf, fmt.Errorf("getConfig: opening root key %s failed with %v", rootKey, err)
+func (registrySource) Load(conf *joiner.Config) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, rootKey, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil
 	}
-
-	conf.Domain, _, err = k.GetStringValue("domain")
 	if err != nil {
-		return conf, fmt.Errorf("getConfig: reading domain value failed with %v", err)
+		return fmt.Errorf("opening root key %s failed with %v", rootKey, err)
 	}
+	defer k.Close()
 
-	conf.ProjectID, _, err = k.GetStringValue("project")
-	if err != nil {
-		return conf, fmt.Errorf("getConfig: reading project value failed with %v", err)
+	for _, v := range []struct {
+		name string
+		dst  *string
+	}{
+		{"domain", &conf.Domain},
+		{"project", &conf.ProjectID},
+		{"instance", &conf.Instance},
+		{"topic", &conf.Topic},
+		{"ca_root_url", &conf.CaURL},
+		{"ca_cert_path", &conf.CaURLPath},
+		{"ca_cert_org", &conf.CaOrg},
+		{"roots_path", &conf.RootsPath},
+		{"health_addr", &conf.HealthAddr},
+		{"trace_exporter", &conf.TraceExporter},
+		{"trace_file", &conf.TraceFile},
+		{"priority_topic", &conf.PriorityTopic},
+		{"site", &conf.Site},
+		{"cert_template", &conf.CertTemplate},
+	} {
+		if s, _, err := k.GetStringValue(v.name); err == nil {
+			*v.dst = s
+		}
 	}
 
-	conf.Instance, _, err = k.GetStringValue("instance")
-	if err != nil {
-		return conf, fmt.Errorf("getConfig: reading instance value failed with %v", err)
+	for _, v := range []struct {
+		name string
+		dst  *bool
+	}{
+		{"encrypt_blob", &conf.EncryptBlob},
+		{"verify_certs", &conf.VerifyCert},
+		{"use_test_backend", &conf.UseTestBackend},
+		{"permit_reuse", &conf.PermitReuse},
+		{"root_certs", &conf.RootCerts},
+	} {
+		if n, _, err := k.GetIntegerValue(v.name); err == nil {
+			*v.dst = n != 0
+		}
 	}
 
-	conf.Topic, _, err = k.GetStringValue("topic")
-	if err != nil {
-		return conf, fmt.Errorf("getConfig: reading topic value failed with %v", err)
+	if n, _, err := k.GetIntegerValue("workers"); err == nil && n > 0 {
+		conf.Workers = int(n)
+	}
+	if n, _, err := k.GetIntegerValue("lane_fairness"); err == nil && n > 0 {
+		conf.LaneFairness = int(n)
 	}
 
-	// Optional values
-	eb, _, err := k.GetIntegerValue("encrypt_blob")
-	if err != nil || eb != 0 {
-		conf.EncryptBlob = true
-	} else {
-		conf.EncryptBlob = false
+	for _, v := range []struct {
+		name string
+		dst  *[]string
+	}{
+		{"allowed_ous", &conf.AllowedOUs},
+		{"policies", &conf.Policies},
+		{"allowed_cert_templates", &conf.AllowedCertTemplates},
+		{"allowed_policies", &conf.AllowedPolicies},
+	} {
+		if list, _, err := k.GetStringsValue(v.name); err == nil {
+			*v.dst = list
+		}
 	}
 
-	vc, _, err := k.GetIntegerValue("verify_certs")
-	if err != nil || vc != 0 {
-		conf.VerifyCert = true
-	} else {
-		conf.VerifyCert = false
+	dcs, err := loadControllers(k)
+	if err != nil {
+		return err
 	}
+	if dcs != nil {
+		conf.DomainControllers = dcs
+	}
+	return loadDomains(conf)
+}
 
-	conf.CaURL, _, err = k.GetStringValue("ca_root_url")
-	if err != nil && conf.VerifyCert {
-		return conf, fmt.Errorf("getConfig: verify_certs is enabled, but ca_certs_url could not be read: %v", err)
+// loadDomains reads the additional domains served by SpliceD, each held in a
+// subkey of domainsKey named after the domain.
+func loadDomains(conf *joiner.Config) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, domainsKey, registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening domains key %s failed with %v", domainsKey, err)
 	}
+	defer k.Close()
 
-	conf.CaURLPath, _, err = k.GetStringValue("ca_cert_path")
+	names, err := k.ReadSubKeyNames(-1)
 	if err != nil {
-		conf.CaURLPath = ""
+		return fmt.Errorf("listing domains under %s failed with %v", domainsKey, err)
 	}
+	if len(names) == 0 {
+		return nil
+	}
+	conf.Domains = make(map[string]joiner.DomainConfig, len(names))
+	for _, name := range names {
+		dk, err := registry.OpenKey(k, name, registry.QUERY_VALUE)
+		if err != nil {
+			return fmt.Errorf("opening domain key %s failed with %v", name, err)
+		}
+		var dc joiner.DomainConfig
+		if n, _, err := dk.GetIntegerValue("permit_reuse"); err == nil {
+			dc.PermitReuse = n != 0
+		}
+		if n, _, err := dk.GetIntegerValue("root_certs"); err == nil {
+			dc.RootCerts = n != 0
+		}
+		if s, _, err := dk.GetStringValue("cert_template"); err == nil {
+			dc.CertTemplate = s
+		}
+		for _, v := range []struct {
+			name string
+			dst  *[]string
+		}{
+			{"allowed_ous", &dc.AllowedOUs},
+			{"policies", &dc.Policies},
+			{"allowed_cert_templates", &dc.AllowedCertTemplates},
+			{"allowed_policies", &dc.AllowedPolicies},
+		} {
+			if list, _, err := dk.GetStringsValue(v.name); err == nil {
+				*v.dst = list
+			}
+		}
+		dc.DomainControllers, err = loadControllers(dk)
+		dk.Close()
+		if err != nil {
+			return fmt.Errorf("domain %s: %v", name, err)
+		}
+		conf.Domains[name] = dc
+	}
+	return nil
+}
 
-	conf.CaOrg, _, err = k.GetStringValue("ca_cert_org")
+// loadControllers reads the preferred domain controllers held under the
+// domain_controllers subkey of k, as one REG_MULTI_SZ value per site. It
+// returns nil if the subkey does not exist.
+func loadControllers(k registry.Key) (map[string][]string, error) {
+	ck, err := registry.OpenKey(k, "domain_controllers", registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		conf.CaOrg = ""
+		return nil, fmt.Errorf("opening domain_controllers key failed with %v", err)
 	}
+	defer ck.Close()
 
-	conf.RootsPath, _, err = k.GetStringValue("roots_path")
+	sites, err := ck.ReadValueNames(-1)
 	if err != nil {
-		conf.RootsPath = ""
+		return nil, fmt.Errorf("listing sites under domain_controllers failed with %v", err)
+	}
+	dcs := make(map[string][]string, len(sites))
+	for _, site := range sites {
+		names, _, err := ck.GetStringsValue(site)
+		if err != nil {
+			return nil, fmt.Errorf("reading domain controllers of site %s failed with %v", site, err)
+		}
+		dcs[site] = names
 	}
+	return dcs, nil
+}
 
-	v, _, err := k.GetIntegerValue("use_test_backend")
-	if err == nil && v == 1 {
-		conf.UseTestBackend = true
+// configFile returns the path of the configuration file, if one is set in
+// the environment or the registry.
+func configFile() string {
+	if path, ok := os.LookupEnv(config.EnvPrefix + "CONFIG_FILE"); ok {
+		return path
+	}
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, rootKey, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	path, _, err := k.GetStringValue("config_file")
+	if err != nil {
+		return ""
 	}
+	return path
+}
 
-	v, _, err = k.GetIntegerValue("permit_reuse")
-	if err != nil || v != 1 {
-		conf.PermitReuse = false
-	} else {
-		conf.PermitReuse = true
+// newLoader returns a config.Loader reading the registry, then the
+// configuration file if one is set, then the environment.
+func newLoader() *config.Loader {
+	sources := []config.Source{registrySource{}}
+	if path := configFile(); path != "" {
+		sources = append(sources, config.File(path))
 	}
-	return conf, nil
+	return config.NewLoader(append(sources, config.Env(os.LookupEnv))...)
 }
 
 // setDwordValue adds or updates a REG_DWORD value.
@@ -142,3 +258,16 @@ func setStringValue(name string, value string) error {
 
 	return nil
 }
+
+// setStringsValue adds or updates a REG_MULTI_SZ value.
+func setStringsValue(name string, value []string) error {
+	k, _, err := registry.CreateKey(registry.LOCAL_MACHINE, rootKey, registry.ALL_ACCESS)
+	if err != nil {
+		return fmt.Errorf("setStringsValue: creating root key %s failed with %v", rootKey, err)
+	}
+	if err := k.SetStringsValue(name, value); err != nil {
+		return fmt.Errorf("setStringsValue: updating key %s with %q failed due to %v", name, value, err)
+	}
+
+	return nil
+}
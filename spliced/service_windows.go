@@ -25,11 +25,12 @@ For debugging, run from an admin command shell with the 'debug' argument.
 package main
 
 import (
-	"golang.org/x/net/context"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/google/deck/backends/eventlog"
 	"github.com/google/deck/backends/logger"
@@ -39,6 +40,7 @@ import (
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows"
 	"github.com/google/splice/generators"
+	"github.com/google/splice/spliced/joiner"
 
 	// register generators
 	_ "github.com/google/splice/generators/prefix"
@@ -54,18 +56,21 @@ type winSvc struct{}
 // Execute starts the internal goroutine and waits for service signals from Windows.
 func (m *winSvc) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
 	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
-	ctx := context.Background()
-	errch := make(chan ExitEvt)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errch := make(chan joiner.ExitEvt, 1)
 
 	changes <- svc.Status{State: svc.StartPending}
-	if err := Init(); err != nil {
-		deck.ErrorfA("Failure starting service. %v", err).With(eventID(EvtErrStartup)).Go()
+	j, closer, err := Init(ctx)
+	if err != nil {
+		deck.ErrorfA("Failure starting service. %v", err).With(eventID(joiner.EvtErrStartup)).Go()
 		return
 	}
+	defer closer()
 	go func() {
-		errch <- Run(ctx)
+		errch <- j.Run(ctx)
 	}()
-	deck.InfoA("Service started.").With(eventID(EvtStartup)).Go()
+	deck.InfoA("Service started.").With(eventID(joiner.EvtStartup)).Go()
 
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 loop:
@@ -83,15 +88,24 @@ loop:
 			case svc.Stop, svc.Shutdown:
 				break loop
 			case svc.Pause:
+				changes <- svc.Status{State: svc.PausePending}
+				j.Control.Pause()
+				deck.InfoA("Service paused. No new requests will be claimed.").With(eventID(joiner.EvtPaused)).Go()
 				changes <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
 			case svc.Continue:
+				changes <- svc.Status{State: svc.ContinuePending}
+				j.Control.Resume()
+				deck.InfoA("Service resumed.").With(eventID(joiner.EvtResumed)).Go()
 				changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 			default:
-				deck.ErrorfA("Unexpected control request #%d", c).With(eventID(EvtErrMisc)).Go()
+				deck.ErrorfA("Unexpected control request #%d", c).With(eventID(joiner.EvtErrMisc)).Go()
 			}
 		}
 	}
-	changes <- svc.Status{State: svc.StopPending}
+	changes <- svc.Status{State: svc.StopPending, WaitHint: uint32((j.DrainTimeout + 10*time.Second).Milliseconds())}
+	// Stop pulling new requests, then drain or release the ones in flight.
+	cancel()
+	j.Shutdown()
 	return
 }
 
@@ -102,17 +116,17 @@ func runService(name string, isDebug bool) {
 		deck.Add(logger.Init(os.Stdout, 0))
 	}
 
-	deck.InfofA("Starting %s service.", name).With(eventID(EvtStartup)).Go()
+	deck.InfofA("Starting %s service.", name).With(eventID(joiner.EvtStartup)).Go()
 	run := svc.Run
 	if isDebug {
 		run = debug.Run
 	}
 	err = run(name, &winSvc{})
 	if err != nil {
-		deck.ErrorfA("%s service failed. %v", name, err).With(eventID(EvtErrMisc)).Go()
+		deck.ErrorfA("%s service failed. %v", name, err).With(eventID(joiner.EvtErrMisc)).Go()
 		return
 	}
-	deck.InfofA("%s service stopped.", name).With(eventID(EvtShutdown)).Go()
+	deck.InfofA("%s service stopped.", name).With(eventID(joiner.EvtShutdown)).Go()
 }
 
 func usage(errmsg string) {
@@ -20,362 +20,231 @@ limitations under the License.
 /*
 Package spliced processes domain join requests from the Cloud Datastore.
 
-The core of the Splice joiner runs as a single goroutine which allows it
-to function independently of the Windows service which manages it.
-Under normal operation, the goroutine for spliced does not exit, unless the
-parent Windows service stops.
-
-A channel is used to enable the goroutine to signal an internal failure to
+The request-processing core lives in the joiner package and runs as a set of
+goroutines, which allows it to function independently of the Windows service
+which manages it. This package wires the core to the registry configuration,
+the Cloud Datastore, Pub/Sub, EventLog and the Windows provisioning APIs, and
+optionally serves its health and metrics on a local HTTP listener.
+Under normal operation, the joiner does not exit, unless the parent Windows
+service stops.
+
+A channel is used to enable the joiner to signal an internal failure to
 the Windows service, allowing it to shutdown cleanly. All other logging is
 sent directly to EventLog.
 */
 package main
 
 import (
-	"golang.org/x/net/context"
-	"errors"
+	"context"
 	"fmt"
+	"net"
 	"time"
 
 	metric "github.com/google/cabbie/metrics"
 	"github.com/google/deck"
-	"cloud.google.com/go/datastore"
-	"github.com/google/splice/generators"
-	"github.com/google/splice/models"
-	"github.com/google/splice/shared/certs"
-	"github.com/google/splice/shared/crypto"
-	"github.com/google/splice/shared/provisioning"
+	"github.com/google/splice/shared/tracing"
+	"github.com/google/splice/spliced/config"
+	"github.com/google/splice/spliced/health"
+	"github.com/google/splice/spliced/joiner"
 	"github.com/google/splice/spliced/metric/tracker"
 	"github.com/google/splice/spliced/pubsub"
 	"github.com/google/splice/spliced/testing"
 )
 
 var (
-	conf    appcfg
-	metrics *tracker.Tracker
-
 	// MetricRoot sets metric path for all SpliceD metrics
 	metricRoot = "/splice/metrics"
 	// MetricSvc sets platform source for metrics.
 	metricSvc = "splice"
 
-	provisioner = provisioning.BinData
-)
-
-// ExitEvt holds an EventLog event explaining why the goroutine had to exit.
-type ExitEvt struct {
-	Code    uint32
-	Message string
-}
-
-// Transaction holds an in-flight datastore transaction.
-type Transaction struct {
-	client *datastore.Client
-	keys   []*datastore.Key
-	req    models.Request
-	tx     *datastore.Transaction
-}
-
-// startTransaction opens a datastore transaction and attempts to locate the record with id reqID.
-func startTransaction(ctx context.Context, reqID string) (Transaction, error) {
-	var trans Transaction
-	var err error
-
-	trans.client, err = datastore.NewClient(ctx, conf.ProjectID)
-	if err != nil {
-		return trans, fmt.Errorf("startTransaction: datastore client creation failed with %v", err)
-	}
-
-	trans.tx, err = trans.client.NewTransaction(ctx)
-	if err != nil {
-		return trans, fmt.Errorf("startTransaction: opening a datastore transaction failed with %v", err)
-	}
-
-	var requests []models.Request
-	ancestor := datastore.NameKey("RequestID", reqID, nil)
-	query := datastore.NewQuery("Request").Ancestor(ancestor).Transaction(trans.tx)
-
-	if trans.keys, err = trans.client.GetAll(ctx, query, &requests); err != nil {
-		return trans, fmt.Errorf("startTransaction: obtaining request from the datastore failed with %v", err)
-	}
-
-	if len(requests) < 1 {
-		return trans, fmt.Errorf("startTransaction: no request received with ID %s", reqID)
-	}
-	trans.req = requests[0]
-
-	return trans, nil
-}
-
-// returnRequest passes the result of the operation to the datastore on its way to the client.
-func returnRequest(ctx context.Context, reqID string, success bool, meta *crypto.Metadata) error {
-	trans, err := startTransaction(ctx, reqID)
-	if err != nil {
-		return err
-	}
-	defer trans.client.Close()
-
-	trans.req.ResponseData = meta.Data
-	if success {
-		trans.req.Status = models.RequestStatusCompleted
-		trans.req.ResponseKey = meta.AESKey
-		trans.req.CipherNonce = meta.Nonce
-		metrics.Get("join_success").Increment()
-	} else {
-		trans.req.Status = models.RequestStatusFailed
-
-		metrics.Get("join_fail").Increment()
-	}
-
-	trans.req.CompletionTime = time.Now().UTC()
-
-	if _, err := trans.tx.Put(trans.keys[0], &trans.req); err != nil {
-		return fmt.Errorf("returnRequest: datastore update failed with %v", err)
-	}
-
-	if _, err := trans.tx.Commit(); err != nil {
-		return fmt.Errorf("returnRequest: datastore commit failed with %v", err)
-	}
-
-	return nil
-}
-
-// claimRequest attempts to claim a new join request from the datastore.
-func claimRequest(ctx context.Context, reqID string) (models.Request, error) {
-	trans, err := startTransaction(ctx, reqID)
-	if err != nil {
-		return trans.req, err
-	}
-	defer trans.client.Close()
-
-	if trans.req.Status != models.RequestStatusAccepted || trans.req.ClaimBy != "" {
-		return trans.req, fmt.Errorf("claimRequest: request to %s already %s and will be ignored", trans.req.ClaimBy, trans.req.Status)
-	}
-
-	trans.req.ClaimBy = conf.Instance
-	trans.req.ClaimTime = time.Now().UTC()
-
-	if _, err := trans.tx.Put(trans.keys[0], &trans.req); err != nil {
-		return trans.req, fmt.Errorf("claimRequest: datastore update failed with %v", err)
-	}
-
-	if _, err := trans.tx.Commit(); err != nil {
-		return trans.req, fmt.Errorf("claimRequest: datastore commit failed with %v", err)
-	}
-
-	return trans.req, nil
-}
-
-func permitReuse(req *models.Request) bool {
-	// Always deny reuse if configured locally
-	if !conf.PermitReuse {
-		return false
-	}
-	// If allowed locally, do what the server wants
-	return req.AttemptReuse
-}
-
-func getName(req *models.Request) (string, error) {
-	if req.Hostname != "" {
-		return req.Hostname, nil
-	}
-	if req.GeneratorID == "" {
-		return "", errors.New("request must contain either Hostname or GeneratorID")
-	}
-	deck.InfofA("Attempting hostname generation using generator %s for request %s.", req.GeneratorID, req.RequestID).With(eventID(EvtNameGeneration)).Go()
-	return generators.Run(req.GeneratorID, req.GeneratorData)
-}
+	// configReload sets how often the configuration is reloaded.
+	configReload = 30 * time.Second
 
-func join(req *models.Request) ([]byte, error) {
-	wantName, err := getName(req)
-	if err != nil {
-		deck.WarningfA("Failed to determine a hostname for request %s: %v", req.RequestID, err).With(eventID(EvtErrNaming)).Go()
-		return nil, err
-	}
+	// version identifies the SpliceD build. It is set at build time with
+	// -ldflags "-X main.version=<version>".
+	version = "unknown"
+)
 
-	deck.InfofA("Attempting to join host %s to domain %s. Hostname reuse is set to %t.",
-		wantName, conf.Domain, permitReuse(req)).With(eventID(EvtJoinAttempt)).Go()
-	metrics.Get("join_attempt").Increment()
-	blob, err := provisioner(wantName, conf.Domain, permitReuse(req))
-	if err != nil {
-		deck.WarningfA("Failed to join host %s to domain %s (reuse=%t) with: %v", wantName, conf.Domain, permitReuse(req), err).With(eventID(EvtJoinFailure)).Go()
-		return nil, err
-	}
+// deckLogger implements joiner.Logger by sending entries to deck, tagged with
+// their EventLog event ID.
+type deckLogger struct{}
 
-	deck.InfofA("Computer object %q joined to domain %q", wantName, conf.Domain).With(eventID(EvtJoinSuccess)).Go()
-	return blob, nil
+func (deckLogger) Infof(id uint32, format string, args ...interface{}) {
+	deck.InfofA(format, args...).With(eventID(id)).Go()
 }
 
-// processRequest takes a claimed request, performs any necessary
-// checks, processes it and always returns a metadata object
-// with the results. Errors in this func are considered non-fatal
-// and are logged and returned within the metadata for display to
-// the client.
-func processRequest(req *models.Request) (crypto.Metadata, error) {
-	meta := crypto.Metadata{}
-
-	var fqdn string
-	if req.Hostname != "" {
-		fqdn = req.Hostname + "." + conf.Domain
-	}
-
-	if err := certs.VerifyCert(req.ClientCert, fqdn, conf.CaURL, conf.CaURLPath, conf.CaOrg, conf.RootsPath, conf.VerifyCert); err != nil {
-		deck.WarningfA("Client verification failed: %v", err).With(eventID(EvtErrVerification)).Go()
-		metrics.Get("failure_211").Increment()
-		meta.Data = []byte(err.Error())
-		return meta, err
-	}
-
-	blob, err := join(req)
-	if err != nil {
-		metrics.Get("failure_207").Increment()
-		meta.Data = []byte(err.Error())
-		return meta, err
-	}
-	meta.Data = blob
-
-	if conf.EncryptBlob {
-		pub, err := certs.PublicKey(req.ClientCert)
-		if err != nil {
-			deck.WarningfA("Unable to obtain certificate public key: %v", err).With(eventID(EvtErrEncryption)).Go()
-			metrics.Get("failure_212").Increment()
-			meta.Data = []byte(err.Error())
-			return meta, err
-		}
-
-		if err := meta.Encrypt(pub); err != nil {
-			deck.WarningfA("encryptMeta: %v", err).With(eventID(EvtErrEncryption)).Go()
-			metrics.Get("failure_210").Increment()
-			meta.Data = []byte(err.Error())
-			return meta, err
-		}
-	}
-
-	return meta, nil
+func (deckLogger) Warningf(id uint32, format string, args ...interface{}) {
+	deck.WarningfA(format, args...).With(eventID(id)).Go()
 }
 
-// Run the splice daemon continuously, listening for new requests.
-func Run(ctx context.Context) ExitEvt {
-	if err := generators.ConfigureAll(); err != nil {
-		return ExitEvt{EvtErrStartup, fmt.Sprintf("Failed to configure generators. %v", err)}
-	}
-	client, err := pubsub.NewClient(ctx, conf.ProjectID)
-	if err != nil {
-		return ExitEvt{EvtErrSubscription, fmt.Sprintf("Failed to create client. %v", err)}
-	}
-	for {
-		deck.InfoA("Awaiting join requests...").With(eventID(EvtWaiting)).Go()
-		metrics.Get("waiting").Set(1)
-		reqID, err := pubsub.NewJoinRequest(ctx, client, conf.Topic)
-		metrics.Get("waiting").Set(0)
-		if err != nil {
-			metrics.Get("failure_205").Increment()
-			deck.ErrorA(err).With(eventID(EvtErrSubscription)).Go()
-			time.Sleep(1 * time.Minute)
-			continue
-		}
-
-		deck.InfofA("NewJoinRequest: pulled message for processing, %v", reqID).With(eventID(EvtNewRequest)).Go()
-		req, err := claimRequest(ctx, reqID)
-		if err != nil {
-			deck.ErrorA(err).With(eventID(EvtErrClaim)).Go()
-			metrics.Get("failure_206").Increment()
-			continue
-		}
-
-		success := true
-		meta, err := processRequest(&req)
-		if err != nil {
-			success = false
-		}
-
-		if err = returnRequest(ctx, reqID, success, &meta); err != nil {
-			deck.ErrorA(err).With(eventID(EvtErrReturn)).Go()
-			metrics.Get("failure_208").Increment()
-		}
-		for i := range meta.Data {
-			meta.Data[i] = 0
-		}
-	}
+func (deckLogger) Errorf(id uint32, format string, args ...interface{}) {
+	deck.ErrorfA(format, args...).With(eventID(id)).Go()
 }
 
-func initMetrics() error {
-	metrics = tracker.New()
+// initMetrics registers every joiner metric with cabbie. Metric values are
+// also recorded locally, so that they can be served by the health listener.
+func initMetrics() (*tracker.Tracker, error) {
+	metrics := tracker.New()
 
 	// Counters
-	for _, name := range []string{
-		"failure_205",
-		"failure_206",
-		"failure_207",
-		"failure_208",
-		"failure_210",
-		"failure_211",
-		"failure_212",
-		"join_attempt",
-		"join_fail",
-		"join_success",
-	} {
+	for _, name := range joiner.Counters {
 		m, err := metric.NewCounter(fmt.Sprintf("%s/%s", metricRoot, name), metricSvc)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		metrics.Add(name, m)
+		metrics.Add(name, tracker.NewRecorder(m))
 	}
 
 	// Gauges
-	for _, name := range []string{
-		"waiting",
-	} {
+	for _, name := range joiner.Gauges {
 		m, err := metric.NewInt(fmt.Sprintf("%s/%s", metricRoot, name), metricSvc)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		metrics.Add(name, m)
+		metrics.Add(name, tracker.NewRecorder(m))
 	}
-	return nil
+
+	// Histograms are only served by the health listener.
+	for _, name := range joiner.Histograms {
+		metrics.AddHistogram(name, joiner.Buckets)
+	}
+	return metrics, nil
 }
 
-// Init initializes the internal config and logging. Must call before Run.
-func Init() error {
-	var err error
-	if err := initMetrics(); err != nil {
-		return err
+// Init initializes the internal config, logging and cloud clients, and
+// returns the joiner along with a func that closes its clients once the
+// joiner has shut down. The configuration is reloaded until ctx is cancelled.
+// Must call before Run.
+func Init(ctx context.Context) (*joiner.Joiner, func(), error) {
+	metrics, err := initMetrics()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	conf, err = getConfig()
+	loader := newLoader()
+	conf, err := loader.Load()
 	if err != nil {
-		return fmt.Errorf("Could not obtain configuration from registry. %v", err)
+		return nil, nil, fmt.Errorf("Could not obtain configuration. %v", err)
 	}
 	deck.InfofA(
-		"Application configured from registry.\n\n"+
+		"Application configured.\n\n"+
 			"Domain: %v\n"+
+			"Served domains: %v\n"+
 			"Svc name: %v\n"+
 			"Project id: %v\n"+
 			"Topic name: %v\n"+
+			"Priority topic name: %v\n"+
 			"Encrypt blob: %v\n"+
 			"Verify certs: %v\n"+
 			"CA URL: %v\n"+
 			"CA URL Path: %v\n"+
 			"CA Expected Org: %v\n"+
 			"Permit reuse: %t\n"+
+			"Allowed OUs: %q\n"+
+			"Site: %s\n"+
+			"Domain controllers: %v\n"+
+			"Certificate template: %s\n"+
+			"Policies: %q\n"+
+			"Root certificates: %t\n"+
+			"Workers: %d\n"+
+			"Lane fairness: %d\n"+
+			"Health listener: %s\n"+
+			"Trace exporter: %s\n"+
+			"Version: %s\n"+
 			"Test backend: %t",
 		conf.Domain,
+		conf.ServedDomains(),
 		conf.Instance,
 		conf.ProjectID,
 		conf.Topic,
+		conf.PriorityTopic,
 		conf.EncryptBlob,
 		conf.VerifyCert,
 		conf.CaURL,
 		conf.CaURLPath,
 		conf.CaOrg,
 		conf.PermitReuse,
-		conf.UseTestBackend).With(eventID(EvtConfiguration)).Go()
-
+		conf.AllowedOUs,
+		conf.Site,
+		conf.DomainControllers,
+		conf.CertTemplate,
+		conf.Policies,
+		conf.RootCerts,
+		conf.Workers,
+		conf.LaneFairness,
+		conf.HealthAddr,
+		conf.TraceExporter,
+		version,
+		conf.UseTestBackend).With(eventID(joiner.EvtConfiguration)).Go()
+
+	var provisioner joiner.Provisioner = netProvisioner{}
 	if conf.UseTestBackend {
-		backend := testing.NewInactiveDirectory()
-		provisioner = backend.Join
-		deck.WarningA("Test backend is enabled. Hosts will not join.").With(eventID(EvtConfiguration)).Go()
+		provisioner = testing.NewInactiveDirectory()
+		deck.WarningA("Test backend is enabled. Hosts will not join.").With(eventID(joiner.EvtConfiguration)).Go()
 	}
 
-	return nil
+	shutdownTracing, err := tracing.Init(config.TraceConfig(conf))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to initialize tracing. %v", err)
+	}
+	sub, err := pubsub.NewSubscription(ctx, conf.ProjectID, conf.Topic)
+	if err != nil {
+		shutdownTracing(ctx)
+		return nil, nil, fmt.Errorf("Failed to create subscription client. %v", err)
+	}
+	checks := map[string]health.Check{"subscription": sub.Check}
+	subs := []*pubsub.Subscription{sub}
+	var queue joiner.Queue = sub
+	if conf.PriorityTopic != "" {
+		prio, err := pubsub.NewSubscription(ctx, conf.ProjectID, conf.PriorityTopic)
+		if err != nil {
+			sub.Close()
+			shutdownTracing(ctx)
+			return nil, nil, fmt.Errorf("Failed to create priority subscription client. %v", err)
+		}
+		checks["priority_subscription"] = prio.Check
+		subs = append(subs, prio)
+		queue = joiner.Lanes(prio, sub)
+	}
+	closeSubs := func() {
+		for _, s := range subs {
+			s.Close()
+		}
+	}
+	store, err := joiner.NewDatastore(ctx, conf.ProjectID)
+	if err != nil {
+		closeSubs()
+		shutdownTracing(ctx)
+		return nil, nil, err
+	}
+	checks["store"] = store.Check
+
+	errs := health.NewErrorLog(deckLogger{})
+	j := joiner.New(conf, provisioner, queue, store, errs, metrics)
+	j.Version = version
+	go loader.Watch(ctx, configReload, j, errs)
+	closer := func() {
+		closeSubs()
+		store.Close()
+		// Flush the spans of requests drained during shutdown.
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(sctx)
+	}
+
+	if conf.HealthAddr != "" {
+		l, err := net.Listen("tcp", conf.HealthAddr)
+		if err != nil {
+			closer()
+			return nil, nil, fmt.Errorf("Failed to start the health listener. %v", err)
+		}
+		srv := health.New(j, metrics, errs, checks)
+		go func() {
+			if err := srv.Serve(ctx, l); err != nil {
+				errs.Errorf(joiner.EvtErrMisc, "Health listener stopped: %v", err)
+			}
+		}()
+		deck.InfofA("Serving health and metrics on http://%s/.", l.Addr()).With(eventID(joiner.EvtStartup)).Go()
+	}
+	return j, closer, nil
 }
@@ -0,0 +1,90 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/splice/spliced/joiner"
+	"github.com/google/splice/spliced/metric/tracker"
+)
+
+// Logger implements joiner.Logger by passing entries to Logf, which is
+// typically testing.T.Logf.
+type Logger struct {
+	Logf func(format string, args ...interface{})
+}
+
+func (l Logger) log(level string, id uint32, format string, args ...interface{}) {
+	l.Logf("%s %d: %s", level, id, fmt.Sprintf(format, args...))
+}
+
+// Infof implements joiner.Logger.
+func (l Logger) Infof(id uint32, format string, args ...interface{}) {
+	l.log("INFO", id, format, args...)
+}
+
+// Warningf implements joiner.Logger.
+func (l Logger) Warningf(id uint32, format string, args ...interface{}) {
+	l.log("WARNING", id, format, args...)
+}
+
+// Errorf implements joiner.Logger.
+func (l Logger) Errorf(id uint32, format string, args ...interface{}) {
+	l.log("ERROR", id, format, args...)
+}
+
+// Metric is an in-memory tracker.Metric.
+type Metric struct {
+	mu    sync.Mutex
+	value int64
+}
+
+// Increment implements tracker.Metric.
+func (m *Metric) Increment() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value++
+	return nil
+}
+
+// Set implements tracker.Metric.
+func (m *Metric) Set(v int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value = v
+	return nil
+}
+
+// Value returns the current value of the metric.
+func (m *Metric) Value() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.value
+}
+
+// NewTracker returns a tracker holding a Metric for every counter and gauge
+// used by a joiner, along with its histograms.
+func NewTracker() *tracker.Tracker {
+	t := tracker.New()
+	for _, name := range append(append([]string(nil), joiner.Counters...), joiner.Gauges...) {
+		t.Add(name, &Metric{})
+	}
+	for _, name := range joiner.Histograms {
+		t.AddHistogram(name, joiner.Buckets)
+	}
+	return t
+}
@@ -0,0 +1,169 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/splice/models"
+	"github.com/google/splice/spliced/joiner"
+)
+
+// queued is a message waiting for delivery.
+type queued struct {
+	data  []byte
+	attrs map[string]string
+}
+
+// Queue is an in-memory message queue of join requests. It implements
+// joiner.Queue, and is safe for concurrent use. Messages that are settled
+// with a transient error are queued again for redelivery.
+type Queue struct {
+	mu      sync.Mutex
+	pending []queued
+	acked   []string
+	nacks   int
+	// wake is signalled whenever a message is queued.
+	wake chan struct{}
+}
+
+// NewQueue returns an empty Queue.
+func NewQueue() *Queue {
+	return &Queue{wake: make(chan struct{}, 1)}
+}
+
+// Publish queues a legacy message carrying only reqID.
+func (q *Queue) Publish(reqID string) {
+	q.PublishMessage([]byte(reqID), nil)
+}
+
+// PublishMessage queues a message with the given data and attributes.
+func (q *Queue) PublishMessage(data []byte, attrs map[string]string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, queued{data: data, attrs: attrs})
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Acked returns the request IDs of all acknowledged messages, in the order in
+// which they were acknowledged. Messages that do not decode to an envelope
+// are reported by their data.
+func (q *Queue) Acked() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.acked...)
+}
+
+// Nacks returns the number of messages that were returned for redelivery.
+func (q *Queue) Nacks() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.nacks
+}
+
+// Pending returns the number of messages waiting to be delivered.
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// next removes and returns the oldest pending message, if there is one.
+func (q *Queue) next() (queued, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return queued{}, false
+	}
+	next := q.pending[0]
+	q.pending = q.pending[1:]
+	return next, true
+}
+
+// Receive implements joiner.Queue. Like a Pub/Sub subscription, it waits for
+// every delivered message to be settled before returning.
+func (q *Queue) Receive(ctx context.Context, maxOutstanding int, deliver func(context.Context, joiner.Message)) error {
+	if maxOutstanding < 1 {
+		maxOutstanding = 1
+	}
+	outstanding := make(chan struct{}, maxOutstanding)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case outstanding <- struct{}{}:
+		}
+		next, ok := q.next()
+		for !ok {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-q.wake:
+			}
+			next, ok = q.next()
+		}
+		wg.Add(1)
+		msg := &message{q: q, queued: next, done: func() {
+			<-outstanding
+			wg.Done()
+		}}
+		go deliver(ctx, msg)
+	}
+}
+
+// message implements joiner.Message for a Queue.
+type message struct {
+	queued
+	q    *Queue
+	once sync.Once
+	done func()
+}
+
+// Data implements joiner.Message.
+func (m *message) Data() []byte {
+	return m.data
+}
+
+// Attributes implements joiner.Message.
+func (m *message) Attributes() map[string]string {
+	return m.attrs
+}
+
+// Settle implements joiner.Message.
+func (m *message) Settle(err error) {
+	m.once.Do(func() {
+		if joiner.Handled(err) {
+			id := string(m.data)
+			if env, err := models.DecodeEnvelope(m.data, m.attrs); err == nil {
+				id = env.RequestID
+			}
+			m.q.mu.Lock()
+			m.q.acked = append(m.q.acked, id)
+			m.q.mu.Unlock()
+		} else {
+			m.q.mu.Lock()
+			m.q.nacks++
+			m.q.mu.Unlock()
+			m.q.PublishMessage(m.data, m.attrs)
+		}
+		m.done()
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/splice/models"
+	"github.com/google/splice/spliced/joiner"
+)
+
+// Store is an in-memory datastore of requests and joiner heartbeats. It
+// implements joiner.Store, and is safe for concurrent use.
+type Store struct {
+	mu       sync.Mutex
+	requests map[string]models.Request
+	joiners  map[string]models.Joiner
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{
+		requests: make(map[string]models.Request),
+		joiners:  make(map[string]models.Joiner),
+	}
+}
+
+// Put adds or replaces a request, keyed by its RequestID.
+func (s *Store) Put(req models.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[req.RequestID] = clone(req)
+}
+
+// clone copies the byte slices of req, as a datastore would when storing it,
+// so that callers cannot modify a stored request through them.
+func clone(req models.Request) models.Request {
+	for _, b := range []*[]byte{&req.ClientCert, &req.ResponseData, &req.ResponseKey, &req.CipherNonce, &req.GeneratorData} {
+		if *b != nil {
+			*b = append([]byte(nil), *b...)
+		}
+	}
+	return req
+}
+
+// Get returns the request identified by reqID, if it exists.
+func (s *Store) Get(reqID string) (models.Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.requests[reqID]
+	return clone(req), ok
+}
+
+// Requests returns all requests sorted by RequestID.
+func (s *Store) Requests() []models.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reqs := make([]models.Request, 0, len(s.requests))
+	for _, req := range s.requests {
+		reqs = append(reqs, clone(req))
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].RequestID < reqs[j].RequestID })
+	return reqs
+}
+
+// Joiners returns the latest heartbeat of every joiner sorted by Instance.
+func (s *Store) Joiners() []models.Joiner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	js := make([]models.Joiner, 0, len(s.joiners))
+	for _, j := range s.joiners {
+		js = append(js, j)
+	}
+	sort.Slice(js, func(i, j int) bool { return js[i].Instance < js[j].Instance })
+	return js
+}
+
+// Update implements joiner.Store. Updates are serialized, so fn always sees
+// the latest version of the request.
+func (s *Store) Update(ctx context.Context, reqID string, fn func(*models.Request) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.requests[reqID]
+	if !ok {
+		return fmt.Errorf("Update: no request received with ID %s: %w", reqID, joiner.ErrNotFound)
+	}
+	req = clone(req)
+	if err := fn(&req); err != nil {
+		return err
+	}
+	s.requests[reqID] = clone(req)
+	return nil
+}
+
+// PutJoiner implements joiner.Store.
+func (s *Store) PutJoiner(ctx context.Context, j *models.Joiner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joiners[j.Instance] = *j
+	return nil
+}
@@ -15,33 +15,104 @@
 // Package testing provides helpers for testing SpliceD.
 package testing
 
-import "errors"
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/splice/spliced/joiner"
+)
 
 var (
 	// ErrReuse is returned if a host cannot be joined again due to reuse being disabled
-	ErrReuse = errors.New("reuse disabled and host already exists")
+	ErrReuse = joiner.ErrAccountExists
 
 	// SuccessBlob is returned for a successful join, in lieu of a real metadata blob.
 	SuccessBlob = []byte("good job!")
 )
 
-// InactiveDirectory provides a fake AD structure for testing
+// InactiveDirectory provides a fake AD structure for testing. It implements
+// joiner.Provisioner, and is safe for concurrent use.
 type InactiveDirectory struct {
+	mu        sync.Mutex
 	Computers map[string]bool
+	// Domains holds the domain each computer was last joined to.
+	Domains map[string]string
+	// OUs holds the OU each computer was last joined to, which is empty for
+	// the default computers container.
+	OUs map[string]string
+	// DCs holds the domain controller each computer was last joined by.
+	DCs map[string]string
+	// Unreachable holds the domain controllers that fail every join with
+	// an error wrapping joiner.ErrTransient.
+	Unreachable map[string]bool
 }
 
 // NewInactiveDirectory returns a new InactiveDirectory instance for testing.
 func NewInactiveDirectory() *InactiveDirectory {
 	return &InactiveDirectory{
-		Computers: make(map[string]bool),
+		Computers:   make(map[string]bool),
+		Domains:     make(map[string]string),
+		OUs:         make(map[string]string),
+		DCs:         make(map[string]string),
+		Unreachable: make(map[string]bool),
 	}
 }
 
-// Join joins a host to the fake domain
-func (id *InactiveDirectory) Join(name, domain string, reuse bool) ([]byte, error) {
-	if _, ok := id.Computers[name]; ok && !reuse {
-		return nil, ErrReuse
+// Provision joins a host to the fake domain.
+func (id *InactiveDirectory) Provision(ctx context.Context, opts joiner.ProvisionOptions) (joiner.ProvisionResult, error) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	if id.Unreachable[opts.DC] {
+		return joiner.ProvisionResult{}, &joiner.ProvisionError{DC: opts.DC, Err: fmt.Errorf("%w: domain controller is unreachable", joiner.ErrTransient)}
 	}
-	id.Computers[name] = true
-	return SuccessBlob, nil
+	if _, ok := id.Computers[opts.Name]; ok && !opts.Reuse {
+		return joiner.ProvisionResult{}, &joiner.ProvisionError{DC: opts.DC, Err: ErrReuse}
+	}
+	id.Computers[opts.Name] = true
+	id.Domains[opts.Name] = opts.Domain
+	id.OUs[opts.Name] = opts.OU
+	id.DCs[opts.Name] = opts.DC
+	return joiner.ProvisionResult{
+		Blob:      SuccessBlob,
+		DC:        opts.DC,
+		AccountDN: joiner.AccountDN(opts.Name, opts.Domain, opts.OU),
+	}, nil
+}
+
+// ProvisionCall records a call to a joiner.Provisioner.
+type ProvisionCall struct {
+	Options joiner.ProvisionOptions
+	Result  joiner.ProvisionResult
+	Err     error
+}
+
+// Recorder implements joiner.Provisioner by passing every call on to another
+// Provisioner and recording it. It is safe for concurrent use.
+type Recorder struct {
+	joiner.Provisioner
+
+	mu    sync.Mutex
+	calls []ProvisionCall
+}
+
+// NewRecorder returns a Recorder passing calls on to p.
+func NewRecorder(p joiner.Provisioner) *Recorder {
+	return &Recorder{Provisioner: p}
+}
+
+// Provision passes the call on and records it.
+func (r *Recorder) Provision(ctx context.Context, opts joiner.ProvisionOptions) (joiner.ProvisionResult, error) {
+	res, err := r.Provisioner.Provision(ctx, opts)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, ProvisionCall{Options: opts, Result: res, Err: err})
+	return res, err
+}
+
+// Calls returns the calls recorded so far, in the order they returned.
+func (r *Recorder) Calls() []ProvisionCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ProvisionCall(nil), r.calls...)
 }
@@ -15,10 +15,12 @@
 package testing
 
 import (
+	"context"
 	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/splice/spliced/joiner"
 )
 
 func TestJoinWithReuse(t *testing.T) {
@@ -41,8 +43,8 @@ func TestJoinWithReuse(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		out, err := nid.Join(tt.name, "domain.example.com", true)
-		if diff := cmp.Diff(out, tt.out); diff != "" {
+		res, err := nid.Provision(context.Background(), joiner.ProvisionOptions{Name: tt.name, Domain: "domain.example.com", Reuse: true})
+		if diff := cmp.Diff(res.Blob, tt.out); diff != "" {
 			t.Errorf("%s produced unexpected diff: %v", tt.desc, diff)
 		}
 		if !errors.Is(err, tt.err) {
@@ -71,8 +73,8 @@ func TestJoinWithoutReuse(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		out, err := nid.Join(tt.name, "domain.example.com", false)
-		if diff := cmp.Diff(out, tt.out); diff != "" {
+		res, err := nid.Provision(context.Background(), joiner.ProvisionOptions{Name: tt.name, Domain: "domain.example.com"})
+		if diff := cmp.Diff(res.Blob, tt.out); diff != "" {
 			t.Errorf("%s produced unexpected diff: %v", tt.desc, diff)
 		}
 		if !errors.Is(err, tt.err) {
@@ -80,3 +82,29 @@ func TestJoinWithoutReuse(t *testing.T) {
 		}
 	}
 }
+
+func TestRecorder(t *testing.T) {
+	nid := NewInactiveDirectory()
+	nid.Unreachable["dc1"] = true
+	rec := NewRecorder(nid)
+	opts := []joiner.ProvisionOptions{
+		{Name: "host1", Domain: "domain.example.com", DC: "dc1"},
+		{Name: "host1", Domain: "domain.example.com", OU: "OU=Lab,DC=domain,DC=example,DC=com", DC: "dc2"},
+	}
+	for _, o := range opts {
+		rec.Provision(context.Background(), o)
+	}
+
+	calls := rec.Calls()
+	if len(calls) != len(opts) {
+		t.Fatalf("Calls() returned %d calls, want %d", len(calls), len(opts))
+	}
+	var perr *joiner.ProvisionError
+	if !errors.As(calls[0].Err, &perr) || perr.DC != "dc1" || !errors.Is(calls[0].Err, joiner.ErrTransient) {
+		t.Errorf("first call returned %v, want a transient ProvisionError for dc1", calls[0].Err)
+	}
+	want := joiner.ProvisionResult{Blob: SuccessBlob, DC: "dc2", AccountDN: "CN=host1,OU=Lab,DC=domain,DC=example,DC=com"}
+	if diff := cmp.Diff(ProvisionCall{Options: opts[1], Result: want}, calls[1]); diff != "" {
+		t.Errorf("second call diff (-want +got):\n%s", diff)
+	}
+}